@@ -19,7 +19,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
 
+	"github.com/bloomberg/k8eraid/pkgs/alerters"
+	"github.com/bloomberg/k8eraid/pkgs/expressions"
 	"github.com/bloomberg/k8eraid/pkgs/types"
 
 	corev1 "k8s.io/api/core/v1"
@@ -53,25 +56,68 @@ func watchConfigMap(client kubernetes.Interface, configMapName string, config *t
 	return errors.New("ConfigMap watcher ended")
 }
 
+// configLock guards the config, which the watcher replaces while polls read it
+var configLock sync.RWMutex
+
 func eventReceived(e watch.Event, config *types.ConfigRules) error {
 	if e.Type == watch.Added || e.Type == watch.Modified {
 		log.Printf("ConfigMap %s changed, updating config", configMapName)
 		if configMap, ok := e.Object.(*corev1.ConfigMap); ok {
 			if configJSON, ok := configMap.Data["config.json"]; ok {
-				if err := json.Unmarshal([]byte(configJSON), config); err != nil {
+				// Parse and validate into a new config, so a rejected one leaves the running config in place
+				newConfig := types.ConfigRules{}
+				if err := json.Unmarshal([]byte(configJSON), &newConfig); err != nil {
 					return fmt.Errorf("unable to parse new config from %s: %s", configMapName, err.Error())
 				}
-				for _, pod := range config.Pods {
+				if err := expressions.Validate(&newConfig); err != nil {
+					return fmt.Errorf("invalid config in %s: %s", configMapName, err.Error())
+				}
+				if err := alerters.Validate(newConfig.AlertersConfig); err != nil {
+					return fmt.Errorf("invalid alerter config in %s: %s", configMapName, err.Error())
+				}
+				for _, pod := range newConfig.Pods {
 					log.Println("Pod rule found for: ", pod.Name)
 				}
 
-				for _, daemonSet := range config.Daemonsets {
+				for _, daemonSet := range newConfig.Daemonsets {
 					log.Println("Daemonset rule found for: ", daemonSet.Name)
 				}
 
-				for _, node := range config.Nodes {
+				for _, node := range newConfig.Nodes {
 					log.Println("Node rule found for: ", node.Name)
 				}
+
+				for _, hpa := range newConfig.HPAs {
+					log.Println("HPA rule found for: ", hpa.Name)
+				}
+
+				for _, pdb := range newConfig.PDBs {
+					log.Println("PDB rule found for: ", pdb.Name)
+				}
+
+				for _, service := range newConfig.Services {
+					log.Println("Service rule found for: ", service.Name)
+				}
+
+				for _, ingress := range newConfig.Ingresses {
+					log.Println("Ingress rule found for: ", ingress.Name)
+				}
+
+				for _, certificate := range newConfig.Certificates {
+					log.Println("Certificate rule found for: ", certificate.Name)
+				}
+
+				for _, quota := range newConfig.Quotas {
+					log.Println("Quota rule found for: ", quota.Name)
+				}
+
+				for _, generic := range newConfig.Generic {
+					log.Println("Generic rule found for: ", generic.Resource, generic.Name)
+				}
+
+				configLock.Lock()
+				*config = newConfig
+				configLock.Unlock()
 			} else {
 				return fmt.Errorf("ConfigMap %s missing config.json key", configMapName)
 			}
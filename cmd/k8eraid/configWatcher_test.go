@@ -270,6 +270,15 @@ func Test_EventReceived_err(t *testing.T) {
 			errString: "unable to parse",
 			eventType: watch.Added,
 		},
+		{
+			name: "expression not compiling",
+			configMap: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "k8eraid-config"},
+				Data:       map[string]string{"config.json": `{"pods": [{"name": "*", "expression": "object.status.phase =="}]}`},
+			},
+			errString: "expression for pod rule * does not compile",
+			eventType: watch.Added,
+		},
 		{
 			name: "missing config",
 			configMap: &corev1.ConfigMap{
@@ -308,3 +317,25 @@ func Test_EventReceived_err(t *testing.T) {
 		})
 	}
 }
+
+func Test_EventReceived_rejected_keeps_config(t *testing.T) {
+	config := types.ConfigRules{}
+	event := func(configJSON string) watch.Event {
+		return watch.Event{
+			Type: watch.Modified,
+			Object: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "k8eraid-config"},
+				Data:       map[string]string{"config.json": configJSON},
+			},
+		}
+	}
+	if err := eventReceived(event(`{"pods": [{"name": "web", "expression": "object.status.phase == \"Failed\""}]}`), &config); err != nil {
+		t.Fatalf("eventReceived returned an unexpected error: %s", err.Error())
+	}
+	if err := eventReceived(event(`{"pods": [{"name": "*", "expression": "object.status.phase =="}]}`), &config); err == nil {
+		t.Fatalf("eventReceived did not return an error for an invalid config")
+	}
+	if len(config.Pods) != 1 || config.Pods[0].Name != "web" {
+		t.Errorf("expected the rejected config to leave the running one in place, got pod rules %+v", config.Pods)
+	}
+}
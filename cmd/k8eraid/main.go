@@ -15,15 +15,23 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
 	"strconv"
 	"time"
 
 	"github.com/bloomberg/k8eraid/pkgs/alerters"
+	"github.com/bloomberg/k8eraid/pkgs/api"
+	"github.com/bloomberg/k8eraid/pkgs/delivery"
+	"github.com/bloomberg/k8eraid/pkgs/dispatch"
 	q "github.com/bloomberg/k8eraid/pkgs/queries"
+	"github.com/bloomberg/k8eraid/pkgs/state"
 	"github.com/bloomberg/k8eraid/pkgs/types"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -37,6 +45,7 @@ var (
 	configMapName string
 	config        *types.ConfigRules
 	tickertimeint int64
+	dispatcher    *dispatch.Dispatcher
 )
 
 func kubeClient() (*kubernetes.Clientset, error) {
@@ -47,6 +56,14 @@ func kubeClient() (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(config)
 }
 
+func dynamicClient() (dynamic.Interface, error) {
+	config, configerr := rest.InClusterConfig()
+	if configerr != nil {
+		return nil, configerr
+	}
+	return dynamic.NewForConfig(config)
+}
+
 func main() {
 
 	if tickertime := os.Getenv("POLL_PERIOD"); tickertime == "" {
@@ -69,6 +86,12 @@ func main() {
 	if clientset, err = kubeClient(); err != nil {
 		log.Panicf("Unable to create kubernetes client: %s", err.Error())
 	}
+	var dynamicclient dynamic.Interface
+	if dynamicclient, err = dynamicClient(); err != nil {
+		log.Panicf("Unable to create kubernetes dynamic client: %s", err.Error())
+	}
+
+	alerters.SetKubeClient(clientset)
 
 	// start a watch on the configmap for our config
 	go func() {
@@ -95,61 +118,206 @@ func main() {
 		}
 	}
 
+	// Notifications are sent from a queue for each alerter, so a slow alerter does not hold up polling.
+	// Alerts are raised on every poll, so those missing for two polls have resolved.
+	deliveryQueue := delivery.NewQueue(alerters.Alert)
+	dispatcher = dispatch.NewDispatcher(deliveryQueue.Notify, time.Duration(2*tickertimeint)*time.Second)
+
+	// Persist alert state if a ConfigMap is configured for it. Only the instance holding its lease polls,
+	// so a replacement pod waits for the old one to stop renewing it.
+	if stateConfigMapName := os.Getenv("STATE_CONFIG_MAP"); stateConfigMapName != "" {
+		namespace := os.Getenv("POD_NAMESPACE")
+		if namespace == "" {
+			namespace = metav1.NamespaceSystem
+		}
+		identity := os.Getenv("POD_NAME")
+		if identity == "" {
+			if identity, err = os.Hostname(); err != nil {
+				log.Panicf("Unable to get hostname for alert state lease: %s", err.Error())
+			}
+		}
+		pollPeriod := time.Duration(tickertimeint) * time.Second
+		leaseDuration := 3 * pollPeriod
+		store := state.NewStore(clientset, namespace, stateConfigMapName, identity, leaseDuration)
+		acquireState(store, pollPeriod)
+		go checkpointState(store, pollPeriod, leaseDuration)
+	}
+	go dispatcher.Run(time.Second, nil)
+	go refreshAlertmanager(time.Duration(tickertimeint) * time.Second)
+
+	// Serve the alerts and acknowledgement API if an address is configured for it
+	if apiAddress := os.Getenv("API_ADDRESS"); apiAddress != "" {
+		apiToken := os.Getenv("API_TOKEN")
+		if apiToken == "" {
+			log.Panicf("API_TOKEN must be set to serve the API on %s", apiAddress)
+		}
+		server := api.NewServer(dispatcher, apiToken, os.Getenv("SLACK_SIGNING_SECRET"))
+		go func() {
+			log.Panicf("API server stopped: %s", http.ListenAndServe(apiAddress, server.Handler()))
+		}()
+	}
+
 	// Main logic routine, this will query the Kubernetes api for the intended resources periodically
 	timeTicker := time.NewTicker(time.Duration(tickertimeint) * time.Second)
 	for range timeTicker.C {
-		pollLoop(clientset)
+		pollLoop(clientset, dynamicclient)
+	}
+}
+
+// currentConfig returns the config as last loaded by the ConfigMap watcher
+func currentConfig() types.ConfigRules {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return *config
+}
+
+// refreshAlertmanager posts the alert states to the alertmanager alerters every interval, so alerts do not expire in
+// Alertmanager while they are still firing
+func refreshAlertmanager(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		if err := alerters.RefreshAlertmanager(ctx, currentConfig().AlertersConfig, dispatcher.States(), time.Now()); err != nil {
+			log.Printf("Error refreshing Alertmanager alerts: %s", err.Error())
+		}
+		cancel()
 	}
 }
 
-func pollLoop(clientset kubernetes.Interface) {
+func pollLoop(clientset kubernetes.Interface, dynamicclient dynamic.Interface) {
+	rules := currentConfig()
+	// Iterate through Node rules first, so node alerts are firing before the symptoms they inhibit
+	for _, node := range rules.Nodes {
+		if err := q.PollNode(
+			clientset,
+			node,
+			tickertimeint,
+			dispatcher.Alert,
+			rules.AlertersConfig,
+		); err != nil {
+			log.Printf("Error polling nodes: %s", err.Error())
+		}
+	}
 	// Iterate through Deployment rules
-	for _, deployment := range config.Deployments {
+	for _, deployment := range rules.Deployments {
 
 		if err := q.PollDeployment(
 			clientset,
 			deployment,
 			tickertimeint,
-			alerters.Alert,
-			config.AlertersConfig,
+			dispatcher.Alert,
+			rules.AlertersConfig,
 		); err != nil {
 			log.Printf("Error polling Deployments: %s", err.Error())
 		}
 	}
 	// Iterate through Pod rules
-	for _, pod := range config.Pods {
+	for _, pod := range rules.Pods {
 		if err := q.PollPod(
 			clientset,
 			pod,
 			tickertimeint,
-			alerters.Alert,
-			config.AlertersConfig,
+			dispatcher.Alert,
+			rules.AlertersConfig,
 		); err != nil {
 			log.Printf("Error polling pods: %s", err.Error())
 		}
 	}
 	// Iterate through Daemonset rules
-	for _, daemonset := range config.Daemonsets {
+	for _, daemonset := range rules.Daemonsets {
 		if err := q.PollDaemonset(
 			clientset,
 			daemonset,
 			tickertimeint,
-			alerters.Alert,
-			config.AlertersConfig,
+			dispatcher.Alert,
+			rules.AlertersConfig,
 		); err != nil {
 			log.Printf("Error polling DaemonSets: %s", err.Error())
 		}
 	}
-	// Iterate through Node rules
-	for _, node := range config.Nodes {
-		if err := q.PollNode(
+	// Iterate through HPA rules
+	for _, hpa := range rules.HPAs {
+		if err := q.PollHPA(
 			clientset,
-			node,
+			hpa,
 			tickertimeint,
-			alerters.Alert,
-			config.AlertersConfig,
+			dispatcher.Alert,
+			rules.AlertersConfig,
 		); err != nil {
-			log.Printf("Error polling nodes: %s", err.Error())
+			log.Printf("Error polling HPAs: %s", err.Error())
+		}
+	}
+	// Iterate through PDB rules
+	for _, pdb := range rules.PDBs {
+		if err := q.PollPDB(
+			clientset,
+			pdb,
+			tickertimeint,
+			dispatcher.Alert,
+			rules.AlertersConfig,
+		); err != nil {
+			log.Printf("Error polling PDBs: %s", err.Error())
+		}
+	}
+	// Iterate through Service rules
+	for _, service := range rules.Services {
+		if err := q.PollService(
+			clientset,
+			service,
+			tickertimeint,
+			dispatcher.Alert,
+			rules.AlertersConfig,
+		); err != nil {
+			log.Printf("Error polling services: %s", err.Error())
+		}
+	}
+	// Iterate through Ingress rules
+	for _, ingress := range rules.Ingresses {
+		if err := q.PollIngress(
+			clientset,
+			ingress,
+			tickertimeint,
+			dispatcher.Alert,
+			rules.AlertersConfig,
+		); err != nil {
+			log.Printf("Error polling ingresses: %s", err.Error())
+		}
+	}
+	// Iterate through Certificate rules
+	for _, certificate := range rules.Certificates {
+		if err := q.PollCertificate(
+			clientset,
+			certificate,
+			tickertimeint,
+			dispatcher.Alert,
+			rules.AlertersConfig,
+		); err != nil {
+			log.Printf("Error polling certificates: %s", err.Error())
+		}
+	}
+	// Iterate through Quota rules
+	for _, quota := range rules.Quotas {
+		if err := q.PollQuota(
+			clientset,
+			quota,
+			tickertimeint,
+			dispatcher.Alert,
+			rules.AlertersConfig,
+		); err != nil {
+			log.Printf("Error polling resource quotas: %s", err.Error())
+		}
+	}
+	// Iterate through Generic rules
+	for _, generic := range rules.Generic {
+		if err := q.PollGeneric(
+			dynamicclient,
+			generic,
+			tickertimeint,
+			dispatcher.Alert,
+			rules.AlertersConfig,
+		); err != nil {
+			log.Printf("Error polling generic resources: %s", err.Error())
 		}
 	}
 }
@@ -0,0 +1,61 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/state"
+)
+
+// acquireState blocks until this instance holds the lease on the state ConfigMap, then restores the saved alert state
+func acquireState(store *state.Store, retryInterval time.Duration) {
+	for {
+		acquired, states, err := store.Acquire()
+		if err != nil {
+			log.Printf("Error acquiring alert state: %s", err.Error())
+		} else if acquired {
+			log.Printf("Acquired alert state lease, restoring %d alerts", len(states))
+			dispatcher.Restore(states)
+			return
+		} else {
+			log.Printf("Alert state lease is held by another instance, waiting")
+		}
+		time.Sleep(retryInterval)
+	}
+}
+
+// checkpointState saves alert state every interval. Once the lease is lost, or could not be renewed before it
+// expired, another instance may have taken over, so panic rather than keep alerting alongside it.
+func checkpointState(store *state.Store, interval time.Duration, leaseDuration time.Duration) {
+	lastRenewed := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		err := store.Checkpoint(dispatcher.States())
+		if err == nil {
+			lastRenewed = time.Now()
+			continue
+		}
+		if _, ok := err.(*state.LeaseLostErr); ok {
+			log.Panicf("Stopping: %s", err.Error())
+		}
+		log.Printf("Error saving alert state: %s", err.Error())
+		if time.Since(lastRenewed) > leaseDuration {
+			log.Panicf("Stopping: alert state lease could not be renewed for %s", leaseDuration)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 package alerters
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -32,50 +33,26 @@ func init() {
 	errLogger = log.New(os.Stderr, "alerters", log.LstdFlags)
 }
 
-// Alert function takes alertType, alertName and alertMessage as inputs, and triggers the correct alert type
+// Alert function takes a notification from the dispatcher, and sends it with the alerter it is for, returning the
+// alerter's error if it could not send it. Resolved notifications go to the alerter's Resolve, so alerters that
+// can close what they sent do so. The alerter gives up once ctx is done.
 func Alert(
-	alertType string,
-	alertName string,
-	alertMessage string,
+	ctx context.Context,
+	notification types.Notification,
 	config types.AlertersConfig,
-) {
-
-	// if alert type is stderr or blank, alert to stderr
-	if alertType == "stderr" || alertType == "" {
-		AlertStderr(alertMessage)
-	}
-
-	// if alert type is smtp, find matching rule and send mail
-	if alertType == "smtp" {
-		for _, alertRules := range config.Types.SMTPAlerterList {
-			if alertRules.Name == alertName {
-				AlertSMTP(alertRules, alertMessage)
-			}
-		}
-	}
-
-	// if alert type is pagerdutyV2, find matching rule and alert
-	if alertType == "pagerdutyV2" {
-		for _, alertRules := range config.Types.PDAlerterList {
-			if alertRules.Name == alertName {
-				AlertPagerDuty(alertRules, alertMessage)
-			}
-		}
+) error {
+	// if alert type is blank, alert to stderr
+	alerterType := notification.AlerterType
+	if alerterType == "" {
+		alerterType = "stderr"
 	}
 
-	// if alert type is webhook, find matching rule and trigger hook
-	if alertType == "webhook" {
-		for _, alertRules := range config.Types.WebhookAlerterList {
-			if alertRules.Name == alertName {
-				AlertWebhook(alertRules, alertMessage)
-			}
-		}
+	alerter, err := Find(config, alerterType, notification.AlerterName)
+	if err != nil {
+		return err
 	}
-	if alertType == "slack" {
-		for _, alertRules := range config.Types.SlackAlerterList {
-			if alertRules.Name == alertName {
-				AlertSlack(alertRules, alertMessage)
-			}
-		}
+	if notification.Resolved {
+		return alerter.Resolve(ctx, notification)
 	}
+	return alerter.Send(ctx, notification)
 }
@@ -0,0 +1,207 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// Firing alerts expire in Alertmanager this long after they were last posted, unless configured otherwise
+const defaultAlertmanagerTTL = int64(300)
+
+// AlertmanagerAlert is an alert in the body of a request to the Alertmanager v2 API
+type AlertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+func init() {
+	Register("alertmanager", newAlertmanagerAlerter)
+}
+
+// alertmanagerAlerter is the Alerter for alertmanager alerters
+type alertmanagerAlerter struct {
+	config types.AlertmanagerAlerterConfig
+}
+
+func newAlertmanagerAlerter(config json.RawMessage) (Alerter, error) {
+	a := &alertmanagerAlerter{}
+	if err := json.Unmarshal(config, &a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *alertmanagerAlerter) Name() string {
+	return a.config.Name
+}
+
+// Validate checks the Alertmanager URL is set
+func (a *alertmanagerAlerter) Validate() error {
+	return requireFields("url", a.config.URL)
+}
+
+// Send posts the firing alerts to Alertmanager
+func (a *alertmanagerAlerter) Send(ctx context.Context, notification types.Notification) error {
+	return AlertAlertmanager(ctx, a.config, notification)
+}
+
+// Resolve posts the alerts to Alertmanager ending now
+func (a *alertmanagerAlerter) Resolve(ctx context.Context, notification types.Notification) error {
+	return AlertAlertmanager(ctx, a.config, notification)
+}
+
+// AlertAlertmanager posts the alerts of a notification to Alertmanager. Firing alerts are posted with an end time of
+// alertTTL seconds from now, and RefreshAlertmanager posts them again before they expire. Resolved alerts are
+// posted ending now.
+func AlertAlertmanager(ctx context.Context, alertdata types.AlertmanagerAlerterConfig, notification types.Notification) error {
+	return postAlertmanager(ctx, alertdata, AlertmanagerInput(alertdata, notification, time.Now()))
+}
+
+// RefreshAlertmanager posts the alerts of every alertmanager alerter again from the dispatcher's alert states, so
+// they stay firing in Alertmanager for as long as they fire, whether or not notifications are sent for them, such as
+// while they are acknowledged or waiting for their group's next interval. Only alerts sent at least once are posted.
+// Alerts resolved within the TTL are posted ending when they resolved, which ends any a resolved notification did
+// not. It should be called more often than the TTL, such as on every poll.
+func RefreshAlertmanager(ctx context.Context, config types.AlertersConfig, states []types.AlertState, now time.Time) error {
+	errs := []string{}
+	for _, alerterConfig := range config.Types.Configs {
+		if alerterConfig.Type != "alertmanager" {
+			continue
+		}
+		alerter, err := build(alerterConfig)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		alertdata := alerter.(*alertmanagerAlerter).config
+		alerts := []AlertmanagerAlert{}
+		for _, state := range states {
+			if state.Alert.AlerterType != "alertmanager" || state.Alert.AlerterName != alertdata.Name || state.LastNotified.IsZero() {
+				continue
+			}
+			if state.Status == types.AlertFiring {
+				alerts = append(alerts, alertmanagerAlert(alertdata, state.Alert, alertmanagerEndsAt(alertdata, now), now))
+			} else if now.Sub(state.ResolvedAt) <= time.Duration(alertmanagerTTL(alertdata))*time.Second {
+				alerts = append(alerts, alertmanagerAlert(alertdata, state.Alert, state.ResolvedAt, now))
+			}
+		}
+		if err := postAlertmanager(ctx, alertdata, alerts); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// postAlertmanager posts alerts to the Alertmanager v2 API
+func postAlertmanager(ctx context.Context, alertdata types.AlertmanagerAlerterConfig, alerts []AlertmanagerAlert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	client, err := newHTTPClient(ctx, alertdata.ProxyServer)
+	if err != nil {
+		return fmt.Errorf("alert configuration %s: %s", alertdata.Name, err.Error())
+	}
+	data, err := json.Marshal(alerts)
+	if err != nil {
+		return fmt.Errorf("issue sending Alertmanager alert: %s", err.Error())
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(alertdata.URL, "/")+"/api/v2/alerts", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("issue sending Alertmanager alert: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("issue sending Alertmanager alert: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("issue sending Alertmanager alert: HTTP Status Code: %d", resp.StatusCode)
+	}
+	logger.Println("Alerts posted for alertmanager alerter: ", alertdata.Name)
+	return nil
+}
+
+// AlertmanagerInput generates the alerts posted to Alertmanager for a notification
+func AlertmanagerInput(alertdata types.AlertmanagerAlerterConfig, notification types.Notification, now time.Time) []AlertmanagerAlert {
+	endsAt := alertmanagerEndsAt(alertdata, now)
+	if notification.Resolved {
+		endsAt = now
+	}
+	alerts := []AlertmanagerAlert{}
+	for _, alert := range notification.Alerts {
+		alerts = append(alerts, alertmanagerAlert(alertdata, alert, endsAt, now))
+	}
+	return alerts
+}
+
+func alertmanagerTTL(alertdata types.AlertmanagerAlerterConfig) int64 {
+	if alertdata.AlertTTL <= 0 {
+		return defaultAlertmanagerTTL
+	}
+	return alertdata.AlertTTL
+}
+
+// alertmanagerEndsAt is the end time of alerts posted firing at now
+func alertmanagerEndsAt(alertdata types.AlertmanagerAlerterConfig, now time.Time) time.Time {
+	return now.Add(time.Duration(alertmanagerTTL(alertdata)) * time.Second)
+}
+
+// alertmanagerAlert converts an alert for the Alertmanager API, ending at endsAt
+func alertmanagerAlert(alertdata types.AlertmanagerAlerterConfig, alert types.Alert, endsAt time.Time, now time.Time) AlertmanagerAlert {
+	labels := map[string]string{}
+	for name, value := range alert.LabelSet() {
+		if value != "" {
+			labels[name] = value
+		}
+	}
+	annotations := map[string]string{
+		"summary":     strings.SplitN(alert.Message, "\n", 2)[0],
+		"description": alert.Message,
+	}
+	if alert.RunbookURL != "" {
+		annotations["runbook"] = alert.RunbookURL
+	}
+	generatorURL := alert.DashboardURL
+	if generatorURL == "" {
+		generatorURL = alertdata.GeneratorURL
+	}
+	startsAt := alert.StartsAt
+	if startsAt.IsZero() {
+		startsAt = now
+	}
+	return AlertmanagerAlert{
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     startsAt,
+		EndsAt:       endsAt,
+		GeneratorURL: generatorURL,
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AlertAlertmanager_OK(t *testing.T) {
+	startsAt := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	notification := types.Notification{
+		AlerterType: "alertmanager",
+		Alerts: []types.Alert{
+			{
+				Rule:       "deployments/web",
+				Check:      "MinReplicas",
+				Severity:   types.SeverityCritical,
+				Kind:       "Deployment",
+				Namespace:  "default",
+				Name:       "web",
+				Message:    "Deployment web is under minimum replicas!\nOnly 1 of 3 replicas are available.",
+				RunbookURL: "https://runbooks.example.com/min-replicas",
+				StartsAt:   startsAt,
+			},
+		},
+	}
+	withWebhookServer(t, false, func(buf *bytes.Buffer, url string) {
+		require.NoError(t, AlertAlertmanager(context.Background(), types.AlertmanagerAlerterConfig{URL: url, GeneratorURL: "https://k8eraid.example.com"}, notification))
+
+		alerts := []AlertmanagerAlert{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &alerts), "request body should be a list of alerts")
+		require.Len(t, alerts, 1)
+		assert.Equal(t, map[string]string{
+			"alertname": "MinReplicas",
+			"severity":  "critical",
+			"rule":      "deployments/web",
+			"kind":      "Deployment",
+			"namespace": "default",
+			"name":      "web",
+		}, alerts[0].Labels)
+		assert.Equal(t, "Deployment web is under minimum replicas!", alerts[0].Annotations["summary"])
+		assert.Equal(t, "https://runbooks.example.com/min-replicas", alerts[0].Annotations["runbook"])
+		assert.Equal(t, "https://k8eraid.example.com", alerts[0].GeneratorURL)
+		assert.True(t, alerts[0].StartsAt.Equal(startsAt))
+		assert.True(t, alerts[0].EndsAt.After(time.Now()), "firing alert should end in the future")
+	})
+}
+
+func Test_AlertmanagerInput_resolved(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	notification := types.Notification{Alerts: []types.Alert{{Check: "MinReplicas"}}, Resolved: true}
+	alerts := AlertmanagerInput(types.AlertmanagerAlerterConfig{}, notification, now)
+	require.Len(t, alerts, 1)
+	assert.True(t, alerts[0].EndsAt.Equal(now), "resolved alert should end now")
+}
+
+func Test_RefreshAlertmanager(t *testing.T) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	alert := func(check string) types.Alert {
+		return types.Alert{AlerterType: "alertmanager", AlerterName: "am", Check: check, Kind: "Pod", Namespace: "default", Name: "web"}
+	}
+	states := []types.AlertState{
+		// Acknowledged, so no notifications are sent for it, but it is still firing
+		{Alert: alert("PodFailures"), Status: types.AlertFiring, LastNotified: now.Add(-time.Hour), Ack: &types.Ack{Until: now.Add(time.Hour)}},
+		{Alert: alert("Flapping"), Status: types.AlertResolved, LastNotified: now.Add(-time.Hour), ResolvedAt: now.Add(-time.Minute)},
+		// Resolved too long ago, Alertmanager has already expired it
+		{Alert: alert("MinReplicas"), Status: types.AlertResolved, LastNotified: now.Add(-time.Hour), ResolvedAt: now.Add(-time.Hour)},
+		// Never sent, such as while it is inhibited
+		{Alert: alert("Unhealthy"), Status: types.AlertFiring},
+	}
+	other := alert("PodFailures")
+	other.AlerterName = "other"
+	states = append(states, types.AlertState{Alert: other, Status: types.AlertFiring, LastNotified: now})
+
+	withWebhookServer(t, false, func(buf *bytes.Buffer, url string) {
+		alerterConfig, err := types.NewAlerterConfig("alertmanager", types.AlertmanagerAlerterConfig{Name: "am", URL: url})
+		require.NoError(t, err)
+		config := types.AlertersConfig{Types: types.AlerterTypes{Configs: []types.AlerterConfig{alerterConfig}}}
+		require.NoError(t, RefreshAlertmanager(context.Background(), config, states, now))
+
+		alerts := []AlertmanagerAlert{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &alerts))
+		require.Len(t, alerts, 2)
+		assert.Equal(t, "PodFailures", alerts[0].Labels["alertname"])
+		assert.True(t, alerts[0].EndsAt.Equal(now.Add(5*time.Minute)), "firing alert should end a TTL from now")
+		assert.Equal(t, "Flapping", alerts[1].Labels["alertname"])
+		assert.True(t, alerts[1].EndsAt.Equal(now.Add(-time.Minute)), "resolved alert should end when it resolved")
+	})
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// How long an exec alerter's command may run when its config does not say
+const defaultExecTimeout = 30 * time.Second
+
+func init() {
+	Register("exec", newExecAlerter)
+}
+
+// execAlerter is the Alerter for exec alerters, plugins run as a command for every notification
+type execAlerter struct {
+	config types.ExecAlerterConfig
+}
+
+func newExecAlerter(config json.RawMessage) (Alerter, error) {
+	a := &execAlerter{}
+	if err := json.Unmarshal(config, &a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *execAlerter) Name() string {
+	return a.config.Name
+}
+
+// Validate checks the alerter has a command to run
+func (a *execAlerter) Validate() error {
+	return requireFields("command", a.config.Command)
+}
+
+// Send runs the command with the notification
+func (a *execAlerter) Send(ctx context.Context, notification types.Notification) error {
+	return AlertExec(ctx, a.config, notification)
+}
+
+// Resolve runs the command with the resolved notification, which has "resolved" set
+func (a *execAlerter) Resolve(ctx context.Context, notification types.Notification) error {
+	return AlertExec(ctx, a.config, notification)
+}
+
+// AlertExec runs an exec alerter's command with the notification as JSON on its stdin. The command failing, by
+// exiting non-zero or running past its timeout or the deadline of ctx, fails the notification, with what it wrote
+// to stderr.
+func AlertExec(ctx context.Context, alertdata types.ExecAlerterConfig, notification types.Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	timeout := defaultExecTimeout
+	if alertdata.Timeout > 0 {
+		timeout = time.Duration(alertdata.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, alertdata.Command, alertdata.Args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("issue running exec alerter %s: %s: %s", alertdata.Name, err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	logger.Println("Command run for exec alerter: ", alertdata.Name)
+	return nil
+}
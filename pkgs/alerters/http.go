@@ -0,0 +1,80 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// newHTTPClient returns a client for an alerter, through proxyServer if it is set
+func newHTTPClient(ctx context.Context, proxyServer string) (*http.Client, error) {
+	return newTLSHTTPClient(ctx, proxyServer, nil)
+}
+
+// newTLSHTTPClient returns a client for an alerter connecting with tlsConfig, or the defaults when it is nil.
+// Requests time out at the deadline of ctx.
+func newTLSHTTPClient(ctx context.Context, proxyServer string, tlsConfig *tls.Config) (*http.Client, error) {
+	transport := &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout: 5 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: 5 * time.Second,
+		TLSClientConfig:     tlsConfig,
+	}
+	if proxyServer != "" {
+		proxyURL, err := url.Parse(proxyServer)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy server %s: %s", proxyServer, err.Error())
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return withDeadline(ctx, &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+	}), nil
+}
+
+// withDeadline makes a client's requests time out at the deadline of ctx, in place of its own timeout
+func withDeadline(ctx context.Context, client *http.Client) *http.Client {
+	if deadline, ok := ctx.Deadline(); ok {
+		client.Timeout = time.Until(deadline)
+		// A zero timeout would mean none at all
+		if client.Timeout <= 0 {
+			client.Timeout = time.Nanosecond
+		}
+	}
+	return client
+}
+
+// loadCAFile reads a PEM bundle of CA certificates, for alerters trusting their own CAs
+func loadCAFile(path string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA file: %s", err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in CA file %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// kubeClient is the client alerters use to write Events and read Secrets
+var kubeClient kubernetes.Interface
+
+// SetKubeClient sets the client used by alerters that talk to the kubernetes API
+func SetKubeClient(client kubernetes.Interface) {
+	kubeClient = client
+}
+
+// secretNamespace is the namespace Secrets are read from when a SecretKeyRef does not name one
+func secretNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	return "kube-system"
+}
+
+// resolveSecretValue reads a SecretValue from its environment variable or Secret
+func resolveSecretValue(value types.SecretValue) (string, error) {
+	if value.Secret == nil {
+		if value.EnvVar == "" {
+			return "", fmt.Errorf("no envVar or secret set")
+		}
+		return os.Getenv(value.EnvVar), nil
+	}
+	if kubeClient == nil {
+		return "", fmt.Errorf("no kubernetes client to read secret %s", value.Secret.Name)
+	}
+	namespace := value.Secret.Namespace
+	if namespace == "" {
+		namespace = secretNamespace()
+	}
+	secret, err := kubeClient.CoreV1().Secrets(namespace).Get(value.Secret.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	data, ok := secret.Data[value.Secret.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s/%s has no key %s", namespace, value.Secret.Name, value.Secret.Key)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Longest Event message written, longer alerts are cut short
+const maxEventMessage = 1024
+
+func init() {
+	Register("kubeEvent", newKubeEventAlerter)
+}
+
+// kubeEventAlerter is the Alerter for kubeEvent alerters
+type kubeEventAlerter struct {
+	config types.KubeEventAlerterConfig
+}
+
+func newKubeEventAlerter(config json.RawMessage) (Alerter, error) {
+	a := &kubeEventAlerter{}
+	if err := json.Unmarshal(config, &a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *kubeEventAlerter) Name() string {
+	return a.config.Name
+}
+
+// Validate has nothing to check, Events need no settings
+func (a *kubeEventAlerter) Validate() error {
+	return nil
+}
+
+// Send records a Warning Event for each alert. The client-go version k8eraid builds with takes no context, so
+// these calls are bounded by the Kubernetes client rather than by ctx.
+func (a *kubeEventAlerter) Send(_ context.Context, notification types.Notification) error {
+	return AlertKubeEvent(a.config, notification)
+}
+
+// Resolve does nothing, Events age out on their own
+func (a *kubeEventAlerter) Resolve(context.Context, types.Notification) error {
+	return nil
+}
+
+// AlertKubeEvent records each alert of a notification as a Warning Event on the object it is about, so it shows up in
+// kubectl describe. An alert raised again updates its Event, counting the repeats, rather than creating a new one.
+func AlertKubeEvent(alertdata types.KubeEventAlerterConfig, notification types.Notification) error {
+	if kubeClient == nil {
+		return fmt.Errorf("alert configuration %s: no kubernetes client for events", alertdata.Name)
+	}
+	var failed error
+	for _, alert := range notification.Alerts {
+		if alert.Kind == "" || alert.Name == "" {
+			// Alerts about a set of objects, such as MinPods, have no object to record an Event on
+			continue
+		}
+		if err := recordEvent(kubeClient, alertdata, alert, time.Now()); err != nil {
+			failed = fmt.Errorf("issue recording Event: %s", err.Error())
+		}
+	}
+	return failed
+}
+
+func recordEvent(client kubernetes.Interface, alertdata types.KubeEventAlerterConfig, alert types.Alert, now time.Time) error {
+	// Events for cluster scoped objects, such as nodes, go in the default namespace
+	namespace := alert.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	message := alert.Message
+	if len(message) > maxEventMessage {
+		message = message[:maxEventMessage-3] + "..."
+	}
+	eventName := fmt.Sprintf("%s.k8eraid-%s", strings.ToLower(alert.Name), alert.Fingerprint())
+
+	events := client.CoreV1().Events(namespace)
+	event, err := events.Get(eventName, metav1.GetOptions{})
+	if err == nil {
+		event = event.DeepCopy()
+		event.Count++
+		event.LastTimestamp = metav1.NewTime(now)
+		event.Message = message
+		_, err = events.Update(event)
+		return err
+	}
+	if !errors.IsNotFound(err) {
+		return err
+	}
+
+	component := alertdata.Component
+	if component == "" {
+		component = "k8eraid"
+	}
+	_, err = events.Create(&corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      eventName,
+			Namespace: namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			Kind:      alert.Kind,
+			Namespace: alert.Namespace,
+			Name:      alert.Name,
+			UID:       k8stypes.UID(alert.UID),
+		},
+		Reason:         "K8eraid" + alert.Check,
+		Message:        message,
+		Source:         corev1.EventSource{Component: component},
+		FirstTimestamp: metav1.NewTime(now),
+		LastTimestamp:  metav1.NewTime(now),
+		Count:          1,
+		Type:           corev1.EventTypeWarning,
+	})
+	return err
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"testing"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_AlertKubeEvent_count_aggregation(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	SetKubeClient(client)
+	defer SetKubeClient(nil)
+
+	notification := types.Notification{
+		AlerterType: "kubeEvent",
+		Alerts: []types.Alert{
+			{Check: "MinReplicas", Kind: "Deployment", Namespace: "default", Name: "web", Message: "Deployment web is under minimum replicas!"},
+			{Check: "MinPods", Kind: "Pod", Message: "Number of pods for label app=web is under minimum specification!"},
+		},
+	}
+	require.NoError(t, AlertKubeEvent(types.KubeEventAlerterConfig{Name: "test"}, notification))
+	require.NoError(t, AlertKubeEvent(types.KubeEventAlerterConfig{Name: "test"}, notification))
+
+	events, err := client.CoreV1().Events(metav1.NamespaceDefault).List(metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, events.Items, 1, "expected one Event, for the alert about an object")
+	event := events.Items[0]
+	assert.Equal(t, "K8eraidMinReplicas", event.Reason)
+	assert.Equal(t, corev1.EventTypeWarning, event.Type)
+	assert.Equal(t, int32(2), event.Count, "repeated alert should count up its Event")
+	assert.Equal(t, corev1.ObjectReference{Kind: "Deployment", Namespace: "default", Name: "web"}, event.InvolvedObject)
+	assert.Equal(t, "k8eraid", event.Source.Component)
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// Alerts in a group listed with their own facts, any more are only in the message
+const maxTeamsFactSets = 10
+
+// Adaptive Card container styles by severity, which Teams shows as the card's color
+var teamsSeverityStyles = map[string]string{
+	types.SeverityCritical: "attention",
+	types.SeverityWarning:  "warning",
+	types.SeverityInfo:     "accent",
+}
+
+// TeamsMessage is the body of a message to a Teams incoming webhook
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+// TeamsAttachment wraps an Adaptive Card in a Teams message
+type TeamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     AdaptiveCard `json:"content"`
+}
+
+// AdaptiveCard is the subset of the Adaptive Card schema used for alerts
+type AdaptiveCard struct {
+	Schema  string                   `json:"$schema"`
+	Type    string                   `json:"type"`
+	Version string                   `json:"version"`
+	Body    []map[string]interface{} `json:"body"`
+	Actions []map[string]interface{} `json:"actions,omitempty"`
+}
+
+func init() {
+	Register("msteams", newMSTeamsAlerter)
+}
+
+// msTeamsAlerter is the Alerter for msteams alerters
+type msTeamsAlerter struct {
+	config types.MSTeamsAlerterConfig
+}
+
+func newMSTeamsAlerter(config json.RawMessage) (Alerter, error) {
+	a := &msTeamsAlerter{}
+	if err := json.Unmarshal(config, &a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *msTeamsAlerter) Name() string {
+	return a.config.Name
+}
+
+// Validate checks a webhook URL is set
+func (a *msTeamsAlerter) Validate() error {
+	return requireFields("webhookURL", a.config.WebhookURL)
+}
+
+// Send posts the notification to Teams as an Adaptive Card
+func (a *msTeamsAlerter) Send(ctx context.Context, notification types.Notification) error {
+	return AlertMSTeams(ctx, a.config, notification)
+}
+
+// Resolve does nothing, Teams cards can not be updated through a webhook
+func (a *msTeamsAlerter) Resolve(context.Context, types.Notification) error {
+	return nil
+}
+
+// AlertMSTeams posts an alert to a Microsoft Teams incoming webhook as an Adaptive Card
+func AlertMSTeams(ctx context.Context, alertdata types.MSTeamsAlerterConfig, notification types.Notification) error {
+	client, err := newHTTPClient(ctx, alertdata.ProxyServer)
+	if err != nil {
+		return fmt.Errorf("alert configuration %s: %s", alertdata.Name, err.Error())
+	}
+	data, err := json.Marshal(MSTeamsInput(alertdata, notification))
+	if err != nil {
+		return fmt.Errorf("issue sending Teams alert: %s", err.Error())
+	}
+	req, err := http.NewRequest("POST", alertdata.WebhookURL, bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("issue sending Teams alert: %s", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("issue sending Teams alert: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("issue sending Teams alert: HTTP Status Code: %d", resp.StatusCode)
+	}
+	logger.Println("Teams message sent for msteams alerter: ", alertdata.Name)
+	return nil
+}
+
+// MSTeamsInput formats a notification as an Adaptive Card, with a fact set describing each alert
+func MSTeamsInput(alertdata types.MSTeamsAlerterConfig, notification types.Notification) TeamsMessage {
+	style, ok := teamsSeverityStyles[notification.Severity]
+	if !ok {
+		style = teamsSeverityStyles[types.SeverityWarning]
+	}
+	title := fmt.Sprintf("k8eraid %s alert", notification.Severity)
+	if alertdata.ClusterName != "" {
+		title = fmt.Sprintf("%s in %s", title, alertdata.ClusterName)
+	}
+
+	body := []map[string]interface{}{
+		{
+			"type":  "Container",
+			"style": style,
+			"bleed": true,
+			"items": []map[string]interface{}{
+				{"type": "TextBlock", "text": title, "weight": "bolder", "size": "medium", "wrap": true},
+			},
+		},
+		{"type": "TextBlock", "text": notification.Message, "wrap": true},
+	}
+	for i, alert := range notification.Alerts {
+		if i == maxTeamsFactSets {
+			break
+		}
+		body = append(body, map[string]interface{}{
+			"type":      "FactSet",
+			"separator": true,
+			"facts":     teamsFacts(alertdata, alert),
+		})
+	}
+
+	actions := []map[string]interface{}{}
+	if runbookURL := firstAlertLink(notification.Alerts, func(a types.Alert) string { return a.RunbookURL }); runbookURL != "" {
+		actions = append(actions, map[string]interface{}{"type": "Action.OpenUrl", "title": "Runbook", "url": runbookURL})
+	}
+	if dashboardURL := firstAlertLink(notification.Alerts, func(a types.Alert) string { return a.DashboardURL }); dashboardURL != "" {
+		actions = append(actions, map[string]interface{}{"type": "Action.OpenUrl", "title": "Dashboard", "url": dashboardURL})
+	}
+
+	return TeamsMessage{
+		Type: "message",
+		Attachments: []TeamsAttachment{
+			{
+				ContentType: "application/vnd.microsoft.card.adaptive",
+				Content: AdaptiveCard{
+					Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+					Type:    "AdaptiveCard",
+					Version: "1.2",
+					Body:    body,
+					Actions: actions,
+				},
+			},
+		},
+	}
+}
+
+// teamsFacts describes an alert: where it is, what failed, and the values observed in its extra labels
+func teamsFacts(alertdata types.MSTeamsAlerterConfig, alert types.Alert) []map[string]string {
+	facts := []map[string]string{}
+	addFact := func(title string, value string) {
+		if value != "" {
+			facts = append(facts, map[string]string{"title": title, "value": value})
+		}
+	}
+	addFact("Cluster", alertdata.ClusterName)
+	addFact("Namespace", alert.Namespace)
+	addFact("Kind", alert.Kind)
+	addFact("Name", alert.Name)
+	addFact("Check", alert.Check)
+	names := []string{}
+	for name := range alert.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		addFact(name, alert.Labels[name])
+	}
+	return facts
+}
+
+// firstAlertLink returns the first link set on any of the alerts
+func firstAlertLink(alerts []types.Alert, link func(types.Alert) string) string {
+	for _, alert := range alerts {
+		if url := link(alert); url != "" {
+			return url
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AlertMSTeams_OK(t *testing.T) {
+	notification := types.Notification{
+		AlerterType: "msteams",
+		Message:     "Quota compute in namespace default is at 95% of limits.cpu!",
+		Severity:    types.SeverityCritical,
+		Alerts: []types.Alert{
+			{
+				Check:      "QuotaUsage",
+				Kind:       "ResourceQuota",
+				Namespace:  "default",
+				Name:       "compute",
+				Labels:     map[string]string{"resource": "limits.cpu"},
+				RunbookURL: "https://runbooks.example.com/quota",
+			},
+		},
+	}
+	withWebhookServer(t, false, func(buf *bytes.Buffer, url string) {
+		require.NoError(t, AlertMSTeams(context.Background(), types.MSTeamsAlerterConfig{WebhookURL: url, ClusterName: "prod-1"}, notification))
+
+		message := TeamsMessage{}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &message), "request body should be a Teams message")
+		require.Len(t, message.Attachments, 1)
+		card := message.Attachments[0].Content
+		assert.Equal(t, "application/vnd.microsoft.card.adaptive", message.Attachments[0].ContentType)
+		assert.Equal(t, "attention", card.Body[0]["style"], "critical alerts should use the attention color")
+
+		facts := map[string]string{}
+		for _, fact := range card.Body[2]["facts"].([]interface{}) {
+			f := fact.(map[string]interface{})
+			facts[f["title"].(string)] = f["value"].(string)
+		}
+		assert.Equal(t, map[string]string{
+			"Cluster":   "prod-1",
+			"Namespace": "default",
+			"Kind":      "ResourceQuota",
+			"Name":      "compute",
+			"Check":     "QuotaUsage",
+			"resource":  "limits.cpu",
+		}, facts)
+
+		require.Len(t, card.Actions, 1, "expected a runbook button")
+		assert.Equal(t, "https://runbooks.example.com/quota", card.Actions[0]["url"])
+	})
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// Opsgenie API base URLs by region
+const (
+	opsgenieUSURL = "https://api.opsgenie.com"
+	opsgenieEUURL = "https://api.eu.opsgenie.com"
+)
+
+// Opsgenie rejects alert messages longer than this
+const opsgenieMaxMessage = 130
+
+// Priorities for severities missing from an alerter's priorities
+var defaultOpsgeniePriorities = map[string]string{
+	types.SeverityCritical: "P1",
+	types.SeverityWarning:  "P3",
+	types.SeverityInfo:     "P5",
+}
+
+// OpsgenieAlertDetails is the body of a request creating an Opsgenie alert
+type OpsgenieAlertDetails struct {
+	Message     string                    `json:"message"`
+	Alias       string                    `json:"alias"`
+	Description string                    `json:"description,omitempty"`
+	Responders  []types.OpsgenieResponder `json:"responders,omitempty"`
+	Tags        []string                  `json:"tags,omitempty"`
+	Details     map[string]string         `json:"details,omitempty"`
+	Entity      string                    `json:"entity,omitempty"`
+	Source      string                    `json:"source"`
+	Priority    string                    `json:"priority"`
+}
+
+// OpsgenieCloseDetails is the body of a request closing an Opsgenie alert
+type OpsgenieCloseDetails struct {
+	Source string `json:"source"`
+	Note   string `json:"note"`
+}
+
+func init() {
+	Register("opsgenie", newOpsgenieAlerter)
+}
+
+// opsgenieAlerter is the Alerter for opsgenie alerters
+type opsgenieAlerter struct {
+	config types.OpsgenieAlerterConfig
+}
+
+func newOpsgenieAlerter(config json.RawMessage) (Alerter, error) {
+	a := &opsgenieAlerter{}
+	if err := json.Unmarshal(config, &a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *opsgenieAlerter) Name() string {
+	return a.config.Name
+}
+
+// Validate checks the API key variable is set
+func (a *opsgenieAlerter) Validate() error {
+	return requireFields("apiKeyEnvVar", a.config.APIKeyEnvVar)
+}
+
+// Send creates or updates the Opsgenie alert for the notification key
+func (a *opsgenieAlerter) Send(ctx context.Context, notification types.Notification) error {
+	return AlertOpsgenie(ctx, a.config, notification)
+}
+
+// Resolve closes the Opsgenie alert for the notification key
+func (a *opsgenieAlerter) Resolve(ctx context.Context, notification types.Notification) error {
+	return AlertOpsgenie(ctx, a.config, notification)
+}
+
+// AlertOpsgenie creates an Opsgenie alert for a notification, or closes it once resolved. Alerts are created with an
+// alias from the notification key, so Opsgenie deduplicates the repeats of an alert rather than opening new ones.
+func AlertOpsgenie(ctx context.Context, alertdata types.OpsgenieAlerterConfig, notification types.Notification) error {
+	client, err := newHTTPClient(ctx, alertdata.ProxyServer)
+	if err != nil {
+		return fmt.Errorf("alert configuration %s: %s", alertdata.Name, err.Error())
+	}
+	if err := sendOpsgenie(alertdata, notification, client); err != nil {
+		return fmt.Errorf("issue sending Opsgenie alert: %s", err.Error())
+	}
+	if notification.Resolved {
+		logger.Println("Opsgenie alert closed for opsgenie alerter: ", alertdata.Name)
+	} else {
+		logger.Println("Opsgenie alert created for opsgenie alerter: ", alertdata.Name)
+	}
+	return nil
+}
+
+func sendOpsgenie(alertdata types.OpsgenieAlerterConfig, notification types.Notification, client *http.Client) error {
+	alias := opsgenieAlias(notification)
+	var endpoint string
+	var body interface{}
+	if notification.Resolved {
+		endpoint = fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", opsgenieBaseURL(alertdata), url.PathEscape(alias))
+		body = OpsgenieCloseDetails{Source: "k8eraid", Note: notification.Message}
+	} else {
+		endpoint = opsgenieBaseURL(alertdata) + "/v2/alerts"
+		body = OpsgenieInput(alertdata, notification)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+os.Getenv(alertdata.APIKeyEnvVar))
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// Opsgenie processes requests asynchronously and answers 202 Accepted
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("HTTP Status Code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OpsgenieInput generates the body of a request creating an Opsgenie alert
+func OpsgenieInput(alertdata types.OpsgenieAlerterConfig, notification types.Notification) OpsgenieAlertDetails {
+	message := strings.SplitN(notification.Message, "\n", 2)[0]
+	if len(message) > opsgenieMaxMessage {
+		message = message[:opsgenieMaxMessage-3] + "..."
+	}
+
+	priority, ok := alertdata.Priorities[notification.Severity]
+	if !ok {
+		if priority, ok = defaultOpsgeniePriorities[notification.Severity]; !ok {
+			priority = defaultOpsgeniePriorities[types.SeverityWarning]
+		}
+	}
+
+	details := OpsgenieAlertDetails{
+		Message:     message,
+		Alias:       opsgenieAlias(notification),
+		Description: notification.Message,
+		Responders:  alertdata.Responders,
+		Tags:        alertdata.Tags,
+		Source:      "k8eraid",
+		Priority:    priority,
+	}
+	// An alert sent by itself describes one object, a group may span many
+	if len(notification.Alerts) == 1 {
+		alert := notification.Alerts[0]
+		details.Details = alert.LabelSet()
+		details.Entity = alert.Kind + "/" + alert.Name
+		if alert.Namespace != "" {
+			details.Entity = fmt.Sprintf("%s/%s/%s", alert.Kind, alert.Namespace, alert.Name)
+		}
+	}
+	return details
+}
+
+func opsgenieAlias(notification types.Notification) string {
+	return "k8eraid-" + notification.Key
+}
+
+func opsgenieBaseURL(alertdata types.OpsgenieAlerterConfig) string {
+	if alertdata.BaseURL != "" {
+		return strings.TrimSuffix(alertdata.BaseURL, "/")
+	}
+	if strings.ToLower(alertdata.Region) == "eu" {
+		return opsgenieEUURL
+	}
+	return opsgenieUSURL
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type opsgenieRequest struct {
+	path          string
+	query         string
+	authorization string
+	body          map[string]interface{}
+}
+
+func withOpsgenieServer(t *testing.T, f func(requests *[]opsgenieRequest, url string)) {
+	requests := []opsgenieRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body), "request body should be JSON")
+		requests = append(requests, opsgenieRequest{
+			path:          r.URL.Path,
+			query:         r.URL.RawQuery,
+			authorization: r.Header.Get("Authorization"),
+			body:          body,
+		})
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	f(&requests, server.URL)
+}
+
+func Test_AlertOpsgenie_create_and_close(t *testing.T) {
+	os.Setenv("TEST_OPSGENIE_KEY", "test-key")
+	defer os.Unsetenv("TEST_OPSGENIE_KEY")
+
+	alert := types.Alert{Check: "MinReplicas", Severity: types.SeverityCritical, Kind: "Deployment", Namespace: "default", Name: "web"}
+	notification := types.Notification{
+		AlerterType: "opsgenie",
+		Key:         "0123456789abcdef",
+		Message:     "Deployment web in namespace default is under minimum replicas!",
+		Severity:    types.SeverityCritical,
+		Alerts:      []types.Alert{alert},
+	}
+	withOpsgenieServer(t, func(requests *[]opsgenieRequest, url string) {
+		config := types.OpsgenieAlerterConfig{
+			Name:         "test",
+			APIKeyEnvVar: "TEST_OPSGENIE_KEY",
+			BaseURL:      url,
+			Priorities:   map[string]string{types.SeverityCritical: "P2"},
+			Responders:   []types.OpsgenieResponder{{Type: "team", Name: "platform"}},
+		}
+		require.NoError(t, AlertOpsgenie(context.Background(), config, notification))
+		notification.Resolved = true
+		require.NoError(t, AlertOpsgenie(context.Background(), config, notification))
+
+		require.Len(t, *requests, 2, "expected a create and a close request")
+		create := (*requests)[0]
+		assert.Equal(t, "/v2/alerts", create.path)
+		assert.Equal(t, "GenieKey test-key", create.authorization)
+		assert.Equal(t, "k8eraid-0123456789abcdef", create.body["alias"])
+		assert.Equal(t, "P2", create.body["priority"])
+		assert.Equal(t, "Deployment/default/web", create.body["entity"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"type": "team", "name": "platform"}}, create.body["responders"])
+
+		close := (*requests)[1]
+		assert.Equal(t, "/v2/alerts/k8eraid-0123456789abcdef/close", close.path)
+		assert.Equal(t, "identifierType=alias", close.query)
+	})
+}
+
+func Test_opsgenieBaseURL(t *testing.T) {
+	assert.Equal(t, "https://api.opsgenie.com", opsgenieBaseURL(types.OpsgenieAlerterConfig{}))
+	assert.Equal(t, "https://api.eu.opsgenie.com", opsgenieBaseURL(types.OpsgenieAlerterConfig{Region: "EU"}))
+	assert.Equal(t, "http://localhost:8080", opsgenieBaseURL(types.OpsgenieAlerterConfig{Region: "eu", BaseURL: "http://localhost:8080/"}))
+}
@@ -15,6 +15,9 @@
 package alerters
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
 	"net/url"
@@ -25,15 +28,72 @@ import (
 	"github.com/bloomberg/k8eraid/pkgs/types"
 )
 
-// AlertPagerDuty triggers Pager Duty alerts via the v2API using data relayed from alerts.go
-func AlertPagerDuty(alertdata types.PDAlerterConfig, message string) {
-	myEvent, myClient := PagerDutyInput(alertdata, message)
-	resp := PagerDutyTrigger(myEvent, myClient)
-	logger.Print(resp)
+func init() {
+	Register("pagerdutyV2", newPagerDutyAlerter)
 }
 
-// PagerDutyInput generates the formatted alert inputs for triggering a pagerduty alert
-func PagerDutyInput(a types.PDAlerterConfig, m string) (pagerduty.Event, *http.Client) {
+// pagerDutyAlerter is the Alerter for pagerdutyV2 alerters
+type pagerDutyAlerter struct {
+	config types.PDAlerterConfig
+}
+
+func newPagerDutyAlerter(config json.RawMessage) (Alerter, error) {
+	a := &pagerDutyAlerter{}
+	if err := json.Unmarshal(config, &a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *pagerDutyAlerter) Name() string {
+	return a.config.Name
+}
+
+// Validate checks the service key variable is set
+func (a *pagerDutyAlerter) Validate() error {
+	return requireFields("serviceKeyEnvVar", a.config.ServiceKeyEnvVar)
+}
+
+// Send triggers a PagerDuty incident with the notification message
+func (a *pagerDutyAlerter) Send(ctx context.Context, notification types.Notification) error {
+	return AlertPagerDuty(ctx, a.config, notification)
+}
+
+// Resolve resolves the PagerDuty incident for the notification key
+func (a *pagerDutyAlerter) Resolve(ctx context.Context, notification types.Notification) error {
+	return AlertPagerDuty(ctx, a.config, notification)
+}
+
+// createPagerDutyEvent sends events to PagerDuty, replaced in tests
+var createPagerDutyEvent = pagerduty.CreateEventWithHTTPClient
+
+// AlertPagerDuty triggers Pager Duty alerts via the v2API using data relayed from alerts.go, or resolves them once the
+// notification is resolved. Incidents are keyed by the notification key, so PagerDuty deduplicates the repeats of an
+// alert rather than opening new incidents, and the key is the same after a restart.
+func AlertPagerDuty(ctx context.Context, alertdata types.PDAlerterConfig, notification types.Notification) error {
+	myEvent, myClient := PagerDutyInput(alertdata, notification)
+	resp, err := createPagerDutyEvent(myEvent, withDeadline(ctx, myClient))
+	if err != nil {
+		return fmt.Errorf("issue sending PagerDuty alert: %s", err.Error())
+	}
+	if notification.Resolved {
+		logger.Print("Pager Duty incident resolved, key: " + resp.IncidentKey)
+	} else {
+		logger.Print("Pager Duty incident triggered, key: " + resp.IncidentKey)
+	}
+	return nil
+}
+
+// pagerDutyIncidentKey is the incident key for a notification
+func pagerDutyIncidentKey(notification types.Notification) string {
+	if notification.Key == "" {
+		return ""
+	}
+	return "k8eraid-" + notification.Key
+}
+
+// PagerDutyInput generates the formatted alert inputs for triggering, or resolving, a pagerduty alert
+func PagerDutyInput(a types.PDAlerterConfig, notification types.Notification) (pagerduty.Event, *http.Client) {
 	// Get key from ENV that was specified
 	keyenvvar := a.ServiceKeyEnvVar
 	key := os.Getenv(keyenvvar)
@@ -42,14 +102,19 @@ func PagerDutyInput(a types.PDAlerterConfig, m string) (pagerduty.Event, *http.C
 	// Specify alert details
 	D := types.PDAlertDetails{
 		Subject: a.Subject,
-		Message: m,
+		Message: notification.Message,
 		Time:    mytime,
 	}
 
 	// Construct event
+	eventType := "trigger"
+	if notification.Resolved {
+		eventType = "resolve"
+	}
 	event := pagerduty.Event{
-		Type:        "trigger",
+		Type:        eventType,
 		ServiceKey:  key,
+		IncidentKey: pagerDutyIncidentKey(notification),
 		Description: a.Subject,
 		Details:     D,
 	}
@@ -85,13 +150,3 @@ func PagerDutyInput(a types.PDAlerterConfig, m string) (pagerduty.Event, *http.C
 	}
 	return event, myClient
 }
-
-// PagerDutyTrigger triggers a pagerduty alert
-func PagerDutyTrigger(e pagerduty.Event, c *http.Client) string {
-	var err error
-	resp, err := pagerduty.CreateEventWithHTTPClient(e, c)
-	if err != nil {
-		return "Issue sending PagerDuty alert: " + err.Error()
-	}
-	return "Pager Duty incident triggered, key: " + resp.IncidentKey
-}
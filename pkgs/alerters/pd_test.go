@@ -0,0 +1,67 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	pagerduty "github.com/PagerDuty/go-pagerduty"
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withPagerDutyEvents(f func(events *[]pagerduty.Event)) {
+	events := []pagerduty.Event{}
+	createPagerDutyEvent = func(e pagerduty.Event, _ pagerduty.HTTPClient) (*pagerduty.EventResponse, error) {
+		events = append(events, e)
+		return &pagerduty.EventResponse{Status: "success", IncidentKey: e.IncidentKey}, nil
+	}
+	defer func() { createPagerDutyEvent = pagerduty.CreateEventWithHTTPClient }()
+	f(&events)
+}
+
+func Test_pagerDutyAlerter_trigger_and_resolve(t *testing.T) {
+	os.Setenv("TEST_PD_KEY", "test-key")
+	defer os.Unsetenv("TEST_PD_KEY")
+
+	alerter, err := newPagerDutyAlerter([]byte(`{"name": "test", "serviceKeyEnvVar": "TEST_PD_KEY", "subject": "k8eraid alert"}`))
+	require.NoError(t, err)
+	notification := types.Notification{
+		AlerterType: "pagerdutyV2",
+		AlerterName: "test",
+		Key:         "0123456789abcdef",
+		Message:     "Deployment web in namespace default is under minimum replicas!",
+	}
+	withPagerDutyEvents(func(events *[]pagerduty.Event) {
+		// The alert is raised on two polls, then resolves
+		require.NoError(t, alerter.Send(context.Background(), notification))
+		require.NoError(t, alerter.Send(context.Background(), notification))
+		notification.Resolved = true
+		require.NoError(t, alerter.Resolve(context.Background(), notification))
+
+		require.Len(t, *events, 3, "expected two triggers and a resolve")
+		for _, event := range *events {
+			assert.Equal(t, "test-key", event.ServiceKey)
+			assert.Equal(t, "k8eraid-0123456789abcdef", event.IncidentKey, "every event should carry the incident key of the alert")
+		}
+		assert.Equal(t, "trigger", (*events)[0].Type)
+		assert.Equal(t, "trigger", (*events)[1].Type)
+		assert.Equal(t, "resolve", (*events)[2].Type)
+	})
+}
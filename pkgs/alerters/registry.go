@@ -0,0 +1,160 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// Alerter sends notifications to one destination configured in the alerters config
+type Alerter interface {
+	// Name is the name rules refer to the alerter by, with alerterName
+	Name() string
+	// Validate checks the alerter's config, so mistakes are reported when the config is loaded
+	Validate() error
+	// Send sends a firing notification. It must give up and return once ctx is done, so a notification is
+	// never sent twice at once by a retry.
+	Send(ctx context.Context, notification types.Notification) error
+	// Resolve tells the destination an alert or group has resolved. Alerters that can not update what they
+	// sent do nothing.
+	Resolve(ctx context.Context, notification types.Notification) error
+}
+
+// Factory creates an alerter from its config, the JSON of its entry in the alerters config
+type Factory func(config json.RawMessage) (Alerter, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// builtAlerter is an alerter built from a config, kept until its config changes
+type builtAlerter struct {
+	raw     string
+	alerter Alerter
+}
+
+var (
+	builtMu sync.Mutex
+	built   = map[string]builtAlerter{}
+)
+
+// Register makes an alerter type available to the alerters config. The alerters of this package register
+// themselves from init functions, as can alerters in other packages compiled into k8eraid. It panics if the
+// type is already registered.
+func Register(alerterType string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[alerterType]; ok {
+		panic("alerter type " + alerterType + " is already registered")
+	}
+	registry[alerterType] = factory
+}
+
+// RegisteredTypes lists the registered alerter types, sorted
+func RegisteredTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	alerterTypes := make([]string, 0, len(registry))
+	for alerterType := range registry {
+		alerterTypes = append(alerterTypes, alerterType)
+	}
+	sort.Strings(alerterTypes)
+	return alerterTypes
+}
+
+// New creates the alerter for a config with the factory registered for its type, and validates it
+func New(config types.AlerterConfig) (Alerter, error) {
+	registryMu.RLock()
+	factory, ok := registry[config.Type]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("alerter %s has unknown type %s", config.Name, config.Type)
+	}
+	alerter, err := factory(config.Raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s alerter %s: %s", config.Type, config.Name, err.Error())
+	}
+	if err := alerter.Validate(); err != nil {
+		return nil, fmt.Errorf("%s alerter %s: %s", config.Type, config.Name, err.Error())
+	}
+	return alerter, nil
+}
+
+// Find returns the alerter of alerterType named alerterName. stderr alerters need no config, so one is returned for
+// any name that is not configured.
+func Find(config types.AlertersConfig, alerterType string, alerterName string) (Alerter, error) {
+	for _, alerterConfig := range config.Types.Configs {
+		if alerterConfig.Type == alerterType && alerterConfig.Name == alerterName {
+			return build(alerterConfig)
+		}
+	}
+	if alerterType == "stderr" {
+		return &stderrAlerter{name: alerterName}, nil
+	}
+	return nil, fmt.Errorf("no %s alerter named %s", alerterType, alerterName)
+}
+
+// build returns the alerter for a config, creating it only the first time the config is seen, so alerters are
+// created once for each config loaded rather than for every notification
+func build(config types.AlerterConfig) (Alerter, error) {
+	key := config.Type + "/" + config.Name
+	builtMu.Lock()
+	defer builtMu.Unlock()
+	if b, ok := built[key]; ok && b.raw == string(config.Raw) {
+		return b.alerter, nil
+	}
+	alerter, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+	built[key] = builtAlerter{raw: string(config.Raw), alerter: alerter}
+	return alerter, nil
+}
+
+// Validate creates every alerter in config, so mistakes are reported when the config is loaded
+func Validate(config types.AlertersConfig) error {
+	seen := map[string]bool{}
+	for _, alerterConfig := range config.Types.Configs {
+		if alerterConfig.Name == "" {
+			return fmt.Errorf("%s alerter has no name", alerterConfig.Type)
+		}
+		key := alerterConfig.Type + "/" + alerterConfig.Name
+		if seen[key] {
+			return fmt.Errorf("more than one %s alerter named %s", alerterConfig.Type, alerterConfig.Name)
+		}
+		seen[key] = true
+		if _, err := build(alerterConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requireFields returns an error naming the first of fields, pairs of JSON name and value, to be empty
+func requireFields(fields ...string) error {
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] == "" {
+			return fmt.Errorf("%s is not set", fields[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingAlerter records the notifications it is given
+type recordingAlerter struct {
+	name     string
+	sent     []types.Notification
+	resolved []types.Notification
+}
+
+var recording = &recordingAlerter{}
+
+func init() {
+	Register("test", func(config json.RawMessage) (Alerter, error) {
+		var c struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(config, &c); err != nil {
+			return nil, err
+		}
+		recording.name = c.Name
+		return recording, nil
+	})
+}
+
+func (a *recordingAlerter) Name() string    { return a.name }
+func (a *recordingAlerter) Validate() error { return nil }
+func (a *recordingAlerter) Send(_ context.Context, n types.Notification) error {
+	a.sent = append(a.sent, n)
+	return nil
+}
+func (a *recordingAlerter) Resolve(_ context.Context, n types.Notification) error {
+	a.resolved = append(a.resolved, n)
+	return nil
+}
+
+func Test_AlertersConfig_list_form(t *testing.T) {
+	data := `{
+		"alerters": [
+			{"type": "webhook", "name": "hook", "server": "https://hooks.example.com", "method": "PUT"},
+			{"type": "exec", "name": "plugin", "command": "/bin/true"},
+			{"type": "test", "name": "recorder"}
+		],
+		"grouping": [{"alerterType": "webhook", "alerterName": "hook", "groupBy": ["namespace"]}]
+	}`
+	var config types.AlertersConfig
+	require.NoError(t, json.Unmarshal([]byte(data), &config))
+	require.NoError(t, Validate(config))
+	assert.Len(t, config.Grouping, 1)
+
+	alerter, err := Find(config, "webhook", "hook")
+	require.NoError(t, err)
+	assert.Equal(t, "hook", alerter.Name())
+	assert.Equal(t, "PUT", alerter.(*webhookAlerter).config.Method)
+
+	_, err = Find(config, "webhook", "plugin")
+	assert.Error(t, err, "alerters should be found by type and name")
+
+	recording.sent, recording.resolved = nil, nil
+	notification := types.Notification{AlerterType: "test", AlerterName: "recorder", Message: "Pod web is failing checks"}
+	require.NoError(t, Alert(context.Background(), notification, config))
+	notification.Resolved = true
+	require.NoError(t, Alert(context.Background(), notification, config))
+	assert.Len(t, recording.sent, 1)
+	assert.Len(t, recording.resolved, 1)
+
+	// The list form is written back as it was read
+	encoded, err := json.Marshal(config)
+	require.NoError(t, err)
+	var decoded types.AlertersConfig
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	require.Len(t, decoded.Types.Configs, 3)
+	for i, alerterConfig := range decoded.Types.Configs {
+		assert.Equal(t, config.Types.Configs[i].Type, alerterConfig.Type)
+		assert.Equal(t, config.Types.Configs[i].Name, alerterConfig.Name)
+		assert.JSONEq(t, string(config.Types.Configs[i].Raw), string(alerterConfig.Raw))
+	}
+}
+
+func Test_AlertersConfig_type_lists(t *testing.T) {
+	_, config := types.StubsInit()
+	require.NoError(t, Validate(config), "the example alerters should be valid")
+
+	alerter, err := Find(config, "smtp", "example-email")
+	require.NoError(t, err)
+	assert.Equal(t, "example-email", alerter.Name())
+	alerter, err = Find(config, "exec", "example-exec")
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/local/bin/notify-chat", alerter.(*execAlerter).config.Command)
+
+	assert.Error(t, Alert(context.Background(), types.Notification{AlerterType: "smtp", AlerterName: "missing"}, config),
+		"a notification for an alerter that is not configured should fail")
+}
+
+func Test_AlertersConfig_type_lists_decoded_by_registry(t *testing.T) {
+	// Types with a list each are read into the same configs as the list form, including types registered outside
+	// the in-tree alerters
+	data := `{"alerters": {"test": [{"name": "recorder"}], "exec": [{"name": "plugin", "command": "/bin/true"}]}}`
+	var config types.AlertersConfig
+	require.NoError(t, json.Unmarshal([]byte(data), &config))
+	require.NoError(t, Validate(config))
+	require.Len(t, config.Types.Configs, 2)
+	alerter, err := Find(config, "test", "recorder")
+	require.NoError(t, err)
+	assert.Equal(t, "recorder", alerter.Name())
+	alerter, err = Find(config, "exec", "plugin")
+	require.NoError(t, err)
+	assert.Equal(t, "/bin/true", alerter.(*execAlerter).config.Command)
+}
+
+func Test_Find_builds_alerters_once(t *testing.T) {
+	_, config := types.StubsInit()
+	first, err := Find(config, "smtp", "example-email")
+	require.NoError(t, err)
+	second, err := Find(config, "smtp", "example-email")
+	require.NoError(t, err)
+	assert.True(t, first == second, "an alerter should be built once for its config, not for every notification")
+
+	changed, err := types.NewAlerterConfig("smtp", types.SMTPAlerterConfig{
+		Name:        "example-email",
+		ToAddress:   "kubernetes@example.net",
+		FromAddress: "kubernetes@example.net",
+		MailServer:  "smtp.example.com",
+		Subject:     "Changed subject",
+	})
+	require.NoError(t, err)
+	config.Types.Configs = []types.AlerterConfig{changed}
+	third, err := Find(config, "smtp", "example-email")
+	require.NoError(t, err)
+	assert.False(t, first == third, "an alerter should be built again once its config changes")
+	assert.Equal(t, "Changed subject", third.(*smtpAlerter).config.Subject)
+}
+
+func Test_stderr_alerter(t *testing.T) {
+	assert.Contains(t, RegisteredTypes(), "stderr")
+	alerter, err := Find(types.AlertersConfig{}, "stderr", "")
+	require.NoError(t, err, "stderr alerters should need no config")
+	assert.NoError(t, alerter.Send(context.Background(), types.Notification{Message: "Pod web is failing checks"}))
+
+	var config types.AlertersConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"alerters": [{"type": "stderr", "name": "console"}]}`), &config))
+	require.NoError(t, Validate(config))
+	alerter, err = Find(config, "stderr", "console")
+	require.NoError(t, err)
+	assert.Equal(t, "console", alerter.Name())
+}
+
+func Test_Validate_errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"unknown type", `[{"type": "carrier-pigeon", "name": "coo"}]`},
+		{"missing field", `[{"type": "smtp", "name": "mail", "fromAddress": "k8eraid@example.com"}]`},
+		{"invalid template", `[{"type": "webhook", "name": "hook", "server": "https://hooks.example.com", "bodyTemplate": "{{ .Message"}]`},
+		{"no name", `[{"type": "exec", "command": "/bin/true"}]`},
+		{"duplicate name", `[{"type": "exec", "name": "a", "command": "/bin/true"}, {"type": "exec", "name": "a", "command": "/bin/false"}]`},
+	}
+	for _, test := range tests {
+		var config types.AlertersConfig
+		require.NoError(t, json.Unmarshal([]byte(`{"alerters": `+test.config+`}`), &config), test.name)
+		assert.Error(t, Validate(config), test.name)
+	}
+
+	var config types.AlertersConfig
+	assert.Error(t, json.Unmarshal([]byte(`{"alerters": [{"name": "untyped"}]}`), &config), "alerters in the list form need a type")
+}
+
+func Test_Register_duplicate(t *testing.T) {
+	assert.Panics(t, func() { Register("smtp", newSMTPAlerter) })
+	assert.Contains(t, RegisteredTypes(), "exec")
+}
+
+func Test_AlertExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k8eraid-exec")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "notification.json")
+
+	notification := types.Notification{
+		AlerterType: "exec",
+		AlerterName: "plugin",
+		Message:     "Pod web is failing checks",
+		Alerts:      []types.Alert{{Check: "PodFailures", Kind: "Pod", Namespace: "default", Name: "web"}},
+	}
+	config := types.ExecAlerterConfig{Name: "plugin", Command: "sh", Args: []string{"-c", `cat > "$0"`, out}}
+	require.NoError(t, AlertExec(context.Background(), config, notification))
+
+	data, err := ioutil.ReadFile(out)
+	require.NoError(t, err)
+	var received types.Notification
+	require.NoError(t, json.Unmarshal(data, &received))
+	assert.Equal(t, notification, received)
+
+	config.Args = []string{"-c", "echo no route to chat >&2; exit 3"}
+	err = AlertExec(context.Background(), config, notification)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no route to chat")
+}
@@ -15,12 +15,14 @@
 package alerters
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"net"
 	"net/http"
-	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/bloomberg/k8eraid/pkgs/types"
@@ -28,38 +30,310 @@ import (
 	"github.com/nlopes/slack"
 )
 
+// Defaults for slack alerters posting with a bot token
+const (
+	defaultSlackAPIURL        = "https://slack.com/api"
+	defaultSlackReplyInterval = time.Hour
+	slackResolvedColor        = "#2eb886"
+)
+
+// slackAckCallbackID identifies the acknowledgement buttons in the action requests Slack sends to k8eraid
+const slackAckCallbackID = "k8eraid_ack"
+
+// slackSeverityColors are the attachment colors of bot messages by severity
+var slackSeverityColors = map[string]string{
+	types.SeverityCritical: "#ff0000",
+	types.SeverityWarning:  "#daa038",
+	types.SeverityInfo:     "#439fe0",
+}
+
+// slackThread is the message a bot posted for an alert, which later notifications reply to and edit
+type slackThread struct {
+	channel    string
+	ts         string
+	attachment slack.Attachment
+	// the last message posted in the thread, and when, so alerts raised on every poll are not replied to
+	// every poll
+	lastMessage string
+	lastPosted  time.Time
+}
+
+// slackThreads are the threads of alerts still firing, by alerter name and notification key. They are kept in
+// memory, so alerts firing across a restart start a new thread.
+var (
+	slackThreadsMu sync.Mutex
+	slackThreads   = map[string]*slackThread{}
+)
+
+// slackChatMessage is the body of chat.postMessage and chat.update calls
+type slackChatMessage struct {
+	Channel     string             `json:"channel"`
+	Text        string             `json:"text,omitempty"`
+	TS          string             `json:"ts,omitempty"`
+	ThreadTS    string             `json:"thread_ts,omitempty"`
+	Attachments []slack.Attachment `json:"attachments,omitempty"`
+}
+
+// slackAPIResponse is the part of Slack Web API responses k8eraid uses
+type slackAPIResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+func init() {
+	Register("slack", newSlackAlerter)
+}
+
+// slackAlerter is the Alerter for slack alerters
+type slackAlerter struct {
+	config types.SlackAlerterConfig
+}
+
+func newSlackAlerter(config json.RawMessage) (Alerter, error) {
+	a := &slackAlerter{}
+	if err := json.Unmarshal(config, &a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *slackAlerter) Name() string {
+	return a.config.Name
+}
+
+// Validate checks a webhook URL is set, or a bot token variable and a channel
+func (a *slackAlerter) Validate() error {
+	if a.config.BotTokenEnvVar != "" {
+		return requireFields("channel", a.config.Channel)
+	}
+	return requireFields("webhookURL", a.config.WebhookURL)
+}
+
+// Send posts the notification to Slack, with the bot if there is a token or else to the webhook
+func (a *slackAlerter) Send(ctx context.Context, notification types.Notification) error {
+	if a.config.BotTokenEnvVar != "" {
+		return AlertSlackBot(ctx, a.config, notification)
+	}
+	return AlertSlack(ctx, a.config, notification.Message)
+}
+
+// Resolve marks the bot's message for the alert resolved. Webhook messages can not be updated.
+func (a *slackAlerter) Resolve(ctx context.Context, notification types.Notification) error {
+	if a.config.BotTokenEnvVar != "" {
+		return AlertSlackBot(ctx, a.config, notification)
+	}
+	return nil
+}
+
 // AlertSlack sends an alert to slack
-func AlertSlack(alertData types.SlackAlerterConfig, message string) {
-	msg := SlackInput(message)
-	origTransport := http.DefaultTransport
-	if alertData.ProxyServer != "" {
-		// we need to override the default transport to apply proxy settings
-		proxyURL, err := url.Parse(alertData.ProxyServer)
+func AlertSlack(ctx context.Context, alertData types.SlackAlerterConfig, message string) error {
+	client, err := newHTTPClient(ctx, alertData.ProxyServer)
+	if err != nil {
+		return fmt.Errorf("alert configuration %s: %s", alertData.Name, err.Error())
+	}
+	data, err := json.Marshal(SlackInput(message))
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(alertData.WebhookURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error sending alert to Slack: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error sending alert to Slack: HTTP Status Code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// AlertSlackBot posts a notification with a bot. The first notification for an alert is posted to its channel,
+// later ones with a new message, or after the reply interval, are replied in its thread, and once it resolves
+// the first message is edited to show it resolved.
+func AlertSlackBot(ctx context.Context, alertdata types.SlackAlerterConfig, notification types.Notification) error {
+	token := os.Getenv(alertdata.BotTokenEnvVar)
+	if token == "" {
+		return fmt.Errorf("alert configuration %s: no bot token in %s", alertdata.Name, alertdata.BotTokenEnvVar)
+	}
+	client, err := newHTTPClient(ctx, alertdata.ProxyServer)
+	if err != nil {
+		return fmt.Errorf("alert configuration %s: %s", alertdata.Name, err.Error())
+	}
+	post := func(method string, msg slackChatMessage) (slackAPIResponse, error) {
+		return callSlackAPI(client, alertdata.APIURL, token, method, msg)
+	}
+	now := time.Now()
+
+	threadKey := alertdata.Name + "/" + notification.Key
+	slackThreadsMu.Lock()
+	thread := slackThreads[threadKey]
+	slackThreadsMu.Unlock()
+
+	if notification.Resolved {
+		if thread == nil {
+			// Nothing was posted for the alert since k8eraid started
+			return nil
+		}
+		resolved := withoutSlackAckButtons(thread.attachment)
+		resolved.Color = slackResolvedColor
+		resolved.Title = "RESOLVED: " + resolved.Title
+		if _, err := post("chat.update", slackChatMessage{Channel: thread.channel, TS: thread.ts, Attachments: []slack.Attachment{resolved}}); err != nil {
+			return err
+		}
+		text := notification.Message
+		if !strings.HasPrefix(text, "Resolved") {
+			text = "Resolved: " + text
+		}
+		if _, err := post("chat.postMessage", slackChatMessage{Channel: thread.channel, ThreadTS: thread.ts, Text: text}); err != nil {
+			return err
+		}
+		slackThreadsMu.Lock()
+		delete(slackThreads, threadKey)
+		slackThreadsMu.Unlock()
+		logger.Println("Slack message resolved for slack alerter: ", alertdata.Name)
+		return nil
+	}
+
+	if thread == nil {
+		attachment := SlackBotInput(notification, now)
+		if alertdata.AckButtons && notification.Key != "" {
+			attachment = withSlackAckButtons(attachment, notification.Key)
+		}
+		resp, err := post("chat.postMessage", slackChatMessage{Channel: slackChannel(alertdata, notification), Attachments: []slack.Attachment{attachment}})
 		if err != nil {
-			log.Printf(
-				"Alert configuration %s has invalid proxy server(%s): %s",
-				alertData.Name,
-				alertData.ProxyServer,
-				err.Error(),
-			)
-			return
+			return err
+		}
+		if notification.Key != "" {
+			slackThreadsMu.Lock()
+			slackThreads[threadKey] = &slackThread{
+				channel:     resp.Channel,
+				ts:          resp.TS,
+				attachment:  attachment,
+				lastMessage: notification.Message,
+				lastPosted:  now,
+			}
+			slackThreadsMu.Unlock()
+		}
+		logger.Println("Slack message posted for slack alerter: ", alertdata.Name)
+		return nil
+	}
+
+	replyInterval := defaultSlackReplyInterval
+	if alertdata.ReplyInterval > 0 {
+		replyInterval = time.Duration(alertdata.ReplyInterval) * time.Second
+	}
+	if notification.Message == thread.lastMessage && now.Sub(thread.lastPosted) < replyInterval {
+		return nil
+	}
+	if _, err := post("chat.postMessage", slackChatMessage{Channel: thread.channel, ThreadTS: thread.ts, Text: notification.Message}); err != nil {
+		return err
+	}
+	slackThreadsMu.Lock()
+	thread.lastMessage = notification.Message
+	thread.lastPosted = now
+	slackThreadsMu.Unlock()
+	logger.Println("Slack thread reply posted for slack alerter: ", alertdata.Name)
+	return nil
+}
+
+// SlackBotInput formats a notification as the attachment of a bot message, colored by severity, with buttons
+// linking to the runbook and dashboard
+func SlackBotInput(notification types.Notification, now time.Time) slack.Attachment {
+	color, ok := slackSeverityColors[notification.Severity]
+	if !ok {
+		color = slackSeverityColors[types.SeverityWarning]
+	}
+	title := "k8eraid alert"
+	if notification.Severity != "" {
+		title = fmt.Sprintf("[%s] %s", strings.ToUpper(notification.Severity), title)
+	}
+	attachment := slack.Attachment{
+		Fallback:   notification.Message,
+		Color:      color,
+		AuthorName: "k8eraid",
+		Title:      title,
+		Text:       notification.Message,
+		Ts:         json.Number(fmt.Sprint(now.Unix())),
+	}
+	if url := firstAlertLink(notification.Alerts, func(a types.Alert) string { return a.RunbookURL }); url != "" {
+		attachment.Actions = append(attachment.Actions, slack.AttachmentAction{Type: "button", Text: "Runbook", URL: url})
+	}
+	if url := firstAlertLink(notification.Alerts, func(a types.Alert) string { return a.DashboardURL }); url != "" {
+		attachment.Actions = append(attachment.Actions, slack.AttachmentAction{Type: "button", Text: "Dashboard", URL: url})
+	}
+	return attachment
+}
+
+// withSlackAckButtons adds buttons acknowledging the alert with fingerprint, which Slack sends to k8eraid's
+// /ack/slack endpoint. The names of the buttons are the actions the endpoint knows.
+func withSlackAckButtons(attachment slack.Attachment, fingerprint string) slack.Attachment {
+	attachment.CallbackID = slackAckCallbackID
+	attachment.Actions = append(attachment.Actions,
+		slack.AttachmentAction{Name: "ack", Type: "button", Text: "Ack 1h", Value: fingerprint},
+		slack.AttachmentAction{Name: "silence", Type: "button", Text: "Silence 24h", Value: fingerprint, Style: "danger"},
+	)
+	return attachment
+}
+
+// withoutSlackAckButtons removes the acknowledgement buttons, keeping the links
+func withoutSlackAckButtons(attachment slack.Attachment) slack.Attachment {
+	actions := []slack.AttachmentAction{}
+	for _, action := range attachment.Actions {
+		if action.URL != "" {
+			actions = append(actions, action)
 		}
-		http.DefaultTransport = &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-			DialContext: (&net.Dialer{
-				Timeout:   10 * time.Second,
-				KeepAlive: 10 * time.Second,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       10 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
+	}
+	attachment.Actions = actions
+	attachment.CallbackID = ""
+	return attachment
+}
+
+// slackChannel is the channel for the rule of any of the alerts, or else for the notification severity, or
+// else the alerter channel
+func slackChannel(alertdata types.SlackAlerterConfig, notification types.Notification) string {
+	for _, alert := range notification.Alerts {
+		if channel, ok := alertdata.RuleChannels[alert.Rule]; ok {
+			return channel
 		}
 	}
-	if err := slack.PostWebhook(alertData.WebhookURL, msg); err != nil {
-		log.Printf("Error sending alert to Slack: %s", err.Error())
+	if channel, ok := alertdata.SeverityChannels[notification.Severity]; ok {
+		return channel
+	}
+	return alertdata.Channel
+}
+
+// callSlackAPI calls a Slack Web API method, returning an error if the call fails or Slack says it was not ok
+func callSlackAPI(client *http.Client, apiURL string, token string, method string, msg slackChatMessage) (slackAPIResponse, error) {
+	if apiURL == "" {
+		apiURL = defaultSlackAPIURL
+	}
+	var result slackAPIResponse
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return result, err
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(apiURL, "/")+"/"+method, bytes.NewReader(data))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return result, fmt.Errorf("error calling Slack %s: %s", method, err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("error calling Slack %s: HTTP Status Code: %d", method, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("error calling Slack %s: %s", method, err.Error())
+	}
+	if !result.OK {
+		return result, fmt.Errorf("error calling Slack %s: %s", method, result.Error)
 	}
-	http.DefaultTransport = origTransport
+	return result, nil
 }
 
 // SlackInput formats an alert for Slack
@@ -16,10 +16,14 @@ package alerters
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -33,7 +37,7 @@ const expected = `{"attachments":[{"color":"#ff0000","fallback":"foo","author_na
 
 func Test_AlertSlack_OK(t *testing.T) {
 	withWebhookServer(t, false, func(buf *bytes.Buffer, url string) {
-		AlertSlack(types.SlackAlerterConfig{WebhookURL: url}, "foo")
+		assert.NoError(t, AlertSlack(context.Background(), types.SlackAlerterConfig{WebhookURL: url}, "foo"))
 		assert.Equal(t, fmt.Sprintf(expected, time.Now().Unix()), string(buf.Bytes()), "Expected request data should match actual")
 	})
 }
@@ -49,3 +53,177 @@ func withWebhookServer(t *testing.T, fail bool, f func(buf *bytes.Buffer, url st
 	defer server.Close()
 	f(buf, server.URL)
 }
+
+type slackCall struct {
+	method string
+	msg    slackChatMessage
+}
+
+// withSlackAPI runs f against a fake Slack Web API, returning the calls made to it
+func withSlackAPI(t *testing.T, f func(url string)) []slackCall {
+	calls := []slackCall{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer xoxb-test", r.Header.Get("Authorization"))
+		var msg slackChatMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		calls = append(calls, slackCall{method: strings.TrimPrefix(r.URL.Path, "/"), msg: msg})
+		if msg.Channel == "#missing" {
+			w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok": true, "channel": "C0123", "ts": "1559390400.000100"}`))
+	}))
+	defer server.Close()
+	f(server.URL)
+	return calls
+}
+
+func Test_AlertSlackBot_thread_and_resolve(t *testing.T) {
+	os.Setenv("TEST_SLACK_TOKEN", "xoxb-test")
+	defer os.Unsetenv("TEST_SLACK_TOKEN")
+
+	notification := types.Notification{
+		AlerterType: "slack",
+		AlerterName: "bot",
+		Key:         "0123456789abcdef",
+		Message:     "Deployment web is under minimum replicas!",
+		Severity:    types.SeverityCritical,
+		Alerts: []types.Alert{{
+			Rule: "deployments/web", Check: "MinReplicas", Severity: types.SeverityCritical,
+			Kind: "Deployment", Namespace: "default", Name: "web", RunbookURL: "https://runbooks.example.com/web",
+		}},
+	}
+	calls := withSlackAPI(t, func(url string) {
+		alertdata := types.SlackAlerterConfig{
+			Name:             "bot",
+			BotTokenEnvVar:   "TEST_SLACK_TOKEN",
+			Channel:          "#alerts",
+			SeverityChannels: map[string]string{types.SeverityCritical: "#oncall"},
+			RuleChannels:     map[string]string{"deployments/web": "#web-team"},
+			APIURL:           url,
+		}
+		alerter, err := New(types.AlerterConfig{Type: "slack", Name: "bot", Raw: mustJSON(t, alertdata)})
+		require.NoError(t, err)
+
+		require.NoError(t, alerter.Send(context.Background(), notification))
+		// The same message again is not replied to within the reply interval
+		require.NoError(t, alerter.Send(context.Background(), notification))
+		changed := notification
+		changed.Message = "Deployment web has no available replicas!"
+		require.NoError(t, alerter.Send(context.Background(), changed))
+		resolved := notification
+		resolved.Resolved = true
+		require.NoError(t, alerter.Resolve(context.Background(), resolved))
+		// A second resolve has nothing left to update
+		require.NoError(t, alerter.Resolve(context.Background(), resolved))
+	})
+
+	require.Len(t, calls, 4)
+	assert.Equal(t, "chat.postMessage", calls[0].method)
+	assert.Equal(t, "#web-team", calls[0].msg.Channel, "the rule channel should come first")
+	require.Len(t, calls[0].msg.Attachments, 1)
+	assert.Equal(t, "#ff0000", calls[0].msg.Attachments[0].Color)
+	assert.Equal(t, "[CRITICAL] k8eraid alert", calls[0].msg.Attachments[0].Title)
+	require.Len(t, calls[0].msg.Attachments[0].Actions, 1)
+	assert.Equal(t, "https://runbooks.example.com/web", calls[0].msg.Attachments[0].Actions[0].URL)
+
+	assert.Equal(t, "chat.postMessage", calls[1].method)
+	assert.Equal(t, "C0123", calls[1].msg.Channel)
+	assert.Equal(t, "1559390400.000100", calls[1].msg.ThreadTS)
+	assert.Equal(t, "Deployment web has no available replicas!", calls[1].msg.Text)
+
+	assert.Equal(t, "chat.update", calls[2].method)
+	assert.Equal(t, "1559390400.000100", calls[2].msg.TS)
+	require.Len(t, calls[2].msg.Attachments, 1)
+	assert.Equal(t, "#2eb886", calls[2].msg.Attachments[0].Color)
+	assert.Equal(t, "RESOLVED: [CRITICAL] k8eraid alert", calls[2].msg.Attachments[0].Title)
+
+	assert.Equal(t, "chat.postMessage", calls[3].method)
+	assert.Equal(t, "1559390400.000100", calls[3].msg.ThreadTS)
+	assert.Equal(t, "Resolved: Deployment web is under minimum replicas!", calls[3].msg.Text)
+}
+
+func Test_AlertSlackBot_ack_buttons(t *testing.T) {
+	os.Setenv("TEST_SLACK_TOKEN", "xoxb-test")
+	defer os.Unsetenv("TEST_SLACK_TOKEN")
+
+	notification := types.Notification{
+		Key:     "0123456789abcdef",
+		Message: "Pod web is failing checks",
+		Alerts:  []types.Alert{{DashboardURL: "https://grafana.example.com/d/web"}},
+	}
+	calls := withSlackAPI(t, func(url string) {
+		alertdata := types.SlackAlerterConfig{Name: "ack-buttons", BotTokenEnvVar: "TEST_SLACK_TOKEN", Channel: "#alerts", APIURL: url, AckButtons: true}
+		require.NoError(t, AlertSlackBot(context.Background(), alertdata, notification))
+		resolved := notification
+		resolved.Resolved = true
+		require.NoError(t, AlertSlackBot(context.Background(), alertdata, resolved))
+	})
+
+	require.Len(t, calls, 3)
+	posted := calls[0].msg.Attachments[0]
+	assert.Equal(t, "k8eraid_ack", posted.CallbackID)
+	require.Len(t, posted.Actions, 3)
+	assert.Equal(t, "Dashboard", posted.Actions[0].Text)
+	assert.Equal(t, "ack", posted.Actions[1].Name)
+	assert.Equal(t, "Ack 1h", posted.Actions[1].Text)
+	assert.Equal(t, "0123456789abcdef", posted.Actions[1].Value)
+	assert.Equal(t, "silence", posted.Actions[2].Name)
+	assert.Equal(t, "Silence 24h", posted.Actions[2].Text)
+
+	updated := calls[1].msg.Attachments[0]
+	assert.Empty(t, updated.CallbackID)
+	require.Len(t, updated.Actions, 1, "a resolved alert can no longer be acknowledged")
+	assert.Equal(t, "Dashboard", updated.Actions[0].Text)
+}
+
+func Test_AlertSlackBot_errors(t *testing.T) {
+	os.Setenv("TEST_SLACK_TOKEN", "xoxb-test")
+	defer os.Unsetenv("TEST_SLACK_TOKEN")
+
+	withSlackAPI(t, func(url string) {
+		alertdata := types.SlackAlerterConfig{Name: "bot", BotTokenEnvVar: "TEST_SLACK_TOKEN", Channel: "#missing", APIURL: url}
+		err := AlertSlackBot(context.Background(), alertdata, types.Notification{Key: "fedcba9876543210", Message: "Pod web is failing checks"})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "channel_not_found")
+
+		alertdata.BotTokenEnvVar = "TEST_SLACK_UNSET_TOKEN"
+		assert.Error(t, AlertSlackBot(context.Background(), alertdata, types.Notification{Message: "Pod web is failing checks"}))
+	})
+}
+
+func Test_slackChannel(t *testing.T) {
+	alertdata := types.SlackAlerterConfig{
+		Channel:          "#alerts",
+		SeverityChannels: map[string]string{types.SeverityCritical: "#oncall"},
+		RuleChannels:     map[string]string{"pods/*": "#pods"},
+	}
+	tests := []struct {
+		rule     string
+		severity string
+		expected string
+	}{
+		{"pods/*", types.SeverityCritical, "#pods"},
+		{"nodes/*", types.SeverityCritical, "#oncall"},
+		{"nodes/*", types.SeverityWarning, "#alerts"},
+	}
+	for _, test := range tests {
+		notification := types.Notification{Severity: test.severity, Alerts: []types.Alert{{Rule: test.rule}}}
+		assert.Equal(t, test.expected, slackChannel(alertdata, notification), test.rule+" "+test.severity)
+	}
+}
+
+func Test_AlertSlack_proxy_leaves_default_transport(t *testing.T) {
+	transport := http.DefaultTransport
+	withWebhookServer(t, false, func(buf *bytes.Buffer, url string) {
+		// The proxy is unreachable, the alert only has to fail without touching the default transport
+		AlertSlack(context.Background(), types.SlackAlerterConfig{WebhookURL: url, ProxyServer: "http://127.0.0.1:1"}, "foo")
+	})
+	assert.True(t, transport == http.DefaultTransport, "http.DefaultTransport should not be replaced")
+}
+
+func mustJSON(t *testing.T, v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return data
+}
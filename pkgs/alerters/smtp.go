@@ -15,35 +15,390 @@
 package alerters
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"os"
 	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
 
 	"github.com/bloomberg/k8eraid/pkgs/types"
 )
 
-// AlertSMTP send SMTP messages using inputs forwarded from alert.go
-func AlertSMTP(alertdata types.SMTPAlerterConfig, message string) {
-	from := alertdata.FromAddress
-	to := alertdata.ToAddress
-	subject := alertdata.Subject
-	pass := os.Getenv(alertdata.PasswordEnvVar)
+// TLS modes of smtp alerters
+const (
+	smtpStartTLS    = "starttls"
+	smtpImplicitTLS = "implicit"
+	smtpNoTLS       = "none"
+)
+
+// Templates for the parts of an email an smtp alerter does not set. Subjects start with the severity.
+const (
+	defaultSubjectTemplate = `{{ if .Severity }}[{{ upper .Severity }}] {{ end }}{{ if .Subject }}{{ .Subject }}{{ else }}k8eraid alert{{ end }}`
+	defaultTextTemplate    = `{{ .Message }}
+{{ range .Alerts }}{{ if or .RunbookURL .DashboardURL }}
+{{ .Kind }} {{ .Name }}:{{ if .RunbookURL }} runbook {{ .RunbookURL }}{{ end }}{{ if .DashboardURL }} dashboard {{ .DashboardURL }}{{ end }}{{ end }}{{ end }}
+
+Sent by k8eraid at {{ .Time.Format "2006-01-02 15:04:05 MST" }}
+`
+	defaultHTMLTemplate = `<html>
+<body>
+{{ if .Severity }}<p><b>{{ upper .Severity }}</b></p>
+{{ end }}<pre>{{ .Message }}</pre>
+{{ if .Alerts }}<table border="1" cellpadding="4" style="border-collapse: collapse">
+<tr><th>Severity</th><th>Kind</th><th>Namespace</th><th>Name</th><th>Check</th><th>Links</th></tr>
+{{ range .Alerts }}<tr><td>{{ .Severity }}</td><td>{{ .Kind }}</td><td>{{ .Namespace }}</td><td>{{ .Name }}</td><td>{{ .Check }}</td><td>{{ if .RunbookURL }}<a href="{{ .RunbookURL }}">Runbook</a> {{ end }}{{ if .DashboardURL }}<a href="{{ .DashboardURL }}">Dashboard</a>{{ end }}</td></tr>
+{{ end }}</table>
+{{ end }}<p>Sent by k8eraid at {{ .Time.Format "2006-01-02 15:04:05 MST" }}</p>
+</body>
+</html>
+`
+)
 
-	port := strconv.Itoa(alertdata.Port)
-	server := alertdata.MailServer + ":" + port
+func init() {
+	Register("smtp", newSMTPAlerter)
+}
+
+// smtpAlerter is the Alerter for smtp alerters
+type smtpAlerter struct {
+	config types.SMTPAlerterConfig
+}
 
-	msg := "From: " + from + "\n" +
-		"To: " + to + "\n" +
-		"Subject: " + subject + "\n\n" +
-		message
+func newSMTPAlerter(config json.RawMessage) (Alerter, error) {
+	a := &smtpAlerter{}
+	if err := json.Unmarshal(config, &a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *smtpAlerter) Name() string {
+	return a.config.Name
+}
+
+// Validate checks the mail server and addresses are set, and the TLS mode and templates are valid
+func (a *smtpAlerter) Validate() error {
+	if err := requireFields("mailServer", a.config.MailServer, "fromAddress", a.config.FromAddress); err != nil {
+		return err
+	}
+	if _, err := mail.ParseAddress(a.config.FromAddress); err != nil {
+		return fmt.Errorf("invalid fromAddress: %s", err.Error())
+	}
+	recipients, err := smtpRecipients(a.config)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients, set toAddress, to, cc or bcc")
+	}
+	switch a.config.TLS {
+	case "", smtpStartTLS, smtpImplicitTLS, smtpNoTLS:
+	default:
+		return fmt.Errorf("unknown tls mode %s", a.config.TLS)
+	}
+	_, _, _, err = smtpTemplates(a.config)
+	return err
+}
+
+// Send emails the notification message
+func (a *smtpAlerter) Send(ctx context.Context, notification types.Notification) error {
+	return AlertSMTP(ctx, a.config, notification)
+}
+
+// Resolve does nothing, as a sent email can not be taken back
+func (a *smtpAlerter) Resolve(context.Context, types.Notification) error {
+	return nil
+}
+
+// AlertSMTP emails a notification as a multipart text and HTML message, to every recipient of the alerter
+func AlertSMTP(ctx context.Context, alertdata types.SMTPAlerterConfig, notification types.Notification) error {
+	recipients, err := smtpRecipients(alertdata)
+	if err != nil {
+		return fmt.Errorf("alert configuration %s: %s", alertdata.Name, err.Error())
+	}
+	msg, err := SMTPInput(alertdata, notification, time.Now())
+	if err != nil {
+		return fmt.Errorf("alert configuration %s: %s", alertdata.Name, err.Error())
+	}
+	if err := sendMail(ctx, alertdata, recipients, msg); err != nil {
+		return fmt.Errorf("smtp error: %s", err.Error())
+	}
+	logger.Print("Alert message sent to ", strings.Join(recipients, ", "))
+	return nil
+}
 
-	err := smtp.SendMail(server,
-		smtp.PlainAuth("", from, pass, alertdata.MailServer),
-		from, []string{to}, []byte(msg))
+// SMTPInput generates the email for a notification: headers, with Date and Message-ID, and a multipart body with
+// the text and HTML templates
+func SMTPInput(alertdata types.SMTPAlerterConfig, notification types.Notification, now time.Time) ([]byte, error) {
+	subjectTemplate, textTemplate, htmlTemplate, err := smtpTemplates(alertdata)
+	if err != nil {
+		return nil, err
+	}
+	data := TemplateData{Notification: notification, Subject: alertdata.Subject, Time: now}
+	var subject, text, html bytes.Buffer
+	if err := subjectTemplate.Execute(&subject, data); err != nil {
+		return nil, fmt.Errorf("unable to execute subject template: %s", err.Error())
+	}
+	if err := textTemplate.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("unable to execute text template: %s", err.Error())
+	}
+	if err := htmlTemplate.Execute(&html, data); err != nil {
+		return nil, fmt.Errorf("unable to execute HTML template: %s", err.Error())
+	}
 
+	from, err := mail.ParseAddress(alertdata.FromAddress)
 	if err != nil {
-		errLogger.Print("smtp error: ", err)
+		return nil, fmt.Errorf("invalid fromAddress: %s", err.Error())
+	}
+	to, err := parseAddresses(append(alertdata.To, splitAddress(alertdata.ToAddress)...))
+	if err != nil {
+		return nil, err
+	}
+	cc, err := parseAddresses(alertdata.CC)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	body := multipart.NewWriter(&msg)
+	header := textproto.MIMEHeader{}
+	header.Set("From", from.String())
+	if len(to) > 0 {
+		header.Set("To", joinAddresses(to))
+	}
+	if len(cc) > 0 {
+		header.Set("Cc", joinAddresses(cc))
+	}
+	// BCC recipients are only given to the server, so they are not shown to the others
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	header.Set("Date", now.Format(time.RFC1123Z))
+	header.Set("Message-ID", messageID(from.Address, now))
+	header.Set("MIME-Version", "1.0")
+	header.Set("Content-Type", "multipart/alternative; boundary="+body.Boundary())
+	for _, name := range []string{"From", "To", "Cc", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"} {
+		if value := header.Get(name); value != "" {
+			fmt.Fprintf(&msg, "%s: %s\r\n", name, value)
+		}
+	}
+	msg.WriteString("\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// sendMail sends msg to recipients, over TLS as the alerter's TLS mode says, logging in if it has a password.
+// The whole conversation with the server must finish by the deadline of ctx.
+func sendMail(ctx context.Context, alertdata types.SMTPAlerterConfig, recipients []string, msg []byte) error {
+	tlsConfig := &tls.Config{
+		ServerName:         alertdata.MailServer,
+		InsecureSkipVerify: alertdata.InsecureSkipVerify,
+	}
+	if alertdata.CAFile != "" {
+		pool, err := loadCAFile(alertdata.CAFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	port := alertdata.Port
+	if port == 0 {
+		port = 25
+		if alertdata.TLS == smtpImplicitTLS {
+			port = 465
+		}
+	}
+	server := net.JoinHostPort(alertdata.MailServer, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		dialer.Deadline = deadline
+	}
+
+	var conn net.Conn
+	var err error
+	if alertdata.TLS == smtpImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", server, tlsConfig)
 	} else {
-		logger.Print("Alert message sent to ", to)
+		conn, err = dialer.Dial("tcp", server)
+	}
+	if err != nil {
+		return err
+	}
+	// net/smtp has no timeouts of its own, so a stalled server would otherwise hold the send forever
+	if hasDeadline {
+		if err := conn.SetDeadline(deadline); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	client, err := smtp.NewClient(conn, alertdata.MailServer)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if alertdata.TLS == "" || alertdata.TLS == smtpStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		} else if alertdata.TLS == smtpStartTLS {
+			return fmt.Errorf("%s does not offer STARTTLS", server)
+		}
+	}
+	// Internal relays often take mail without logging in, so only log in with a password
+	if password := os.Getenv(alertdata.PasswordEnvVar); alertdata.PasswordEnvVar != "" && password != "" {
+		username := alertdata.Username
+		if username == "" {
+			username = alertdata.FromAddress
+		}
+		if err := client.Auth(smtp.PlainAuth("", username, password, alertdata.MailServer)); err != nil {
+			return err
+		}
+	}
+
+	from, err := mail.ParseAddress(alertdata.FromAddress)
+	if err != nil {
+		return err
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// smtpRecipients is the address of every To, CC and BCC recipient, for the server
+func smtpRecipients(alertdata types.SMTPAlerterConfig) ([]string, error) {
+	all := append(append(append(splitAddress(alertdata.ToAddress), alertdata.To...), alertdata.CC...), alertdata.BCC...)
+	addresses, err := parseAddresses(all)
+	if err != nil {
+		return nil, err
+	}
+	recipients := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		recipients = append(recipients, address.Address)
+	}
+	return recipients, nil
+}
+
+// smtpTemplates parses the alerter's templates, or the defaults for those it does not set
+func smtpTemplates(alertdata types.SMTPAlerterConfig) (*texttemplate.Template, *texttemplate.Template, *htmltemplate.Template, error) {
+	subjectSource := defaultSubjectTemplate
+	if alertdata.SubjectTemplate != "" {
+		subjectSource = alertdata.SubjectTemplate
+	}
+	textSource := defaultTextTemplate
+	if alertdata.TextTemplate != "" {
+		textSource = alertdata.TextTemplate
+	}
+	htmlSource := defaultHTMLTemplate
+	if alertdata.HTMLTemplate != "" {
+		htmlSource = alertdata.HTMLTemplate
+	}
+	subject, err := texttemplate.New("subject").Funcs(templateFuncs).Parse(subjectSource)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid subject template: %s", err.Error())
+	}
+	text, err := texttemplate.New("text").Funcs(templateFuncs).Parse(textSource)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid text template: %s", err.Error())
+	}
+	html, err := htmltemplate.New("html").Funcs(templateFuncs).Parse(htmlSource)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid HTML template: %s", err.Error())
+	}
+	return subject, text, html, nil
+}
+
+// splitAddress is a list of the single address, or an empty list if it is not set
+func splitAddress(address string) []string {
+	if address == "" {
+		return nil
+	}
+	return []string{address}
+}
+
+func parseAddresses(addresses []string) ([]*mail.Address, error) {
+	parsed := make([]*mail.Address, 0, len(addresses))
+	for _, address := range addresses {
+		a, err := mail.ParseAddress(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %s: %s", address, err.Error())
+		}
+		parsed = append(parsed, a)
+	}
+	return parsed, nil
+}
+
+func joinAddresses(addresses []*mail.Address) string {
+	formatted := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		formatted = append(formatted, address.String())
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// messageID is a unique Message-ID in the domain of the sender
+func messageID(from string, now time.Time) string {
+	domain := "k8eraid"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
 	}
+	random := make([]byte, 8)
+	rand.Read(random)
+	return fmt.Sprintf("<%d.%s@%s>", now.UnixNano(), hex.EncodeToString(random), domain)
 }
@@ -0,0 +1,342 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSMTP is a mail server taking one message, offering STARTTLS when it has a TLS config
+type fakeSMTP struct {
+	tlsConfig *tls.Config
+	implicit  bool
+
+	mu         sync.Mutex
+	tls        bool
+	auth       string
+	from       string
+	recipients []string
+	data       string
+}
+
+// withFakeSMTP runs f against a fake mail server on a local port
+func withFakeSMTP(t *testing.T, server *fakeSMTP, f func(host string, port int)) {
+	var listener net.Listener
+	var err error
+	if server.implicit {
+		listener, err = tls.Listen("tcp", "127.0.0.1:0", server.tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		server.serve(conn)
+	}()
+	addr := listener.Addr().(*net.TCPAddr)
+	f(addr.IP.String(), addr.Port)
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tls = s.implicit
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			text.PrintfLine("250-fake")
+			if s.tlsConfig != nil && !s.tls {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+			s.tls = true
+		case "AUTH":
+			s.auth = line
+			text.PrintfLine("235 ok")
+		case "MAIL":
+			s.from = line
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			s.recipients = append(s.recipients, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			lines, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.data = strings.Join(lines, "\r\n")
+			text.PrintfLine("250 ok")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+// testTLSConfig is a server TLS config for 127.0.0.1, and a CA file trusting it
+func testTLSConfig(t *testing.T) (*tls.Config, string) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.StartTLS()
+	config := server.TLS
+	cert := server.Certificate()
+	server.Close()
+
+	caFile, err := ioutil.TempFile("", "k8eraid-smtp-ca")
+	require.NoError(t, err)
+	require.NoError(t, pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	require.NoError(t, caFile.Close())
+	return &tls.Config{Certificates: config.Certificates}, caFile.Name()
+}
+
+var smtpNotification = types.Notification{
+	AlerterType: "smtp",
+	AlerterName: "mail",
+	Message:     "Deployment web is under minimum replicas!",
+	Severity:    types.SeverityCritical,
+	Alerts: []types.Alert{{
+		Check: "MinReplicas", Severity: types.SeverityCritical, Kind: "Deployment", Namespace: "default", Name: "web",
+		RunbookURL: "https://runbooks.example.com/web",
+	}},
+}
+
+func Test_AlertSMTP_relay_without_auth(t *testing.T) {
+	server := &fakeSMTP{}
+	withFakeSMTP(t, server, func(host string, port int) {
+		alertdata := types.SMTPAlerterConfig{
+			Name:           "mail",
+			MailServer:     host,
+			Port:           port,
+			FromAddress:    "k8eraid@example.com",
+			ToAddress:      "oncall@example.com",
+			To:             []string{"Platform Team <platform@example.com>"},
+			CC:             []string{"lead@example.com"},
+			BCC:            []string{"audit@example.com"},
+			PasswordEnvVar: "TEST_SMTP_UNSET_PASSWORD",
+			Subject:        "web is down",
+			TLS:            "none",
+		}
+		require.NoError(t, AlertSMTP(context.Background(), alertdata, smtpNotification))
+	})
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	assert.Empty(t, server.auth, "no login without a password")
+	assert.Equal(t, "MAIL FROM:<k8eraid@example.com>", server.from)
+	assert.Equal(t, []string{"oncall@example.com", "platform@example.com", "lead@example.com", "audit@example.com"}, server.recipients)
+
+	msg, err := mail.ReadMessage(strings.NewReader(server.data))
+	require.NoError(t, err)
+	assert.Equal(t, "[CRITICAL] web is down", msg.Header.Get("Subject"))
+	assert.Equal(t, `"Platform Team" <platform@example.com>, <oncall@example.com>`, msg.Header.Get("To"))
+	assert.Equal(t, "<lead@example.com>", msg.Header.Get("Cc"))
+	assert.Empty(t, msg.Header.Get("Bcc"), "BCC recipients should not be in the headers")
+	assert.True(t, strings.HasSuffix(msg.Header.Get("Message-ID"), "@example.com>"))
+	_, err = msg.Header.Date()
+	assert.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	text, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", text.Header.Get("Content-Type"))
+	body, err := ioutil.ReadAll(text)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), smtpNotification.Message)
+	assert.Contains(t, string(body), "runbook https://runbooks.example.com/web")
+	html, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "text/html; charset=utf-8", html.Header.Get("Content-Type"))
+	body, err = ioutil.ReadAll(html)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `<a href="https://runbooks.example.com/web">Runbook</a>`)
+}
+
+func Test_AlertSMTP_starttls_auth(t *testing.T) {
+	tlsConfig, caFile := testTLSConfig(t)
+	defer os.Remove(caFile)
+	os.Setenv("TEST_SMTP_PASSWORD", "hunter2")
+	defer os.Unsetenv("TEST_SMTP_PASSWORD")
+
+	server := &fakeSMTP{tlsConfig: tlsConfig}
+	withFakeSMTP(t, server, func(host string, port int) {
+		alertdata := types.SMTPAlerterConfig{
+			Name:           "mail",
+			MailServer:     host,
+			Port:           port,
+			FromAddress:    "k8eraid@example.com",
+			To:             []string{"oncall@example.com"},
+			Username:       "relay-user",
+			PasswordEnvVar: "TEST_SMTP_PASSWORD",
+			TLS:            "starttls",
+			CAFile:         caFile,
+		}
+		require.NoError(t, AlertSMTP(context.Background(), alertdata, smtpNotification))
+	})
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.True(t, server.tls)
+	assert.True(t, strings.HasPrefix(server.auth, "AUTH PLAIN "), "should log in with the password")
+}
+
+func Test_AlertSMTP_implicit_tls(t *testing.T) {
+	tlsConfig, caFile := testTLSConfig(t)
+	defer os.Remove(caFile)
+
+	server := &fakeSMTP{tlsConfig: tlsConfig, implicit: true}
+	withFakeSMTP(t, server, func(host string, port int) {
+		alertdata := types.SMTPAlerterConfig{
+			Name:               "mail",
+			MailServer:         host,
+			Port:               port,
+			FromAddress:        "k8eraid@example.com",
+			To:                 []string{"oncall@example.com"},
+			TLS:                "implicit",
+			InsecureSkipVerify: true,
+		}
+		require.NoError(t, AlertSMTP(context.Background(), alertdata, smtpNotification))
+	})
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	assert.Equal(t, []string{"oncall@example.com"}, server.recipients)
+}
+
+func Test_AlertSMTP_starttls_required(t *testing.T) {
+	withFakeSMTP(t, &fakeSMTP{}, func(host string, port int) {
+		alertdata := types.SMTPAlerterConfig{
+			Name:        "mail",
+			MailServer:  host,
+			Port:        port,
+			FromAddress: "k8eraid@example.com",
+			To:          []string{"oncall@example.com"},
+			TLS:         "starttls",
+		}
+		err := AlertSMTP(context.Background(), alertdata, smtpNotification)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not offer STARTTLS")
+	})
+}
+
+func Test_AlertSMTP_stalled_server(t *testing.T) {
+	// The server accepts the connection but never greets, as a hung mail server would
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+	addr := listener.Addr().(*net.TCPAddr)
+
+	alertdata := types.SMTPAlerterConfig{
+		Name:        "mail",
+		MailServer:  addr.IP.String(),
+		Port:        addr.Port,
+		FromAddress: "k8eraid@example.com",
+		To:          []string{"oncall@example.com"},
+		TLS:         "none",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = AlertSMTP(ctx, alertdata, smtpNotification)
+	require.Error(t, err)
+	assert.True(t, time.Since(start) < 2*time.Second, "the send should give up at the deadline, took %s", time.Since(start))
+}
+
+func Test_SMTPInput_templates(t *testing.T) {
+	alertdata := types.SMTPAlerterConfig{
+		FromAddress:     "k8eraid@example.com",
+		To:              []string{"oncall@example.com"},
+		SubjectTemplate: `{{ upper .Severity }}: {{ len .Alerts }} alert(s) – {{ (index .Alerts 0).Name }}`,
+		TextTemplate:    `{{ .Message }}`,
+		HTMLTemplate:    `<p>{{ .Message }}</p>`,
+	}
+	notification := smtpNotification
+	notification.Message = "<web> is down"
+	msg, err := SMTPInput(alertdata, notification, time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(msg)))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "CRITICAL: 1 alert(s) – web", subject)
+	assert.Equal(t, "Sat, 01 Jun 2019 12:00:00 +0000", parsed.Header.Get("Date"))
+	assert.Contains(t, string(msg), "&lt;web&gt; is down", "the HTML part should be escaped")
+
+	tests := []struct {
+		name      string
+		alertdata types.SMTPAlerterConfig
+	}{
+		{"no recipients", types.SMTPAlerterConfig{}},
+		{"invalid address", types.SMTPAlerterConfig{To: []string{"not an address"}}},
+		{"unknown tls mode", types.SMTPAlerterConfig{To: []string{"a@example.com"}, TLS: "ssl"}},
+		{"invalid template", types.SMTPAlerterConfig{To: []string{"a@example.com"}, HTMLTemplate: "{{ .Message"}},
+	}
+	for _, test := range tests {
+		test.alertdata.Name = "mail"
+		test.alertdata.MailServer = "smtp.example.com"
+		test.alertdata.FromAddress = "k8eraid@example.com"
+		assert.Error(t, (&smtpAlerter{config: test.alertdata}).Validate(), test.name)
+	}
+}
@@ -15,10 +15,54 @@
 package alerters
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
 )
 
+func init() {
+	Register("stderr", newStderrAlerter)
+}
+
+// stderrAlerter is the Alerter for stderr alerters, which print notifications to stderr. They need no config, but
+// can be listed in "alerters" like any other type.
+type stderrAlerter struct {
+	name string
+}
+
+func newStderrAlerter(config json.RawMessage) (Alerter, error) {
+	var c struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(config, &c); err != nil {
+		return nil, err
+	}
+	return &stderrAlerter{name: c.Name}, nil
+}
+
+func (a *stderrAlerter) Name() string {
+	return a.name
+}
+
+// Validate does nothing, stderr alerters have no settings
+func (a *stderrAlerter) Validate() error {
+	return nil
+}
+
+// Send prints the notification message to stderr
+func (a *stderrAlerter) Send(_ context.Context, notification types.Notification) error {
+	AlertStderr(notification.Message)
+	return nil
+}
+
+// Resolve does nothing, only firing notifications are printed
+func (a *stderrAlerter) Resolve(context.Context, types.Notification) error {
+	return nil
+}
+
 // AlertStderr sends messages to stderr forwarded from alert.go
 func AlertStderr(message string) {
 	fmt.Fprintln(os.Stderr, message)
@@ -0,0 +1,41 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// TemplateData is what alerter templates, such as webhook bodies and emails, are executed with: the notification,
+// with its Message, Severity and Alerts, plus the alerter Subject and the time of sending
+type TemplateData struct {
+	types.Notification
+	Subject string
+	Time    time.Time
+}
+
+// templateFuncs are the functions available to alerter templates. json quotes a value for a JSON body, and upper
+// upper-cases a string, such as the severity.
+var templateFuncs = map[string]interface{}{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+}
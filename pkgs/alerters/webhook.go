@@ -16,75 +16,192 @@ package alerters
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
-	"net/url"
+	"text/template"
 	"time"
 
 	"github.com/bloomberg/k8eraid/pkgs/types"
 )
 
-// AlertWebhook sends a general http(s) payload using data relayed from alerts.go
-func AlertWebhook(alertdata types.WebhookAlerterConfig, message string) {
-	mytime := time.Now().Local()
-
-	// Specify alert details
-	D := types.WebhookAlertDetails{}
-	D.Subject = alertdata.Subject
-	D.Msg = message
-	D.Time = mytime
-
-	// Set http proxy and custom http client
-
-	var myTransport *http.Transport
-	var err error
-
-	if alertdata.ProxyServer != "" {
-		proxyURL, _ := url.Parse(alertdata.ProxyServer)
-		myTransport = &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout: 5 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout: 5 * time.Second,
-			Proxy:               http.ProxyURL(proxyURL),
-		}
-	} else {
-		myTransport = &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout: 5 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout: 5 * time.Second,
+// Header the body signature is sent in when the alerter does not name one
+const defaultSignatureHeader = "X-K8eraid-Signature"
+
+func init() {
+	Register("webhook", newWebhookAlerter)
+}
+
+// webhookAlerter is the Alerter for webhook alerters
+type webhookAlerter struct {
+	config types.WebhookAlerterConfig
+}
+
+func newWebhookAlerter(config json.RawMessage) (Alerter, error) {
+	a := &webhookAlerter{}
+	if err := json.Unmarshal(config, &a.config); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *webhookAlerter) Name() string {
+	return a.config.Name
+}
+
+// Validate checks the server is set and the body template parses
+func (a *webhookAlerter) Validate() error {
+	if err := requireFields("server", a.config.Server); err != nil {
+		return err
+	}
+	if a.config.BodyTemplate != "" {
+		if _, err := template.New(a.config.Name).Funcs(templateFuncs).Parse(a.config.BodyTemplate); err != nil {
+			return fmt.Errorf("invalid body template: %s", err.Error())
 		}
 	}
+	return nil
+}
+
+// Send posts the notification to the webhook
+func (a *webhookAlerter) Send(ctx context.Context, notification types.Notification) error {
+	return AlertWebhook(ctx, a.config, notification)
+}
 
-	var myClient = &http.Client{
-		Timeout:   time.Second * 10,
-		Transport: myTransport,
+// Resolve posts the resolved notification, which has Resolved set, to webhooks with a body template. Webhooks
+// without one are only sent firing notifications, as their body can not say the alert resolved.
+func (a *webhookAlerter) Resolve(ctx context.Context, notification types.Notification) error {
+	if a.config.BodyTemplate == "" {
+		return nil
 	}
+	return AlertWebhook(ctx, a.config, notification)
+}
 
-	// Trigger event
-	err = createWebhookWithHTTPClient(D, myClient, alertdata)
+// AlertWebhook sends a general http(s) payload using data relayed from alerts.go
+func AlertWebhook(ctx context.Context, alertdata types.WebhookAlerterConfig, notification types.Notification) error {
+	client, err := webhookHTTPClient(ctx, alertdata)
 	if err != nil {
-		errLogger.Println("Issue sending Webhook alert: ", err)
+		return fmt.Errorf("alert configuration %s: %s", alertdata.Name, err.Error())
+	}
+	body, err := webhookBody(alertdata, notification, time.Now().Local())
+	if err != nil {
+		return fmt.Errorf("alert configuration %s: %s", alertdata.Name, err.Error())
+	}
+
+	// Trigger event
+	if err := createWebhookWithHTTPClient(body, client, alertdata); err != nil {
+		return fmt.Errorf("issue sending Webhook alert: %s", err.Error())
 	}
 	logger.Println("Webhook event triggered for webhook alerter: ", alertdata.Name)
+	return nil
 }
 
-func createWebhookWithHTTPClient(d types.WebhookAlertDetails, client *http.Client, alertdata types.WebhookAlerterConfig) error {
-	data, err := json.Marshal(d)
+// webhookHTTPClient returns a client trusting the alerter CA bundle and presenting its client certificate
+func webhookHTTPClient(ctx context.Context, alertdata types.WebhookAlerterConfig) (*http.Client, error) {
+	if alertdata.TLS == nil {
+		return newHTTPClient(ctx, alertdata.ProxyServer)
+	}
+	tlsConfig := &tls.Config{}
+	if alertdata.TLS.CAFile != "" {
+		pool, err := loadCAFile(alertdata.TLS.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if alertdata.TLS.CertFile != "" || alertdata.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(alertdata.TLS.CertFile, alertdata.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return newTLSHTTPClient(ctx, alertdata.ProxyServer, tlsConfig)
+}
+
+// webhookBody renders the alerter body template, or WebhookAlertDetails as JSON without one
+func webhookBody(alertdata types.WebhookAlerterConfig, notification types.Notification, now time.Time) ([]byte, error) {
+	if alertdata.BodyTemplate == "" {
+		return json.Marshal(types.WebhookAlertDetails{
+			Subject: alertdata.Subject,
+			Msg:     notification.Message,
+			Time:    now,
+		})
+	}
+	tmpl, err := template.New(alertdata.Name).Funcs(templateFuncs).Parse(alertdata.BodyTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body template: %s", err.Error())
+	}
+	var body bytes.Buffer
+	data := TemplateData{Notification: notification, Subject: alertdata.Subject, Time: now}
+	if err := tmpl.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("unable to execute body template: %s", err.Error())
+	}
+	return body.Bytes(), nil
+}
+
+// webhookSignature is the hex HMAC-SHA256 of body, so a receiver holding the secret can check where it came from
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func createWebhookWithHTTPClient(body []byte, client *http.Client, alertdata types.WebhookAlerterConfig) error {
+	method := alertdata.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequest(method, alertdata.Server, bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
-	req, _ := http.NewRequest("POST", alertdata.Server, bytes.NewBuffer(data))
 	req.Header.Set("Content-Type", "application/json")
+	for _, header := range alertdata.Headers {
+		value := header.Value
+		if header.ValueFrom != nil {
+			if value, err = resolveSecretValue(*header.ValueFrom); err != nil {
+				return fmt.Errorf("header %s: %s", header.Name, err.Error())
+			}
+		}
+		req.Header.Set(header.Name, value)
+	}
+	if alertdata.BearerToken != nil {
+		token, err := resolveSecretValue(*alertdata.BearerToken)
+		if err != nil {
+			return fmt.Errorf("bearer token: %s", err.Error())
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if alertdata.BasicAuth != nil {
+		password, err := resolveSecretValue(alertdata.BasicAuth.Password)
+		if err != nil {
+			return fmt.Errorf("basic auth password: %s", err.Error())
+		}
+		req.SetBasicAuth(alertdata.BasicAuth.Username, password)
+	}
+	if alertdata.SigningSecret != nil {
+		secret, err := resolveSecretValue(*alertdata.SigningSecret)
+		if err != nil {
+			return fmt.Errorf("signing secret: %s", err.Error())
+		}
+		signatureHeader := alertdata.SignatureHeader
+		if signatureHeader == "" {
+			signatureHeader = defaultSignatureHeader
+		}
+		req.Header.Set(signatureHeader, webhookSignature(secret, body))
+	}
+
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return fmt.Errorf("HTTP Status Code: %d", resp.StatusCode)
 	}
 	return nil
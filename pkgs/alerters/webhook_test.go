@@ -0,0 +1,205 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package alerters
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var webhookNotification = types.Notification{
+	AlerterType: "webhook",
+	AlerterName: "hook",
+	Message:     "Deployment web is under minimum replicas!",
+	Severity:    types.SeverityCritical,
+	Alerts:      []types.Alert{{Check: "MinReplicas", Kind: "Deployment", Namespace: "default", Name: "web"}},
+}
+
+// withRecordingServer runs f against a server answering status, and returns the request it received
+func withRecordingServer(t *testing.T, status int, f func(url string)) (*http.Request, []byte) {
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = r
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	f(server.URL)
+	return received, body
+}
+
+func Test_createWebhookWithHTTPClient_template_headers_signature(t *testing.T) {
+	os.Setenv("TEST_WEBHOOK_TOKEN", "token")
+	os.Setenv("TEST_WEBHOOK_TEAM", "platform")
+	os.Setenv("TEST_WEBHOOK_SECRET", "secret")
+	defer os.Unsetenv("TEST_WEBHOOK_TOKEN")
+	defer os.Unsetenv("TEST_WEBHOOK_TEAM")
+	defer os.Unsetenv("TEST_WEBHOOK_SECRET")
+
+	alertdata := types.WebhookAlerterConfig{
+		Name:   "hook",
+		Method: "PUT",
+		Headers: []types.WebhookHeader{
+			{Name: "X-Source", Value: "k8eraid"},
+			{Name: "X-Team", ValueFrom: &types.SecretValue{EnvVar: "TEST_WEBHOOK_TEAM"}},
+		},
+		BodyTemplate:  `{"text": {{ json .Message }}, "severity": "{{ .Severity }}", "name": "{{ (index .Alerts 0).Name }}"}`,
+		BearerToken:   &types.SecretValue{EnvVar: "TEST_WEBHOOK_TOKEN"},
+		SigningSecret: &types.SecretValue{EnvVar: "TEST_WEBHOOK_SECRET"},
+	}
+	body, err := webhookBody(alertdata, webhookNotification, time.Now())
+	require.NoError(t, err)
+
+	req, received := withRecordingServer(t, http.StatusAccepted, func(url string) {
+		alertdata.Server = url
+		client, err := webhookHTTPClient(context.Background(), alertdata)
+		require.NoError(t, err)
+		assert.NoError(t, createWebhookWithHTTPClient(body, client, alertdata), "any 2xx should be accepted")
+	})
+	require.NotNil(t, req)
+
+	assert.Equal(t, "PUT", req.Method)
+	assert.Equal(t, "k8eraid", req.Header.Get("X-Source"))
+	assert.Equal(t, "platform", req.Header.Get("X-Team"))
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+	assert.Equal(t, webhookSignature("secret", received), req.Header.Get(defaultSignatureHeader))
+	assert.Equal(t, "sha256=", req.Header.Get(defaultSignatureHeader)[:7])
+
+	var payload map[string]string
+	require.NoError(t, json.Unmarshal(received, &payload))
+	assert.Equal(t, map[string]string{"text": webhookNotification.Message, "severity": "critical", "name": "web"}, payload)
+}
+
+func Test_createWebhookWithHTTPClient_basic_auth_from_secret(t *testing.T) {
+	SetKubeClient(fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "hook-auth", Namespace: "monitoring"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	}))
+	defer SetKubeClient(nil)
+
+	alertdata := types.WebhookAlerterConfig{
+		Name:    "hook",
+		Subject: "k8eraid alert",
+		BasicAuth: &types.WebhookBasicAuth{
+			Username: "k8eraid",
+			Password: types.SecretValue{Secret: &types.SecretKeyRef{Namespace: "monitoring", Name: "hook-auth", Key: "password"}},
+		},
+	}
+	body, err := webhookBody(alertdata, webhookNotification, time.Now())
+	require.NoError(t, err)
+
+	req, received := withRecordingServer(t, http.StatusOK, func(url string) {
+		alertdata.Server = url
+		client, err := webhookHTTPClient(context.Background(), alertdata)
+		require.NoError(t, err)
+		assert.NoError(t, createWebhookWithHTTPClient(body, client, alertdata))
+	})
+	require.NotNil(t, req)
+
+	assert.Equal(t, "POST", req.Method)
+	user, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "k8eraid", user)
+	assert.Equal(t, "hunter2", password)
+	assert.Empty(t, req.Header.Get(defaultSignatureHeader))
+
+	var details types.WebhookAlertDetails
+	require.NoError(t, json.Unmarshal(received, &details))
+	assert.Equal(t, "k8eraid alert", details.Subject)
+	assert.Equal(t, webhookNotification.Message, details.Msg)
+
+	alertdata.BasicAuth.Password.Secret.Key = "missing"
+	assert.Error(t, createWebhookWithHTTPClient(body, http.DefaultClient, alertdata), "a missing secret key should fail")
+}
+
+func Test_createWebhookWithHTTPClient_rejects_non_2xx(t *testing.T) {
+	alertdata := types.WebhookAlerterConfig{Name: "hook"}
+	withRecordingServer(t, http.StatusMultipleChoices, func(url string) {
+		alertdata.Server = url
+		assert.Error(t, createWebhookWithHTTPClient([]byte("{}"), http.DefaultClient, alertdata))
+	})
+}
+
+func Test_webhookBody_invalid_template(t *testing.T) {
+	_, err := webhookBody(types.WebhookAlerterConfig{BodyTemplate: "{{ .Message"}, webhookNotification, time.Now())
+	assert.Error(t, err)
+}
+
+func Test_webhookHTTPClient_ca_file(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	alertdata := types.WebhookAlerterConfig{Name: "hook", Server: server.URL}
+
+	client, err := webhookHTTPClient(context.Background(), alertdata)
+	require.NoError(t, err)
+	assert.Error(t, createWebhookWithHTTPClient([]byte("{}"), client, alertdata), "the test CA should not be trusted by default")
+
+	caFile, err := ioutil.TempFile("", "k8eraid-ca")
+	require.NoError(t, err)
+	defer os.Remove(caFile.Name())
+	require.NoError(t, pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	require.NoError(t, caFile.Close())
+
+	alertdata.TLS = &types.WebhookTLSConfig{CAFile: caFile.Name()}
+	client, err = webhookHTTPClient(context.Background(), alertdata)
+	require.NoError(t, err)
+	assert.NoError(t, createWebhookWithHTTPClient([]byte("{}"), client, alertdata))
+
+	alertdata.TLS = &types.WebhookTLSConfig{CertFile: caFile.Name()}
+	_, err = webhookHTTPClient(context.Background(), alertdata)
+	assert.Error(t, err, "a client certificate without a key should fail")
+}
+
+func Test_webhookAlerter_Resolve(t *testing.T) {
+	resolved := webhookNotification
+	resolved.Resolved = true
+
+	req, received := withRecordingServer(t, http.StatusOK, func(url string) {
+		alerter, err := newWebhookAlerter([]byte(`{"name": "hook", "server": "` + url + `", "bodyTemplate": "{\"text\": {{ json .Message }}, \"resolved\": {{ .Resolved }}}"}`))
+		require.NoError(t, err)
+		require.NoError(t, alerter.Resolve(context.Background(), resolved))
+	})
+	require.NotNil(t, req, "a templated webhook should be sent the resolved notification")
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(received, &payload))
+	assert.Equal(t, true, payload["resolved"])
+
+	req, _ = withRecordingServer(t, http.StatusOK, func(url string) {
+		alerter, err := newWebhookAlerter([]byte(`{"name": "hook", "server": "` + url + `"}`))
+		require.NoError(t, err)
+		require.NoError(t, alerter.Resolve(context.Background(), resolved))
+	})
+	assert.Nil(t, req, "a webhook without a body template should not be sent resolved notifications")
+}
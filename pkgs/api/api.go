@@ -0,0 +1,173 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api serves k8eraid's HTTP API. On-call can list the state of every alert, and acknowledge a firing
+// alert by its fingerprint so it is not sent again until the acknowledgement ends. Slack messages posted by a
+// bot with ack buttons acknowledge alerts through the same API, with requests signed by Slack.
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// Requests larger than this are refused
+const maxBodySize = 1 << 20
+
+// Acknowledgements cannot last longer than this, so a forgotten one does not mute an alert for good
+const maxAckDuration = 7 * 24 * time.Hour
+
+// Alerts is the part of the dispatcher the API works on
+type Alerts interface {
+	States() []types.AlertState
+	Acknowledge(fingerprint string, ack types.Ack) (int, error)
+}
+
+// Server serves the API for a dispatcher
+type Server struct {
+	alerts Alerts
+	// If set, /alerts and /ack requests must carry it as a bearer token
+	token string
+	// If set, /ack/slack requests must be signed with it, otherwise they are refused
+	slackSigningSecret string
+	now                func() time.Time
+}
+
+// AckRequest is the body of a POST to /ack. The acknowledgement ends at Until, or Duration from now, and lasts at most
+// maxAckDuration.
+type AckRequest struct {
+	Fingerprint string    `json:"fingerprint"`
+	Until       time.Time `json:"until"`
+	Duration    string    `json:"duration"`
+	By          string    `json:"by"`
+	Comment     string    `json:"comment"`
+}
+
+// AckResponse is the reply to a successful acknowledgement
+type AckResponse struct {
+	Fingerprint  string    `json:"fingerprint"`
+	Acknowledged int       `json:"acknowledged"`
+	Until        time.Time `json:"until"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewServer creates a Server for alerts
+func NewServer(alerts Alerts, token string, slackSigningSecret string) *Server {
+	return &Server{
+		alerts:             alerts,
+		token:              token,
+		slackSigningSecret: slackSigningSecret,
+		now:                time.Now,
+	}
+}
+
+// Handler returns the handler for the API's endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/alerts", s.authorized(s.handleAlerts))
+	mux.HandleFunc("/ack", s.authorized(s.handleAck))
+	mux.HandleFunc("/ack/slack", s.handleSlackAction)
+	return mux
+}
+
+// authorized checks the bearer token of requests, when the server has one
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or wrong bearer token"))
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// handleAlerts lists alert states, with their acknowledgements. ?status=firing or ?status=resolved lists only
+// alerts in that state.
+func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed, use GET", r.Method))
+		return
+	}
+	status := r.URL.Query().Get("status")
+	states := []types.AlertState{}
+	for _, state := range s.alerts.States() {
+		if status == "" || state.Status == status {
+			states = append(states, state)
+		}
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+func (s *Server) handleAck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed, use POST", r.Method))
+		return
+	}
+	var req AckRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid acknowledgement: %s", err.Error()))
+		return
+	}
+	if req.Fingerprint == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid acknowledgement: no fingerprint"))
+		return
+	}
+	now := s.now()
+	until := req.Until
+	if req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid acknowledgement duration: %s", err.Error()))
+			return
+		}
+		until = now.Add(duration)
+	}
+	if !until.After(now) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid acknowledgement: until or a positive duration is required"))
+		return
+	}
+	if until.Sub(now) > maxAckDuration {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid acknowledgement: it cannot last longer than %s", maxAckDuration))
+		return
+	}
+
+	acknowledged, err := s.alerts.Acknowledge(req.Fingerprint, types.Ack{By: req.By, Comment: req.Comment, At: now, Until: until})
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, AckResponse{Fingerprint: req.Fingerprint, Acknowledged: acknowledged, Until: until})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,216 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+var testNow = time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeAlerts has one firing alert, with fingerprint 0123456789abcdef
+type fakeAlerts struct {
+	acks map[string]Ack
+}
+
+func (f *fakeAlerts) States() []AlertState {
+	states := []AlertState{
+		{Fingerprint: "0123456789abcdef", Status: AlertFiring},
+		{Fingerprint: "fedcba9876543210", Status: AlertResolved},
+	}
+	if ack, ok := f.acks["0123456789abcdef"]; ok {
+		states[0].Ack = &ack
+	}
+	return states
+}
+
+func (f *fakeAlerts) Acknowledge(fingerprint string, ack Ack) (int, error) {
+	if fingerprint != "0123456789abcdef" {
+		return 0, fmt.Errorf("no firing alert with fingerprint %s", fingerprint)
+	}
+	f.acks[fingerprint] = ack
+	return 1, nil
+}
+
+func testServer(token string, slackSigningSecret string) (*Server, *fakeAlerts) {
+	alerts := &fakeAlerts{acks: map[string]Ack{}}
+	s := NewServer(alerts, token, slackSigningSecret)
+	s.now = func() time.Time { return testNow }
+	return s, alerts
+}
+
+func Test_ack(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		until  time.Time
+	}{
+		{"duration", `{"fingerprint": "0123456789abcdef", "duration": "2h", "by": "alice", "comment": "deploying a fix"}`, http.StatusOK, testNow.Add(2 * time.Hour)},
+		{"until", `{"fingerprint": "0123456789abcdef", "until": "2019-06-01T18:00:00Z"}`, http.StatusOK, testNow.Add(6 * time.Hour)},
+		{"unknown fingerprint", `{"fingerprint": "aaaaaaaaaaaaaaaa", "duration": "1h"}`, http.StatusNotFound, time.Time{}},
+		{"no fingerprint", `{"duration": "1h"}`, http.StatusBadRequest, time.Time{}},
+		{"no end", `{"fingerprint": "0123456789abcdef"}`, http.StatusBadRequest, time.Time{}},
+		{"until in the past", `{"fingerprint": "0123456789abcdef", "until": "2019-06-01T11:00:00Z"}`, http.StatusBadRequest, time.Time{}},
+		{"duration too long", `{"fingerprint": "0123456789abcdef", "duration": "169h"}`, http.StatusBadRequest, time.Time{}},
+		{"until too late", `{"fingerprint": "0123456789abcdef", "until": "2020-06-01T12:00:00Z"}`, http.StatusBadRequest, time.Time{}},
+		{"invalid duration", `{"fingerprint": "0123456789abcdef", "duration": "soon"}`, http.StatusBadRequest, time.Time{}},
+		{"invalid JSON", `{`, http.StatusBadRequest, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, alerts := testServer("", "")
+			w := httptest.NewRecorder()
+			s.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ack", strings.NewReader(tt.body)))
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			ack := alerts.acks["0123456789abcdef"]
+			if !ack.Until.Equal(tt.until) || !ack.At.Equal(testNow) {
+				t.Errorf("expected an acknowledgement from %s until %s, got %+v", testNow, tt.until, ack)
+			}
+			var resp AckResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Acknowledged != 1 {
+				t.Errorf("unexpected response %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_alerts(t *testing.T) {
+	s, _ := testServer("secret-token", "")
+	post := httptest.NewRequest(http.MethodPost, "/ack", strings.NewReader(`{"fingerprint": "0123456789abcdef", "duration": "1h", "by": "alice"}`))
+	post.Header.Set("Authorization", "Bearer secret-token")
+	s.Handler().ServeHTTP(httptest.NewRecorder(), post)
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		status int
+		count  int
+	}{
+		{"all", "/alerts", "secret-token", http.StatusOK, 2},
+		{"firing", "/alerts?status=firing", "secret-token", http.StatusOK, 1},
+		{"no token", "/alerts", "", http.StatusUnauthorized, 0},
+		{"wrong token", "/alerts", "guess", http.StatusUnauthorized, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			s.Handler().ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var states []AlertState
+			if err := json.Unmarshal(w.Body.Bytes(), &states); err != nil || len(states) != tt.count {
+				t.Fatalf("expected %d alerts, got %s", tt.count, w.Body.String())
+			}
+			if states[0].Ack == nil || states[0].Ack.By != "alice" {
+				t.Errorf("expected the acknowledgement in the alert state, got %+v", states[0])
+			}
+		})
+	}
+}
+
+// slackRequest builds a Slack action request for the button name, signed with secret at signedAt
+func slackRequest(secret string, signedAt time.Time, name string, fingerprint string) *http.Request {
+	payload := fmt.Sprintf(`{"type": "interactive_message", "callback_id": "k8eraid_ack", "user": {"id": "U0123", "name": "alice"}, "actions": [{"name": %q, "type": "button", "value": %q}]}`, name, fingerprint)
+	body := url.Values{"payload": {payload}}.Encode()
+	timestamp := fmt.Sprint(signedAt.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	r := httptest.NewRequest(http.MethodPost, "/ack/slack", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func Test_slackAction(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  *http.Request
+		status   int
+		until    time.Time
+		response string
+	}{
+		{"ack", slackRequest("slack-secret", testNow, "ack", "0123456789abcdef"), http.StatusOK, testNow.Add(time.Hour), "<@U0123> acknowledged this alert until 2019-06-01 13:00 UTC"},
+		{"silence", slackRequest("slack-secret", testNow.Add(-time.Minute), "silence", "0123456789abcdef"), http.StatusOK, testNow.Add(24 * time.Hour), "<@U0123> acknowledged this alert until 2019-06-02 12:00 UTC"},
+		{"resolved alert", slackRequest("slack-secret", testNow, "ack", "fedcba9876543210"), http.StatusOK, time.Time{}, "Could not acknowledge: no firing alert with fingerprint fedcba9876543210"},
+		{"unknown action", slackRequest("slack-secret", testNow, "escalate", "0123456789abcdef"), http.StatusOK, time.Time{}, `Unknown k8eraid action "escalate"`},
+		{"wrong secret", slackRequest("other-secret", testNow, "ack", "0123456789abcdef"), http.StatusUnauthorized, time.Time{}, ""},
+		{"replayed", slackRequest("slack-secret", testNow.Add(-10*time.Minute), "ack", "0123456789abcdef"), http.StatusUnauthorized, time.Time{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, alerts := testServer("api-token", "slack-secret")
+			w := httptest.NewRecorder()
+			s.Handler().ServeHTTP(w, tt.request)
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var resp slackActionResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Text != tt.response {
+				t.Errorf("expected response %q, got %s", tt.response, w.Body.String())
+			}
+			ack, acked := alerts.acks["0123456789abcdef"]
+			if tt.until.IsZero() {
+				if acked {
+					t.Errorf("expected no acknowledgement, got %+v", ack)
+				}
+				return
+			}
+			if !ack.Until.Equal(tt.until) || ack.By != "alice" {
+				t.Errorf("expected an acknowledgement by alice until %s, got %+v", tt.until, ack)
+			}
+		})
+	}
+}
+
+func Test_slackAction_without_secret(t *testing.T) {
+	s, _ := testServer("", "")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, slackRequest("", testNow, "ack", "0123456789abcdef"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Slack actions should be refused without a signing secret, got status %d", w.Code)
+	}
+}
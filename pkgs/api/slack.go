@@ -0,0 +1,138 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// Slack requests signed longer ago than this are refused, so a captured request can not be replayed
+const slackMaxRequestAge = 5 * time.Minute
+
+// slackAckDurations are how long each of the buttons on Slack bot messages acknowledges an alert for, by
+// button name
+var slackAckDurations = map[string]time.Duration{
+	"ack":     time.Hour,
+	"silence": 24 * time.Hour,
+}
+
+// slackActionPayload is the part of a Slack interactive message request the API uses
+type slackActionPayload struct {
+	CallbackID string `json:"callback_id"`
+	User       struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"user"`
+	Actions []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"actions"`
+}
+
+// slackActionResponse is posted in the channel of the message whose button was clicked
+type slackActionResponse struct {
+	ResponseType    string `json:"response_type"`
+	ReplaceOriginal bool   `json:"replace_original"`
+	Text            string `json:"text"`
+}
+
+// handleSlackAction acknowledges the alert of a clicked button, for the duration of the button. Slack shows
+// the text of the response, so failures to acknowledge are reported to the user rather than as HTTP errors.
+func (s *Server) handleSlackAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s not allowed, use POST", r.Method))
+		return
+	}
+	if s.slackSigningSecret == "" {
+		writeError(w, http.StatusForbidden, fmt.Errorf("no Slack signing secret configured"))
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	now := s.now()
+	if err := verifySlackSignature(s.slackSigningSecret, r.Header, body, now); err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var payload slackActionPayload
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid Slack action payload: %s", err.Error()))
+		return
+	}
+	if len(payload.Actions) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Slack action payload has no actions"))
+		return
+	}
+
+	action := payload.Actions[0]
+	duration, ok := slackAckDurations[action.Name]
+	if !ok {
+		writeJSON(w, http.StatusOK, slackActionResponse{ResponseType: "ephemeral", Text: fmt.Sprintf("Unknown k8eraid action %q", action.Name)})
+		return
+	}
+	ack := types.Ack{By: payload.User.Name, Comment: "from Slack", At: now, Until: now.Add(duration)}
+	if _, err := s.alerts.Acknowledge(action.Value, ack); err != nil {
+		writeJSON(w, http.StatusOK, slackActionResponse{ResponseType: "ephemeral", Text: "Could not acknowledge: " + err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, slackActionResponse{
+		ResponseType: "in_channel",
+		Text:         fmt.Sprintf("<@%s> acknowledged this alert until %s", payload.User.ID, ack.Until.UTC().Format("2006-01-02 15:04 MST")),
+	})
+}
+
+// verifySlackSignature checks a request was signed by Slack with the signing secret within the last few minutes,
+// as described in https://api.slack.com/docs/verifying-requests-from-slack
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid Slack request timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return fmt.Errorf("Slack request timestamp %s is too far from now", timestamp)
+	}
+	value := header.Get("X-Slack-Signature")
+	signature, err := hex.DecodeString(strings.TrimPrefix(value, "v0="))
+	if err != nil || !strings.HasPrefix(value, "v0=") {
+		return fmt.Errorf("invalid Slack signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return fmt.Errorf("wrong Slack signature")
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package delivery sends notifications to alerters from a queue for each alerter, so a slow alerter holds up
+// neither the checks nor the other alerters. Failed sends are retried with exponential backoff, and notifications
+// that still fail are written to a dead-letter sink and sent to a fallback alerter.
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// Defaults for an unset retry policy and queue size
+const (
+	defaultRetries        = 3
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+	defaultTimeout        = 30 * time.Second
+	defaultQueueSize      = 100
+)
+
+var errLogger = log.New(os.Stderr, "delivery", log.LstdFlags)
+
+// SendFunc sends a notification with an alerter, returning an error if it was not sent. It must return once ctx
+// is done, as the next attempt only starts after it has returned.
+type SendFunc func(ctx context.Context, notification types.Notification, config types.AlertersConfig) error
+
+// DeadLetter is written to the dead-letter sink for a notification that could not be sent
+type DeadLetter struct {
+	Time         time.Time          `json:"time"`
+	Notification types.Notification `json:"notification"`
+	Attempts     int                `json:"attempts"`
+	Error        string             `json:"error"`
+}
+
+// Queue delivers notifications to alerters in the background, with a worker for each alerter so notifications
+// to an alerter are sent in order
+type Queue struct {
+	mu     sync.Mutex
+	send   SendFunc
+	queues map[string]chan *item
+	// pending holds the queued notifications not yet picked up for sending, by alerter and notification key, so
+	// a notification raised again while still queued replaces the queued one rather than taking another place
+	pending map[string]*item
+	closed  bool
+	wg      sync.WaitGroup
+	// deadLetterMu serialises writes to the dead-letter file
+	deadLetterMu sync.Mutex
+	sleep        func(time.Duration)
+	now          func() time.Time
+}
+
+type item struct {
+	notification types.Notification
+	config       types.AlertersConfig
+	// pendingKey is the key of the item in pending, empty for notifications without a key
+	pendingKey string
+}
+
+type retryPolicy struct {
+	retries        int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	timeout        time.Duration
+}
+
+// NewQueue creates a Queue sending notifications with send
+func NewQueue(send SendFunc) *Queue {
+	return &Queue{
+		send:    send,
+		queues:  map[string]chan *item{},
+		pending: map[string]*item{},
+		sleep:   time.Sleep,
+		now:     time.Now,
+	}
+}
+
+// Notify queues a notification for its alerter, without waiting for it to be sent. A notification with the same
+// key as one still waiting in the queue replaces it, so an alerter that is down does not fill its queue with the
+// same alerts raised on every poll. It fails the notification straight away if the alerter's queue is full.
+func (q *Queue) Notify(notification types.Notification, config types.AlertersConfig) {
+	it := &item{notification: notification, config: config}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		q.fail(*it, 0, fmt.Errorf("delivery queue is closed"))
+		return
+	}
+	key := notification.AlerterType + "/" + notification.AlerterName
+	if notification.Key != "" {
+		it.pendingKey = key + "/" + notification.Key
+		if queued, ok := q.pending[it.pendingKey]; ok {
+			*queued = *it
+			q.mu.Unlock()
+			return
+		}
+	}
+	queue, ok := q.queues[key]
+	if !ok {
+		size := config.Delivery.QueueSize
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+		queue = make(chan *item, size)
+		q.queues[key] = queue
+		q.wg.Add(1)
+		go q.work(queue)
+	}
+	select {
+	case queue <- it:
+		if it.pendingKey != "" {
+			q.pending[it.pendingKey] = it
+		}
+		q.mu.Unlock()
+	default:
+		q.mu.Unlock()
+		q.fail(*it, 0, fmt.Errorf("queue for %s alerter %s is full", notification.AlerterType, notification.AlerterName))
+	}
+}
+
+// Close stops taking notifications, and waits for those already queued to be delivered
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	for _, queue := range q.queues {
+		close(queue)
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+func (q *Queue) work(queue <-chan *item) {
+	defer q.wg.Done()
+	for queued := range queue {
+		// Take the latest notification for the key, later ones are queued again
+		q.mu.Lock()
+		it := *queued
+		if it.pendingKey != "" {
+			delete(q.pending, it.pendingKey)
+		}
+		q.mu.Unlock()
+		q.deliver(it)
+	}
+}
+
+// deliver sends a notification, retrying until it is sent or its alerter's retries run out
+func (q *Queue) deliver(it item) {
+	policy := policyFor(it.config.Delivery, it.notification.AlerterType, it.notification.AlerterName)
+	for attempt := 1; ; attempt++ {
+		err := q.attempt(it, policy.timeout)
+		if err == nil {
+			return
+		}
+		if attempt > policy.retries {
+			q.fail(it, attempt, err)
+			return
+		}
+		wait := backoff(policy, attempt)
+		errLogger.Printf("Attempt %d sending to %s alerter %s failed, retrying in %s: %s",
+			attempt, it.notification.AlerterType, it.notification.AlerterName, wait, err.Error())
+		q.sleep(wait)
+	}
+}
+
+// attempt sends a notification once, giving the alerter until the timeout. It waits for the alerter to return,
+// so a slow send is never still running when the notification is retried.
+func (q *Queue) attempt(it item, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := q.send(ctx, it.notification, it.config)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s: %s", timeout, err.Error())
+	}
+	return err
+}
+
+// fail writes a notification to the dead-letter sink, and sends it on to the fallback alerter unless it was
+// for the fallback alerter itself
+func (q *Queue) fail(it item, attempts int, err error) {
+	n := it.notification
+	q.writeDeadLetter(it.config.Delivery.DeadLetterFile, DeadLetter{
+		Time:         q.now(),
+		Notification: n,
+		Attempts:     attempts,
+		Error:        err.Error(),
+	})
+	fallback := it.config.Delivery.Fallback
+	if fallback == nil || (fallback.AlerterType == n.AlerterType && fallback.AlerterName == n.AlerterName) {
+		return
+	}
+	q.Notify(fallbackNotification(n, *fallback), it.config)
+}
+
+func (q *Queue) writeDeadLetter(path string, letter DeadLetter) {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		errLogger.Printf("Unable to encode dead letter: %s", err.Error())
+		return
+	}
+	errLogger.Printf("Giving up sending to %s alerter %s: %s", letter.Notification.AlerterType, letter.Notification.AlerterName, data)
+	if path == "" {
+		return
+	}
+	q.deadLetterMu.Lock()
+	defer q.deadLetterMu.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		errLogger.Printf("Unable to open dead-letter file %s: %s", path, err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		errLogger.Printf("Unable to write dead-letter file %s: %s", path, err.Error())
+	}
+}
+
+// fallbackNotification readdresses a notification to the fallback alerter, saying which alerter it was meant for
+func fallbackNotification(notification types.Notification, fallback types.AlerterRef) types.Notification {
+	n := notification
+	n.Message = fmt.Sprintf("Could not send to %s alerter %s: %s", notification.AlerterType, notification.AlerterName, notification.Message)
+	n.AlerterType = fallback.AlerterType
+	n.AlerterName = fallback.AlerterName
+	return n
+}
+
+// policyFor is the retry policy for an alerter, the delivery config's with any of the alerter's overrides
+func policyFor(config types.DeliveryConfig, alerterType string, alerterName string) retryPolicy {
+	policy := config.RetryPolicy
+	for _, alerter := range config.Alerters {
+		if alerter.AlerterType != alerterType || alerter.AlerterName != alerterName {
+			continue
+		}
+		if alerter.Retries != 0 {
+			policy.Retries = alerter.Retries
+		}
+		if alerter.InitialBackoff != 0 {
+			policy.InitialBackoff = alerter.InitialBackoff
+		}
+		if alerter.MaxBackoff != 0 {
+			policy.MaxBackoff = alerter.MaxBackoff
+		}
+		if alerter.Timeout != 0 {
+			policy.Timeout = alerter.Timeout
+		}
+	}
+	retries := policy.Retries
+	if retries == 0 {
+		retries = defaultRetries
+	} else if retries < 0 {
+		retries = 0
+	}
+	return retryPolicy{
+		retries:        retries,
+		initialBackoff: seconds(policy.InitialBackoff, defaultInitialBackoff),
+		maxBackoff:     seconds(policy.MaxBackoff, defaultMaxBackoff),
+		timeout:        seconds(policy.Timeout, defaultTimeout),
+	}
+}
+
+// backoff is the wait before a retry: the initial backoff doubled for each earlier retry, up to the maximum,
+// of which a random half is taken off so alerters failing together don't retry together
+func backoff(policy retryPolicy, attempt int) time.Duration {
+	wait := policy.initialBackoff
+	for i := 1; i < attempt && wait < policy.maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > policy.maxBackoff {
+		wait = policy.maxBackoff
+	}
+	half := wait / 2
+	return wait - half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func seconds(value int64, defaultDuration time.Duration) time.Duration {
+	if value <= 0 {
+		return defaultDuration
+	}
+	return time.Duration(value) * time.Second
+}
@@ -0,0 +1,297 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// recorder is a SendFunc failing the first failures sends to each alerter
+type recorder struct {
+	mu       sync.Mutex
+	failures map[string]int
+	sent     []Notification
+	attempts map[string]int
+}
+
+func newRecorder(failures map[string]int) *recorder {
+	return &recorder{failures: failures, attempts: map[string]int{}}
+}
+
+func (r *recorder) send(_ context.Context, notification Notification, _ AlertersConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts[notification.AlerterName]++
+	if r.attempts[notification.AlerterName] <= r.failures[notification.AlerterName] {
+		return fmt.Errorf("attempt %d failed", r.attempts[notification.AlerterName])
+	}
+	r.sent = append(r.sent, notification)
+	return nil
+}
+
+func testQueue(send SendFunc) (*Queue, *[]time.Duration) {
+	sleeps := []time.Duration{}
+	q := NewQueue(send)
+	q.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	return q, &sleeps
+}
+
+func Test_Queue_retries(t *testing.T) {
+	r := newRecorder(map[string]int{"flaky": 2})
+	q, sleeps := testQueue(r.send)
+	q.Notify(Notification{AlerterType: "slack", AlerterName: "flaky", Message: "Pod web is failing checks"}, AlertersConfig{})
+	q.Close()
+
+	if r.attempts["flaky"] != 3 || len(r.sent) != 1 {
+		t.Errorf("notification should be sent on the third attempt, attempts: %d, sent: %v", r.attempts["flaky"], r.sent)
+	}
+	if len(*sleeps) != 2 {
+		t.Fatalf("expected a wait before each retry, waits: %v", *sleeps)
+	}
+	if (*sleeps)[0] < 500*time.Millisecond || (*sleeps)[0] > time.Second {
+		t.Errorf("first wait should be within half of the initial backoff, waited %s", (*sleeps)[0])
+	}
+	if (*sleeps)[1] < time.Second || (*sleeps)[1] > 2*time.Second {
+		t.Errorf("second wait should be within half of twice the initial backoff, waited %s", (*sleeps)[1])
+	}
+}
+
+func Test_Queue_dead_letter_and_fallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k8eraid-delivery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	deadLetterFile := filepath.Join(dir, "dead-letters.json")
+
+	config := AlertersConfig{
+		Delivery: DeliveryConfig{
+			RetryPolicy:    RetryPolicy{Retries: 1},
+			DeadLetterFile: deadLetterFile,
+			Fallback:       &AlerterRef{AlerterType: "smtp", AlerterName: "oncall-email"},
+			Alerters: []AlerterDeliveryConfig{
+				{AlerterType: "slack", AlerterName: "down", RetryPolicy: RetryPolicy{Retries: 2}},
+			},
+		},
+	}
+	r := newRecorder(map[string]int{"down": 10})
+	q, _ := testQueue(r.send)
+	q.Notify(Notification{AlerterType: "slack", AlerterName: "down", Message: "Pod web is failing checks"}, config)
+	// Wait for the fallback to be queued before closing
+	for {
+		r.mu.Lock()
+		sent := len(r.sent)
+		r.mu.Unlock()
+		if sent > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	q.Close()
+
+	if r.attempts["down"] != 3 {
+		t.Errorf("alerter override should allow 2 retries, attempts: %d", r.attempts["down"])
+	}
+	if len(r.sent) != 1 || r.sent[0].AlerterName != "oncall-email" ||
+		r.sent[0].Message != "Could not send to slack alerter down: Pod web is failing checks" {
+		t.Errorf("failed notification should go to the fallback alerter, sent: %v", r.sent)
+	}
+
+	data, err := ioutil.ReadFile(deadLetterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one dead letter, got: %s", data)
+	}
+	var letter DeadLetter
+	if err := json.Unmarshal([]byte(lines[0]), &letter); err != nil {
+		t.Fatal(err)
+	}
+	if letter.Notification.AlerterName != "down" || letter.Attempts != 3 || letter.Error != "attempt 3 failed" {
+		t.Errorf("unexpected dead letter: %+v", letter)
+	}
+}
+
+func Test_Queue_fallback_failure(t *testing.T) {
+	config := AlertersConfig{
+		Delivery: DeliveryConfig{
+			RetryPolicy: RetryPolicy{Retries: -1},
+			Fallback:    &AlerterRef{AlerterType: "smtp", AlerterName: "down"},
+		},
+	}
+	r := newRecorder(map[string]int{"down": 10})
+	q, sleeps := testQueue(r.send)
+	q.Notify(Notification{AlerterType: "smtp", AlerterName: "down"}, config)
+	q.Close()
+	if r.attempts["down"] != 1 || len(*sleeps) != 0 {
+		t.Errorf("negative retries should make one attempt, attempts: %d", r.attempts["down"])
+	}
+}
+
+func Test_Queue_Notify_does_not_block(t *testing.T) {
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	sent := []string{}
+	send := func(_ context.Context, notification Notification, _ AlertersConfig) error {
+		if notification.AlerterName == "slow" {
+			started <- struct{}{}
+			<-release
+		}
+		mu.Lock()
+		sent = append(sent, notification.AlerterName)
+		mu.Unlock()
+		return nil
+	}
+	config := AlertersConfig{Delivery: DeliveryConfig{QueueSize: 1}}
+	q, _ := testQueue(send)
+
+	done := make(chan struct{})
+	go func() {
+		q.Notify(Notification{AlerterType: "smtp", AlerterName: "slow"}, config)
+		<-started
+		// The first is being sent, the second waits in the queue and the third does not fit
+		q.Notify(Notification{AlerterType: "smtp", AlerterName: "slow"}, config)
+		q.Notify(Notification{AlerterType: "smtp", AlerterName: "slow"}, config)
+		q.Notify(Notification{AlerterType: "slack", AlerterName: "fast"}, config)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify should not wait for a slow alerter")
+	}
+	for {
+		mu.Lock()
+		n := len(sent)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if sent[0] != "fast" {
+		t.Errorf("a slow alerter should not hold up the others, sent: %v", sent)
+	}
+	close(release)
+	q.Close()
+	if len(sent) != 3 {
+		t.Errorf("a notification for a full queue should be dropped, sent: %v", sent)
+	}
+}
+
+func Test_Queue_Notify_coalesces_by_key(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	sent := []string{}
+	send := func(_ context.Context, notification Notification, _ AlertersConfig) error {
+		mu.Lock()
+		first := len(sent) == 0
+		sent = append(sent, notification.Message)
+		mu.Unlock()
+		if first {
+			started <- struct{}{}
+			<-release
+		}
+		return nil
+	}
+	config := AlertersConfig{Delivery: DeliveryConfig{QueueSize: 2}}
+	q, _ := testQueue(send)
+
+	q.Notify(Notification{AlerterType: "smtp", AlerterName: "slow", Key: "0123456789abcdef", Message: "poll 0"}, config)
+	<-started
+	// While the first is being sent, the alert is raised on many more polls, and another alert once
+	for poll := 1; poll <= 10; poll++ {
+		q.Notify(Notification{AlerterType: "smtp", AlerterName: "slow", Key: "0123456789abcdef", Message: fmt.Sprintf("poll %d", poll)}, config)
+	}
+	q.Notify(Notification{AlerterType: "smtp", AlerterName: "slow", Key: "fedcba9876543210", Message: "other alert"}, config)
+	close(release)
+	q.Close()
+
+	expected := []string{"poll 0", "poll 10", "other alert"}
+	if strings.Join(sent, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected a queued notification to be replaced by a later one with its key, sent: %v, expected: %v", sent, expected)
+	}
+}
+
+func Test_Queue_attempt_timeout(t *testing.T) {
+	q := NewQueue(func(ctx context.Context, _ Notification, _ AlertersConfig) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := q.attempt(item{}, 10*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("a send taking longer than the timeout should fail, got: %v", err)
+	}
+}
+
+func Test_Queue_attempt_waits_for_send(t *testing.T) {
+	returned := false
+	q := NewQueue(func(ctx context.Context, _ Notification, _ AlertersConfig) error {
+		// An alerter noticing the deadline late must still finish before the retry
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		returned = true
+		return ctx.Err()
+	})
+	q.attempt(item{}, 10*time.Millisecond)
+	if !returned {
+		t.Errorf("attempt should wait for the send to return, so a retry never runs beside it")
+	}
+}
+
+func Test_policyFor(t *testing.T) {
+	config := DeliveryConfig{
+		RetryPolicy: RetryPolicy{MaxBackoff: 10},
+		Alerters: []AlerterDeliveryConfig{
+			{AlerterType: "smtp", AlerterName: "mail", RetryPolicy: RetryPolicy{Retries: 5, Timeout: 60}},
+		},
+	}
+	tests := []struct {
+		alerterName string
+		expected    retryPolicy
+	}{
+		{"other", retryPolicy{retries: 3, initialBackoff: time.Second, maxBackoff: 10 * time.Second, timeout: 30 * time.Second}},
+		{"mail", retryPolicy{retries: 5, initialBackoff: time.Second, maxBackoff: 10 * time.Second, timeout: time.Minute}},
+	}
+	for _, test := range tests {
+		if policy := policyFor(config, "smtp", test.alerterName); policy != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.alerterName, test.expected, policy)
+		}
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	policy := retryPolicy{initialBackoff: time.Second, maxBackoff: 10 * time.Second}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		wait := backoff(policy, attempt+1)
+		if wait < max/2 || wait > max {
+			t.Errorf("attempt %d: expected a wait between %s and %s, got %s", attempt+1, max/2, max, wait)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatch
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// Acknowledge mutes a firing alert until ack.Until. The fingerprint is either that of an alert, or the key of
+// a group notification, which acknowledges every alert in the group. It returns the number of alerts acknowledged.
+func (d *Dispatcher) Acknowledge(fingerprint string, ack types.Ack) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ack.At.IsZero() {
+		ack.At = d.now()
+	}
+	if !ack.Until.After(ack.At) {
+		return 0, fmt.Errorf("acknowledgement of %s ends at %s, before it starts", fingerprint, ack.Until.Format(time.RFC3339))
+	}
+
+	fingerprints := []string{fingerprint}
+	for key, g := range d.groups {
+		if groupFingerprint(key) == fingerprint {
+			fingerprints = []string{}
+			for alertFingerprint := range g.alerts {
+				fingerprints = append(fingerprints, alertFingerprint)
+			}
+			break
+		}
+	}
+
+	acknowledged := 0
+	for _, alertFingerprint := range fingerprints {
+		state, ok := d.states[alertFingerprint]
+		if !ok || state.Status != types.AlertFiring {
+			continue
+		}
+		// Every alert gets its own copy, so acknowledging one again leaves the others alone
+		alertAck := ack
+		state.Ack = &alertAck
+		acknowledged++
+	}
+	if acknowledged == 0 {
+		return 0, fmt.Errorf("no firing alert with fingerprint %s", fingerprint)
+	}
+	return acknowledged, nil
+}
+
+// ackNote describes an acknowledgement for the end of a notification message
+func ackNote(ack *types.Ack) string {
+	if ack == nil {
+		return ""
+	}
+	note := " (acknowledged"
+	if ack.By != "" {
+		note += " by " + ack.By
+	}
+	note += " until " + ack.Until.UTC().Format("2006-01-02 15:04 MST")
+	if ack.Comment != "" {
+		note += ": " + ack.Comment
+	}
+	return note + ")"
+}
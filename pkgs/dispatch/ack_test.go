@@ -0,0 +1,116 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatch
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+func Test_Dispatcher_ack_ungrouped(t *testing.T) {
+	d, now, messages := testDispatcher()
+	alert := testAlert("default", "test-pod")
+	alert.AlerterName = "not-grouped"
+	d.Alert(alert, testGroupingConfig)
+
+	acked, err := d.Acknowledge(alert.Fingerprint(), Ack{By: "alice", Comment: "looking", Until: now.Add(time.Hour)})
+	if err != nil || acked != 1 {
+		t.Fatalf("expected the alert to be acknowledged, got %d, %v", acked, err)
+	}
+
+	*messages = []sent{}
+	*now = now.Add(30 * time.Second)
+	d.Alert(alert, testGroupingConfig)
+	if len(*messages) != 0 {
+		t.Fatalf("acknowledged alert should not be sent again, sent: %v", *messages)
+	}
+
+	*now = now.Add(time.Hour)
+	d.Alert(alert, testGroupingConfig)
+	if len(*messages) != 1 || !strings.Contains((*messages)[0].message, "(acknowledged by alice until 2019-06-01 13:00 UTC: looking)") {
+		t.Fatalf("alert should be sent again once the acknowledgement expires, with it in the message, sent: %v", *messages)
+	}
+
+	*messages = []sent{}
+	*now = now.Add(2 * time.Minute)
+	d.Flush()
+	if len(*messages) != 1 || !(*messages)[0].resolved || !strings.Contains((*messages)[0].message, "acknowledged by alice") {
+		t.Errorf("expected a resolved notification with the acknowledgement, sent: %v", *messages)
+	}
+
+	// A new firing period starts unacknowledged
+	d.Alert(alert, testGroupingConfig)
+	for _, state := range d.States() {
+		if state.Status == AlertFiring && state.Ack != nil {
+			t.Errorf("alert firing again should not keep its old acknowledgement: %+v", state.Ack)
+		}
+	}
+}
+
+func Test_Dispatcher_ack_group(t *testing.T) {
+	d, now, messages := testDispatcher()
+	poll := func() {
+		d.Alert(testAlert("default", "a"), testGroupingConfig)
+		d.Alert(testAlert("default", "b"), testGroupingConfig)
+	}
+	poll()
+	*now = now.Add(30 * time.Second)
+	poll()
+	d.Flush()
+	if len(*messages) != 1 {
+		t.Fatalf("expected one group message, sent: %v", *messages)
+	}
+
+	key, _ := groupKey(testAlert("default", "a"), testGroupingConfig.Grouping[0])
+	acked, err := d.Acknowledge(groupFingerprint(key), Ack{By: "bob", Until: now.Add(24 * time.Hour)})
+	if err != nil || acked != 2 {
+		t.Fatalf("acknowledging a group should acknowledge its alerts, got %d, %v", acked, err)
+	}
+
+	// A new alert in an acknowledged group is still sent, by itself
+	*messages = []sent{}
+	*now = now.Add(300 * time.Second)
+	poll()
+	d.Alert(testAlert("default", "c"), testGroupingConfig)
+	d.Flush()
+	if len(*messages) != 1 || !strings.HasPrefix((*messages)[0].message, "1 alert for") {
+		t.Errorf("expected only the new alert to be sent, sent: %v", *messages)
+	}
+}
+
+func Test_Dispatcher_ack_errors(t *testing.T) {
+	d, now, _ := testDispatcher()
+	alert := testAlert("default", "test-pod")
+	d.Alert(alert, testGroupingConfig)
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		until       time.Time
+	}{
+		{"unknown fingerprint", "0123456789abcdef", now.Add(time.Hour)},
+		{"until in the past", alert.Fingerprint(), now.Add(-time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := d.Acknowledge(tt.fingerprint, Ack{Until: tt.until}); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dispatch sits between the checks and the alerters. Alerts for alerters with a grouping
+// config are batched into groups and sent as one message per group, and alerts muted by an inhibition
+// rule are dropped, in the same way as Alertmanager.
+package dispatch
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// Defaults for unset grouping intervals, the same as Alertmanager's
+const (
+	defaultGroupWait      = 30 * time.Second
+	defaultGroupInterval  = 5 * time.Minute
+	defaultRepeatInterval = 4 * time.Hour
+)
+
+// Resolved alerts are remembered for this long, so their state survives a restart shortly after they resolve
+const resolvedRetention = time.Hour
+
+// NotifyFunc sends a notification with an alerter
+type NotifyFunc func(notification types.Notification, config types.AlertersConfig)
+
+// Dispatcher groups alerts and sends them with a NotifyFunc
+type Dispatcher struct {
+	mu     sync.Mutex
+	notify NotifyFunc
+	// Alerts are raised again on every poll they keep failing, those not raised for this long are resolved
+	resolveTimeout time.Duration
+	groups         map[string]*group
+	// The state of every alert, whichever alerter it is for, by fingerprint. Firing alerts are also
+	// the sources for inhibition rules.
+	states map[string]*types.AlertState
+	// The latest alerters config, for resolving alerts that are no longer raised
+	config types.AlertersConfig
+	now    func() time.Time
+}
+
+type group struct {
+	alerterType  string
+	alerterName  string
+	labels       []string
+	grouping     types.GroupingConfig
+	config       types.AlertersConfig
+	alerts       map[string]*groupedAlert
+	nextFlush    time.Time
+	lastNotified time.Time
+	// severity of the last notification, for the resolved notification
+	severity string
+	// resolved holds the sent alerts that have left the group, for the resolved notification
+	resolved []types.Alert
+}
+
+type groupedAlert struct {
+	alert    types.Alert
+	lastSeen time.Time
+	notified bool
+}
+
+type notification struct {
+	notification types.Notification
+	config       types.AlertersConfig
+}
+
+// NewDispatcher creates a Dispatcher sending messages with notify
+func NewDispatcher(notify NotifyFunc, resolveTimeout time.Duration) *Dispatcher {
+	return &Dispatcher{
+		notify:         notify,
+		resolveTimeout: resolveTimeout,
+		groups:         map[string]*group{},
+		states:         map[string]*types.AlertState{},
+		now:            time.Now,
+	}
+}
+
+// Alert takes an alert from the checks. Alerts for alerters without a grouping config are sent straight away,
+// unless they are inhibited or acknowledged.
+func (d *Dispatcher) Alert(alert types.Alert, config types.AlertersConfig) {
+	d.mu.Lock()
+	now := d.now()
+	d.config = config
+	fingerprint := alert.Fingerprint()
+	state := d.observe(fingerprint, alert, now)
+	alert.StartsAt = state.FirstSeen
+
+	grouping, ok := findGrouping(config, alert.AlerterType, alert.AlerterName)
+	if !ok {
+		muted := d.inhibited(fingerprint, config.InhibitRules, now) || state.Ack.Active(now)
+		if !muted {
+			state.LastNotified = now
+		}
+		n := alertNotification(state, false)
+		d.mu.Unlock()
+		if !muted {
+			d.notify(n, config)
+		}
+		return
+	}
+	defer d.mu.Unlock()
+
+	key, labels := groupKey(alert, grouping)
+	g, ok := d.groups[key]
+	if !ok {
+		g = &group{
+			alerterType: alert.AlerterType,
+			alerterName: alert.AlerterName,
+			labels:      labels,
+			alerts:      map[string]*groupedAlert{},
+			nextFlush:   now.Add(interval(grouping.GroupWait, defaultGroupWait)),
+		}
+		d.groups[key] = g
+	}
+	// Keep the latest config, so reloads apply to existing groups
+	g.grouping = grouping
+	g.config = config
+
+	if existing, ok := g.alerts[fingerprint]; ok {
+		existing.alert = alert
+		existing.lastSeen = now
+	} else {
+		// An alert already sent before a restart joins its group as sent, so it is not sent again as new
+		notified := !state.LastNotified.IsZero()
+		g.alerts[fingerprint] = &groupedAlert{alert: alert, lastSeen: now, notified: notified}
+		if notified && state.LastNotified.After(g.lastNotified) {
+			g.lastNotified = state.LastNotified
+		}
+	}
+}
+
+// observe records that an alert was raised, starting a new firing period if it was resolved. The caller must hold d.mu.
+func (d *Dispatcher) observe(fingerprint string, alert types.Alert, now time.Time) *types.AlertState {
+	state, ok := d.states[fingerprint]
+	if !ok || state.Status != types.AlertFiring {
+		state = &types.AlertState{
+			Fingerprint: fingerprint,
+			Status:      types.AlertFiring,
+			FirstSeen:   now,
+		}
+		d.states[fingerprint] = state
+	}
+	state.Alert = alert
+	state.Alert.StartsAt = state.FirstSeen
+	state.Labels = alert.LabelSet()
+	state.LastSeen = now
+	return state
+}
+
+// States returns a copy of the state of every alert, sorted by fingerprint
+func (d *Dispatcher) States() []types.AlertState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	states := []types.AlertState{}
+	for _, state := range d.states {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Fingerprint < states[j].Fingerprint })
+	return states
+}
+
+// Restore loads alert states saved by States, such as after a restart. Firing alerts are treated as just
+// seen, giving the checks until the resolve timeout to raise them again before they are resolved.
+func (d *Dispatcher) Restore(states []types.AlertState) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	for i := range states {
+		state := states[i]
+		if state.Status == types.AlertFiring {
+			state.LastSeen = now
+		}
+		d.states[state.Fingerprint] = &state
+	}
+}
+
+// Flush sends a message for every group that is due one. A group is due group_wait after it is created,
+// then every group_interval while it has alerts that have not been sent, or every repeat_interval otherwise.
+// Inhibited alerts are left out of the message, and are sent as new alerts if the inhibition ends.
+// Acknowledged alerts are left out until the acknowledgement expires.
+// Alerts sent straight away are resolved one by one, grouped alerts once their whole group has resolved.
+func (d *Dispatcher) Flush() {
+	d.mu.Lock()
+	now := d.now()
+	notifications := []notification{}
+	for fingerprint, state := range d.states {
+		if state.Status == types.AlertFiring && now.Sub(state.LastSeen) > d.resolveTimeout {
+			state.Status = types.AlertResolved
+			state.ResolvedAt = now
+			_, grouped := findGrouping(d.config, state.Alert.AlerterType, state.Alert.AlerterName)
+			if !grouped && !state.LastNotified.IsZero() {
+				notifications = append(notifications, notification{
+					notification: alertNotification(state, true),
+					config:       d.config,
+				})
+			}
+		}
+		if state.Status == types.AlertResolved && now.Sub(state.ResolvedAt) > resolvedRetention {
+			delete(d.states, fingerprint)
+		}
+	}
+
+	for key, g := range d.groups {
+		for fingerprint, a := range g.alerts {
+			if now.Sub(a.lastSeen) > d.resolveTimeout {
+				if a.notified {
+					g.resolved = append(g.resolved, a.alert)
+				}
+				delete(g.alerts, fingerprint)
+			}
+		}
+		if len(g.alerts) == 0 {
+			delete(d.groups, key)
+			if !g.lastNotified.IsZero() {
+				notifications = append(notifications, notification{
+					notification: types.Notification{
+						AlerterType: g.alerterType,
+						AlerterName: g.alerterName,
+						Key:         groupFingerprint(key),
+						Message:     resolvedGroupMessage(g.labels),
+						Severity:    g.severity,
+						Alerts:      g.resolved,
+						Resolved:    true,
+					},
+					config: g.config,
+				})
+			}
+			continue
+		}
+		if now.Before(g.nextFlush) {
+			continue
+		}
+		g.nextFlush = now.Add(interval(g.grouping.GroupInterval, defaultGroupInterval))
+
+		active := map[string]*groupedAlert{}
+		pending := false
+		for fingerprint, a := range g.alerts {
+			if d.inhibited(fingerprint, g.config.InhibitRules, now) {
+				a.notified = false
+				d.states[fingerprint].LastNotified = time.Time{}
+				continue
+			}
+			if d.states[fingerprint].Ack.Active(now) {
+				continue
+			}
+			active[fingerprint] = a
+			if !a.notified {
+				pending = true
+			}
+		}
+		if len(active) == 0 {
+			continue
+		}
+		if !pending && now.Sub(g.lastNotified) < interval(g.grouping.RepeatInterval, defaultRepeatInterval) {
+			continue
+		}
+		for fingerprint, a := range active {
+			a.notified = true
+			d.states[fingerprint].LastNotified = now
+		}
+		alerts := sortedAlerts(active, d.states)
+		g.lastNotified = now
+		g.severity = types.HighestSeverity(alerts)
+		notifications = append(notifications, notification{
+			notification: types.Notification{
+				AlerterType: g.alerterType,
+				AlerterName: g.alerterName,
+				Key:         groupFingerprint(key),
+				Message:     groupMessage(g.labels, alerts),
+				Severity:    g.severity,
+				Alerts:      alerts,
+			},
+			config: g.config,
+		})
+	}
+	d.mu.Unlock()
+
+	// Alerters can be slow, so send without holding the lock
+	for _, n := range notifications {
+		d.notify(n.notification, n.config)
+	}
+}
+
+// Run flushes groups every interval, until stop is closed
+func (d *Dispatcher) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.Flush()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func findGrouping(config types.AlertersConfig, alerterType string, alerterName string) (types.GroupingConfig, bool) {
+	for _, grouping := range config.Grouping {
+		if grouping.AlerterType == alerterType && grouping.AlerterName == alerterName {
+			return grouping, true
+		}
+	}
+	return types.GroupingConfig{}, false
+}
+
+// groupKey returns the key of the group an alert belongs to, and the labels describing that group.
+// Grouping by "..." puts every distinct alert in its own group.
+func groupKey(alert types.Alert, grouping types.GroupingConfig) (string, []string) {
+	alertLabels := alert.LabelSet()
+	names := grouping.GroupBy
+	for _, name := range grouping.GroupBy {
+		if name == "..." {
+			names = []string{}
+			for labelName := range alertLabels {
+				names = append(names, labelName)
+			}
+			sort.Strings(names)
+			break
+		}
+	}
+
+	labels := []string{}
+	for _, name := range names {
+		labels = append(labels, fmt.Sprintf("%s=%q", name, alertLabels[name]))
+	}
+	key := fmt.Sprintf("%s/%s/{%s}", alert.AlerterType, alert.AlerterName, strings.Join(labels, ","))
+	return key, labels
+}
+
+// alertNotification is the notification for an alert sent by itself, keyed by its fingerprint
+func alertNotification(state *types.AlertState, resolved bool) types.Notification {
+	alert := state.Alert
+	alert.Message += ackNote(state.Ack)
+	alerts := []types.Alert{alert}
+	return types.Notification{
+		AlerterType: alert.AlerterType,
+		AlerterName: alert.AlerterName,
+		Key:         state.Fingerprint,
+		Message:     alert.Message,
+		Severity:    types.HighestSeverity(alerts),
+		Alerts:      alerts,
+		Resolved:    resolved,
+	}
+}
+
+// groupFingerprint identifies a group in notifications, in the same form as alert fingerprints
+func groupFingerprint(key string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(key)))[:16]
+}
+
+// sortedAlerts returns the alerts of a group, sorted by message, with the messages of acknowledged alerts
+// saying so
+func sortedAlerts(grouped map[string]*groupedAlert, states map[string]*types.AlertState) []types.Alert {
+	alerts := []types.Alert{}
+	for fingerprint, a := range grouped {
+		alert := a.alert
+		if state, ok := states[fingerprint]; ok {
+			alert.Message += ackNote(state.Ack)
+		}
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Message < alerts[j].Message })
+	return alerts
+}
+
+func groupMessage(groupLabels []string, alerts []types.Alert) string {
+	messages := []string{}
+	for _, alert := range alerts {
+		messages = append(messages, alert.Message)
+	}
+
+	header := fmt.Sprintf("%d alerts", len(messages))
+	if len(messages) == 1 {
+		header = "1 alert"
+	}
+	if len(groupLabels) > 0 {
+		header = fmt.Sprintf("%s for %s", header, strings.Join(groupLabels, ", "))
+	}
+	lines := []string{header + ":"}
+	for _, message := range messages {
+		lines = append(lines, "- "+message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func resolvedGroupMessage(groupLabels []string) string {
+	if len(groupLabels) == 0 {
+		return "Resolved: all alerts"
+	}
+	return fmt.Sprintf("Resolved: all alerts for %s", strings.Join(groupLabels, ", "))
+}
+
+func interval(seconds int64, defaultInterval time.Duration) time.Duration {
+	if seconds <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(seconds) * time.Second
+}
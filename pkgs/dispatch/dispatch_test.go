@@ -0,0 +1,232 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatch
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+type sent struct {
+	alerterName string
+	message     string
+	resolved    bool
+	alerts      int
+}
+
+func testDispatcher() (*Dispatcher, *time.Time, *[]sent) {
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	messages := []sent{}
+	notify := func(notification Notification, _ AlertersConfig) {
+		messages = append(messages, sent{
+			alerterName: notification.AlerterName,
+			message:     notification.Message,
+			resolved:    notification.Resolved,
+			alerts:      len(notification.Alerts),
+		})
+	}
+	d := NewDispatcher(notify, time.Minute)
+	d.now = func() time.Time { return now }
+	return d, &now, &messages
+}
+
+func testAlert(namespace string, name string) Alert {
+	return Alert{
+		AlerterType: "smtp",
+		AlerterName: "grouped",
+		Rule:        "pods/*",
+		Check:       "PodFailures",
+		Kind:        "Pod",
+		Namespace:   namespace,
+		Name:        name,
+		Message:     "Pod " + name + " in namespace " + namespace + " is failing checks",
+	}
+}
+
+var testGroupingConfig = AlertersConfig{
+	Grouping: []GroupingConfig{
+		{
+			AlerterType:    "smtp",
+			AlerterName:    "grouped",
+			GroupBy:        []string{"namespace"},
+			GroupWait:      30,
+			GroupInterval:  300,
+			RepeatInterval: 3600,
+		},
+	},
+}
+
+func Test_Dispatcher_ungrouped(t *testing.T) {
+	d, _, messages := testDispatcher()
+	alert := testAlert("default", "test-pod")
+	alert.AlerterName = "not-grouped"
+	d.Alert(alert, testGroupingConfig)
+	if len(*messages) != 1 || (*messages)[0].message != alert.Message {
+		t.Errorf("alert for an alerter without grouping should be sent straight away, sent: %v", *messages)
+	}
+}
+
+func Test_Dispatcher_grouping(t *testing.T) {
+	d, now, messages := testDispatcher()
+	// poll raises the same alerts, as every poll does while they keep failing
+	poll := func(alerts ...Alert) {
+		for _, alert := range alerts {
+			d.Alert(alert, testGroupingConfig)
+		}
+	}
+	advance := func(d time.Duration) {
+		*now = now.Add(d)
+	}
+
+	poll(testAlert("default", "a"), testAlert("default", "b"), testAlert("other", "c"))
+	d.Flush()
+	if len(*messages) != 0 {
+		t.Fatalf("nothing should be sent before group_wait, sent: %v", *messages)
+	}
+
+	advance(30 * time.Second)
+	poll(testAlert("default", "a"), testAlert("default", "b"), testAlert("other", "c"))
+	d.Flush()
+	if len(*messages) != 2 {
+		t.Fatalf("expected one message per namespace after group_wait, sent: %v", *messages)
+	}
+	for _, m := range *messages {
+		if strings.Contains(m.message, `namespace="default"`) && !strings.HasPrefix(m.message, "2 alerts for") {
+			t.Errorf("expected both default namespace alerts in one message, got: %s", m.message)
+		}
+	}
+
+	// Nothing new within group_interval or repeat_interval: nothing sent
+	*messages = []sent{}
+	advance(300 * time.Second)
+	poll(testAlert("default", "a"), testAlert("default", "b"), testAlert("other", "c"))
+	d.Flush()
+	if len(*messages) != 0 {
+		t.Fatalf("nothing should be sent without new alerts before repeat_interval, sent: %v", *messages)
+	}
+
+	// A new alert is sent with the rest of its group at the next group_interval
+	poll(testAlert("default", "a"), testAlert("default", "b"), testAlert("default", "d"), testAlert("other", "c"))
+	d.Flush()
+	if len(*messages) != 0 {
+		t.Fatalf("nothing should be sent before group_interval, sent: %v", *messages)
+	}
+	advance(300 * time.Second)
+	poll(testAlert("default", "a"), testAlert("default", "b"), testAlert("default", "d"), testAlert("other", "c"))
+	d.Flush()
+	if len(*messages) != 1 || !strings.HasPrefix((*messages)[0].message, `3 alerts for namespace="default"`) {
+		t.Fatalf("expected the default namespace group to be sent again with its new alert, sent: %v", *messages)
+	}
+
+	// Alerts that stop being raised resolve, and empty groups are dropped
+	advance(2 * time.Minute)
+	d.Flush()
+	if len(d.groups) != 0 {
+		t.Errorf("expected groups to be dropped once their alerts resolved, have %d", len(d.groups))
+	}
+}
+
+func Test_Dispatcher_repeated_alert(t *testing.T) {
+	// A flapping pod is raised as Flapping on every poll while it flaps
+	flapping := testAlert("default", "web-0")
+	flapping.Check = "Flapping"
+	for _, alerterName := range []string{"not-grouped", "grouped"} {
+		d, now, messages := testDispatcher()
+		flapping.AlerterName = alerterName
+		for poll := 0; poll < 4; poll++ {
+			d.Alert(flapping, testGroupingConfig)
+			d.Flush()
+			*now = now.Add(30 * time.Second)
+		}
+		if alerterName == "not-grouped" && len(*messages) != 4 {
+			t.Errorf("expected an alerter without grouping to be sent the alert on every poll, sent: %v", *messages)
+		}
+		if alerterName == "grouped" && len(*messages) != 1 {
+			t.Errorf("expected a grouped alerter to be sent the alert once until repeat_interval, sent: %v", *messages)
+		}
+	}
+}
+
+func Test_groupKey_all_labels(t *testing.T) {
+	grouping := GroupingConfig{GroupBy: []string{"..."}}
+	a, _ := groupKey(testAlert("default", "a"), grouping)
+	b, _ := groupKey(testAlert("default", "b"), grouping)
+	if a == b {
+		t.Errorf("grouping by ... should put every alert in its own group, both got %s", a)
+	}
+}
+
+func Test_Dispatcher_restore(t *testing.T) {
+	d, now, messages := testDispatcher()
+	alert := testAlert("default", "test-pod")
+	d.Alert(alert, testGroupingConfig)
+	*now = now.Add(30 * time.Second)
+	d.Flush()
+	if len(*messages) != 1 {
+		t.Fatalf("expected the group to be sent once, sent: %v", *messages)
+	}
+	saved := d.States()
+	if len(saved) != 1 || saved[0].Status != AlertFiring || !saved[0].LastNotified.Equal(*now) {
+		t.Fatalf("expected one firing, notified alert state, got: %v", saved)
+	}
+
+	// A restarted dispatcher does not send the alert again as new
+	restarted, restartedNow, restartedMessages := testDispatcher()
+	*restartedNow = now.Add(5 * time.Minute)
+	restarted.Restore(saved)
+	restarted.Alert(alert, testGroupingConfig)
+	*restartedNow = restartedNow.Add(30 * time.Second)
+	restarted.Flush()
+	if len(*restartedMessages) != 0 {
+		t.Errorf("alert sent before the restart should not be sent again, sent: %v", *restartedMessages)
+	}
+
+	// Once the alert is no longer raised it is resolved
+	*restartedNow = restartedNow.Add(2 * time.Minute)
+	restarted.Flush()
+	states := restarted.States()
+	if len(states) != 1 || states[0].Status != AlertResolved {
+		t.Errorf("expected the alert to be resolved, got: %v", states)
+	}
+}
+
+func Test_Dispatcher_resolve(t *testing.T) {
+	d, now, messages := testDispatcher()
+	alert := testAlert("default", "test-pod")
+	alert.AlerterName = "not-grouped"
+	d.Alert(alert, testGroupingConfig)
+	d.Alert(testAlert("default", "grouped-pod"), testGroupingConfig)
+	*now = now.Add(30 * time.Second)
+	d.Flush()
+	if len(*messages) != 2 {
+		t.Fatalf("expected the alert and the group to be sent, sent: %v", *messages)
+	}
+
+	// Neither is raised again, so both resolve
+	*messages = []sent{}
+	*now = now.Add(2 * time.Minute)
+	d.Flush()
+	if len(*messages) != 2 || !(*messages)[0].resolved || !(*messages)[1].resolved {
+		t.Errorf("expected a resolved notification for the alert and the group, sent: %v", *messages)
+	}
+	for _, m := range *messages {
+		if m.alerts != 1 {
+			t.Errorf("resolved notifications should carry the alerts they resolve, so alerters can end each one, sent: %v", m)
+		}
+	}
+}
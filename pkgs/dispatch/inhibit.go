@@ -0,0 +1,66 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatch
+
+import (
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+// inhibited reports whether the firing alert with fingerprint is muted by another firing alert.
+// The caller must hold d.mu.
+func (d *Dispatcher) inhibited(fingerprint string, rules []types.InhibitRule, now time.Time) bool {
+	target, ok := d.states[fingerprint]
+	if !ok {
+		return false
+	}
+	for _, rule := range rules {
+		if !matches(target.Labels, rule.TargetMatch) {
+			continue
+		}
+		for sourceFingerprint, source := range d.states {
+			// An alert matching both sides of a rule must not mute itself
+			if sourceFingerprint == fingerprint || source.Status != types.AlertFiring || now.Sub(source.LastSeen) > d.resolveTimeout {
+				continue
+			}
+			if matches(source.Labels, rule.SourceMatch) && equalLabels(source.Labels, target.Labels, rule.Equal) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches reports whether labels has every label in match, with the same value
+func matches(labels map[string]string, match map[string]string) bool {
+	for name, value := range match {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// equalLabels reports whether two label sets agree on every named label. A label missing from
+// both counts as equal, as in Alertmanager.
+func equalLabels(a map[string]string, b map[string]string, names []string) bool {
+	for _, name := range names {
+		if a[name] != b[name] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatch
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+var testInhibitRules = []InhibitRule{
+	{
+		SourceMatch: map[string]string{"alertname": "NodeNotReady"},
+		TargetMatch: map[string]string{"alertname": "PodFailures"},
+		Equal:       []string{"node"},
+	},
+}
+
+func nodeAlert(node string) Alert {
+	return Alert{
+		AlerterType: "smtp",
+		AlerterName: "nodes",
+		Rule:        "nodes/*",
+		Check:       "NodeNotReady",
+		Kind:        "Node",
+		Name:        node,
+		Message:     "Node " + node + " is NotReady",
+		Labels:      map[string]string{"node": node},
+	}
+}
+
+func podOnNode(name string, node string) Alert {
+	alert := testAlert("default", name)
+	alert.Labels = map[string]string{"node": node}
+	return alert
+}
+
+func Test_Dispatcher_inhibit_ungrouped(t *testing.T) {
+	d, _, messages := testDispatcher()
+	config := AlertersConfig{InhibitRules: testInhibitRules}
+
+	d.Alert(nodeAlert("worker-1"), config)
+	d.Alert(podOnNode("on-broken-node", "worker-1"), config)
+	d.Alert(podOnNode("on-healthy-node", "worker-2"), config)
+
+	if len(*messages) != 2 {
+		t.Fatalf("expected the node alert and the pod on the healthy node to be sent, sent: %v", *messages)
+	}
+	for _, m := range *messages {
+		if strings.Contains(m.message, "on-broken-node") {
+			t.Errorf("alert for a pod on the NotReady node should be inhibited, sent: %v", *messages)
+		}
+	}
+}
+
+func Test_Dispatcher_inhibit_grouped(t *testing.T) {
+	d, now, messages := testDispatcher()
+	config := testGroupingConfig
+	config.InhibitRules = testInhibitRules
+
+	d.Alert(podOnNode("on-broken-node", "worker-1"), config)
+	d.Alert(podOnNode("on-healthy-node", "worker-2"), config)
+	// The node alert arrives after the pod alerts, but before the group is flushed
+	d.Alert(nodeAlert("worker-1"), config)
+	*messages = []sent{}
+
+	*now = now.Add(30 * time.Second)
+	d.Flush()
+	if len(*messages) != 1 || strings.Contains((*messages)[0].message, "on-broken-node") {
+		t.Fatalf("grouped message should leave out the inhibited alert, sent: %v", *messages)
+	}
+	if !strings.HasPrefix((*messages)[0].message, "1 alert for") {
+		t.Errorf("grouped message should count only the alerts sent, got: %s", (*messages)[0].message)
+	}
+
+	// The node recovers, its alert is no longer raised and the pod alert is sent at the next interval
+	*messages = []sent{}
+	*now = now.Add(2 * time.Minute)
+	d.Alert(podOnNode("on-broken-node", "worker-1"), config)
+	d.Alert(podOnNode("on-healthy-node", "worker-2"), config)
+	*now = now.Add(3 * time.Minute)
+	d.Alert(podOnNode("on-broken-node", "worker-1"), config)
+	d.Alert(podOnNode("on-healthy-node", "worker-2"), config)
+	d.Flush()
+	firing := []sent{}
+	for _, m := range *messages {
+		if !m.resolved {
+			firing = append(firing, m)
+		}
+	}
+	if len(firing) != 1 || !strings.Contains(firing[0].message, "on-broken-node") {
+		t.Errorf("alert should be sent once its inhibition ends, sent: %v", *messages)
+	}
+}
+
+func Test_equalLabels(t *testing.T) {
+	a := map[string]string{"node": "worker-1", "namespace": "default"}
+	b := map[string]string{"node": "worker-1"}
+	if !equalLabels(a, b, []string{"node", "zone"}) {
+		t.Errorf("labels equal or missing from both should match")
+	}
+	if equalLabels(a, b, []string{"namespace"}) {
+		t.Errorf("label missing from one side should not match")
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package expressions compiles and evaluates the CEL expressions that can be set on any alert rule.
+//
+// Expressions are evaluated once per object and poll. They can refer to the full object as it would be
+// serialized to JSON as "object", the object as it was observed on the previous poll as "previous" (an
+// empty map the first time it is seen), and the time of the poll as the timestamp "now". An expression
+// must evaluate to a bool, and the rule alerts while it is true.
+package expressions
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+)
+
+var (
+	env      *cel.Env
+	envErr   error
+	envOnce  sync.Once
+	mu       sync.Mutex
+	compiled = map[string]*Expression{}
+)
+
+// Expression is a compiled and type-checked CEL expression
+type Expression struct {
+	Source  string
+	program cel.Program
+}
+
+func celEnv() (*cel.Env, error) {
+	envOnce.Do(func() {
+		env, envErr = cel.NewEnv(
+			cel.Declarations(
+				decls.NewIdent("object", decls.Dyn, nil),
+				decls.NewIdent("previous", decls.Dyn, nil),
+				decls.NewIdent("now", decls.Timestamp, nil),
+			),
+		)
+	})
+	return env, envErr
+}
+
+// Compile parses and type-checks source. Compiled expressions are cached, so rules sharing
+// an expression, or polls after the config has been validated, do not compile it again.
+func Compile(source string) (*Expression, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if expression, ok := compiled[source]; ok {
+		return expression, nil
+	}
+
+	e, err := celEnv()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create CEL environment: %s", err.Error())
+	}
+	ast, issues := e.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	// Fields of object and previous are dynamic, so their type is only known when evaluating
+	if !proto.Equal(ast.ResultType(), decls.Bool) && !proto.Equal(ast.ResultType(), decls.Dyn) {
+		return nil, fmt.Errorf("expression must evaluate to a bool, not %s", ast.ResultType().String())
+	}
+	program, err := e.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	expression := &Expression{Source: source, program: program}
+	compiled[source] = expression
+	return expression, nil
+}
+
+// Evaluate reports whether the expression is true for object
+func (e *Expression) Evaluate(object map[string]interface{}, previous map[string]interface{}, now time.Time) (bool, error) {
+	if previous == nil {
+		previous = map[string]interface{}{}
+	}
+	timestamp, err := ptypes.TimestampProto(now)
+	if err != nil {
+		return false, err
+	}
+	out, _, err := e.program.Eval(map[string]interface{}{
+		"object":   object,
+		"previous": previous,
+		"now":      timestamp,
+	})
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression evaluated to %v, not a bool", out.Value())
+	}
+	return result, nil
+}
+
+// Validate compiles every expression in config, so mistakes are reported when the config is loaded
+func Validate(config *types.ConfigRules) error {
+	type rule struct {
+		kind       string
+		name       string
+		expression string
+	}
+	rules := []rule{}
+	for _, spec := range config.Deployments {
+		rules = append(rules, rule{"deployment", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.Pods {
+		rules = append(rules, rule{"pod", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.Daemonsets {
+		rules = append(rules, rule{"daemonset", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.Nodes {
+		rules = append(rules, rule{"node", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.HPAs {
+		rules = append(rules, rule{"HPA", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.PDBs {
+		rules = append(rules, rule{"PDB", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.Services {
+		rules = append(rules, rule{"service", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.Ingresses {
+		rules = append(rules, rule{"ingress", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.Certificates {
+		rules = append(rules, rule{"certificate", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.Quotas {
+		rules = append(rules, rule{"quota", spec.Name, spec.Expression})
+	}
+	for _, spec := range config.Generic {
+		rules = append(rules, rule{"generic " + spec.Resource, spec.Name, spec.Expression})
+	}
+
+	for _, r := range rules {
+		if r.expression == "" {
+			continue
+		}
+		if _, err := Compile(r.expression); err != nil {
+			return fmt.Errorf("expression for %s rule %s does not compile: %s", r.kind, r.name, err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package expressions
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+)
+
+func Test_Compile_errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+	}{
+		{name: "syntax error", expression: "object.status.phase =="},
+		{name: "undeclared variable", expression: "pod.status.phase == 'Running'"},
+		{name: "not a bool", expression: "1 + 2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			if _, err := Compile(test.expression); err == nil {
+				subT.Errorf("Compile(%q) did not return an error", test.expression)
+			}
+		})
+	}
+}
+
+func Test_Evaluate_ok(t *testing.T) {
+	now := time.Now()
+	pod := func(restarts int64) map[string]interface{} {
+		return map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":              "test-pod",
+				"namespace":         "prod-web",
+				"creationTimestamp": now.Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+			},
+			"status": map[string]interface{}{
+				"containerStatuses": []interface{}{
+					map[string]interface{}{"name": "web", "restartCount": restarts},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		object     map[string]interface{}
+		previous   map[string]interface{}
+		expected   bool
+	}{
+		{
+			name:       "restarts in a prod namespace",
+			expression: `object.metadata.namespace.startsWith("prod-") && object.status.containerStatuses.exists(c, c.restartCount > 5)`,
+			object:     pod(6),
+			expected:   true,
+		},
+		{
+			name:       "restarts under the limit",
+			expression: `object.metadata.namespace.startsWith("prod-") && object.status.containerStatuses.exists(c, c.restartCount > 5)`,
+			object:     pod(2),
+		},
+		{
+			name:       "older than an hour",
+			expression: `now - timestamp(object.metadata.creationTimestamp) > duration("1h")`,
+			object:     pod(0),
+			expected:   true,
+		},
+		{
+			name:       "restarted since the previous poll",
+			expression: `has(previous.status) && object.status.containerStatuses[0].restartCount > previous.status.containerStatuses[0].restartCount`,
+			object:     pod(3),
+			previous:   pod(2),
+			expected:   true,
+		},
+		{
+			name:       "first observation has no previous object",
+			expression: `has(previous.status) && object.status.containerStatuses[0].restartCount > previous.status.containerStatuses[0].restartCount`,
+			object:     pod(3),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			expression, err := Compile(test.expression)
+			if err != nil {
+				subT.Fatalf("Compile returned an unexpected error: %s", err.Error())
+			}
+			matched, err := expression.Evaluate(test.object, test.previous, now)
+			if err != nil {
+				subT.Fatalf("Evaluate returned an unexpected error: %s", err.Error())
+			}
+			if matched != test.expected {
+				subT.Errorf("Evaluate returned %t, expected %t", matched, test.expected)
+			}
+		})
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	config, _ := StubsInit()
+	if err := Validate(&config); err != nil {
+		t.Errorf("Validate returned an unexpected error: %s", err.Error())
+	}
+	config.Nodes = append(config.Nodes, NodeAlertSpec{Name: "*", Expression: "object.spec.unschedulable &&"})
+	if err := Validate(&config); err == nil {
+		t.Error("Validate did not return an error for an expression that does not compile")
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PollCertificate function takes inputs and iterates across TLS secrets in the kubernetes cluster, triggering alerts as needed.
+// Only secret metadata and certificate expiry times are ever put into alerts, never the secret material.
+func PollCertificate(
+	clientset kubernetes.Interface,
+	alertSpec types.CertificateAlertSpec,
+	tickertime int64,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
+
+	// Check rules with matching literal secret name
+	if alertSpec.Name != "*" {
+		if alertSpec.SecretFilterNamespace == "" {
+			return &PollErr{
+				Message: fmt.Sprintf("certificate rule for %s has no namespace filter specified, ignoring", alertSpec.Name),
+			}
+		}
+
+		secret, secreterr := clientset.CoreV1().Secrets(alertSpec.SecretFilterNamespace).Get(alertSpec.Name, metav1.GetOptions{})
+		if secreterr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("error getting secret %s: %s", alertSpec.Name, secreterr.Error()),
+			}
+		}
+		if secret.Type != corev1.SecretTypeTLS {
+			return &PollErr{
+				Message: fmt.Sprintf("secret %s is of type %s, not %s", alertSpec.Name, secret.Type, corev1.SecretTypeTLS),
+			}
+		}
+		checkCertificate(secret, alertSpec, alertFn, alertersConfig)
+		return nil
+	}
+
+	// If secret name is a wildcard, list based on filter and iterate through
+	listopts := metav1.ListOptions{
+		LabelSelector:        alertSpec.SecretFilterLabel,
+		FieldSelector:        fmt.Sprintf("type=%s", corev1.SecretTypeTLS),
+		IncludeUninitialized: false,
+		Watch:                false,
+		TimeoutSeconds:       &timeout,
+	}
+	secrets, secretserr := clientset.CoreV1().Secrets(alertSpec.SecretFilterNamespace).List(listopts)
+	if secretserr != nil {
+		return &PollErr{
+			Message: fmt.Sprintf("error fetching secrets: %s", secretserr.Error()),
+		}
+	}
+	for i := range secrets.Items {
+		if secrets.Items[i].Type == corev1.SecretTypeTLS {
+			checkCertificate(&secrets.Items[i], alertSpec, alertFn, alertersConfig)
+		}
+	}
+	return nil
+}
+
+func checkCertificate(
+	secret *corev1.Secret,
+	alertSpec types.CertificateAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) {
+	checkExpression(alertSpec.Expression, "certificates/"+alertSpec.Name, "Secret", secret, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
+	now := time.Now()
+	// Findings are raised on every poll while they last, like other checks, so they stay firing until fixed
+	alert := func(check string, alertmessage string, labels map[string]string) {
+		alertFn(withLabels(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "certificates/"+alertSpec.Name, check, "Secret", secret, alertmessage), labels), alertersConfig)
+	}
+
+	chain, err := parseCertificates(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		// ALERT
+		alertmessage := fmt.Sprintf("Secret %s in namespace %s does not contain a valid certificate: %s", secret.Name, secret.Namespace, err.Error())
+		alert("CertificateInvalid", alertmessage, nil)
+		return
+	}
+	leaf := chain[0]
+
+	remaining := leaf.NotAfter.Sub(now)
+	if remaining <= 0 {
+		// ALERT
+		alertmessage := fmt.Sprintf(
+			"Certificate %q in secret %s in namespace %s expired at %s!",
+			leaf.Subject.CommonName,
+			secret.Name,
+			secret.Namespace,
+			leaf.NotAfter.UTC().Format(time.RFC3339),
+		)
+		alert("CertificateExpired", alertmessage, nil)
+	} else if tier, ok := expiryTier(alertSpec.ReportStatus.ExpiryDays, remaining); ok {
+		// ALERT
+		alertmessage := fmt.Sprintf(
+			"Certificate %q in secret %s in namespace %s expires in less than %d days, at %s!",
+			leaf.Subject.CommonName,
+			secret.Name,
+			secret.Namespace,
+			tier,
+			leaf.NotAfter.UTC().Format(time.RFC3339),
+		)
+		// Each tier is its own alert, so crossing into a nearer tier notifies again
+		alert("CertificateExpiring", alertmessage, map[string]string{"expiryTier": fmt.Sprintf("%dd", tier)})
+	}
+
+	// An expired leaf never validates, and is already alerted on
+	if alertSpec.ReportStatus.ValidateChain && remaining > 0 {
+		opts := x509.VerifyOptions{
+			Intermediates: x509.NewCertPool(),
+			CurrentTime:   now,
+		}
+		for _, intermediate := range chain[1:] {
+			opts.Intermediates.AddCert(intermediate)
+		}
+		// Prefer the CA shipped alongside the certificate, falling back to the system roots
+		if caData, ok := secret.Data["ca.crt"]; ok {
+			opts.Roots = x509.NewCertPool()
+			opts.Roots.AppendCertsFromPEM(caData)
+		}
+		if _, err := leaf.Verify(opts); err != nil {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Certificate %q in secret %s in namespace %s does not have a valid chain: %s",
+				leaf.Subject.CommonName,
+				secret.Name,
+				secret.Namespace,
+				err.Error(),
+			)
+			alert("CertificateChainInvalid", alertmessage, nil)
+		}
+	}
+
+	if alertSpec.ReportStatus.KeyMismatch {
+		if _, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]); err != nil {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Certificate %q in secret %s in namespace %s does not match its private key!",
+				leaf.Subject.CommonName,
+				secret.Name,
+				secret.Namespace,
+			)
+			alert("CertificateKeyMismatch", alertmessage, nil)
+		}
+	}
+}
+
+// parseCertificates decodes every certificate in a PEM bundle, leaf first
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse certificate %d in bundle", len(certs)+1)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate found in %s", corev1.TLSCertKey)
+	}
+	return certs, nil
+}
+
+// expiryTier returns the smallest configured tier, in days, that the remaining validity falls within
+func expiryTier(tiers []int64, remaining time.Duration) (int64, bool) {
+	sorted := append([]int64{}, tiers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for _, days := range sorted {
+		if remaining <= time.Duration(days)*24*time.Hour {
+			return days, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testCertificate generates a PEM encoded certificate and key, signed by parent or self-signed when parent is nil
+func testCertificate(t *testing.T, commonName string, notAfter time.Time, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) ([]byte, []byte, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key: %s", err.Error())
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("unable to create certificate: %s", err.Error())
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, cert, key
+}
+
+func Test_PollCertificate_ok(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	caPEM, _, caCert, caKey := testCertificate(t, "test-ca", time.Now().Add(time.Hour*24*365), true, nil, nil)
+	validPEM, validKey, _, _ := testCertificate(t, "valid.example.com", time.Now().Add(time.Hour*24*100), false, caCert, caKey)
+	expiringPEM, expiringKey, _, _ := testCertificate(t, "expiring.example.com", time.Now().Add(time.Hour*24*5), false, caCert, caKey)
+	_, otherKey, _, _ := testCertificate(t, "other.example.com", time.Now().Add(time.Hour*24*100), false, caCert, caKey)
+	selfSignedPEM, selfSignedKey, _, _ := testCertificate(t, "self.example.com", time.Now().Add(time.Hour*24*100), false, nil, nil)
+
+	tlsSecret := func(certPEM []byte, keyPEM []byte, ca []byte) *corev1.Secret {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-tls",
+				Namespace: metav1.NamespaceDefault,
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       certPEM,
+				corev1.TLSPrivateKeyKey: keyPEM,
+			},
+		}
+		if ca != nil {
+			secret.Data["ca.crt"] = ca
+		}
+		return secret
+	}
+	allChecks := CertificateAlertStatus{
+		ExpiryDays:    []int64{30, 7, 1},
+		ValidateChain: true,
+		KeyMismatch:   true,
+	}
+
+	tests := []struct {
+		alertSpec   CertificateAlertSpec
+		name        string
+		secret      *corev1.Secret
+		shouldAlert bool
+	}{
+		{
+			name:   "valid certificate: no alert",
+			secret: tlsSecret(validPEM, validKey, caPEM),
+			alertSpec: CertificateAlertSpec{
+				Name:                  "test-tls",
+				SecretFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus:          allChecks,
+			},
+		},
+		{
+			name:   "certificate within expiry tier: alert",
+			secret: tlsSecret(expiringPEM, expiringKey, caPEM),
+			alertSpec: CertificateAlertSpec{
+				Name:                  "test-tls",
+				SecretFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus:          allChecks,
+			},
+			shouldAlert: true,
+		},
+		{
+			name:   "wildcard, certificate not matching key: alert",
+			secret: tlsSecret(validPEM, otherKey, caPEM),
+			alertSpec: CertificateAlertSpec{
+				Name:         "*",
+				ReportStatus: CertificateAlertStatus{KeyMismatch: true},
+			},
+			shouldAlert: true,
+		},
+		{
+			name:   "wildcard, chain not validating: alert",
+			secret: tlsSecret(selfSignedPEM, selfSignedKey, caPEM),
+			alertSpec: CertificateAlertSpec{
+				Name:         "*",
+				ReportStatus: CertificateAlertStatus{ValidateChain: true},
+			},
+			shouldAlert: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			client := fake.NewSimpleClientset(test.secret)
+			alertCount := 0
+			alertStub := func(alert Alert, _ AlertersConfig) {
+				alertCount++
+				if strings.Contains(alert.Message, "BEGIN") || strings.Contains(alert.Message, string(test.secret.Data[corev1.TLSPrivateKeyKey])) {
+					subT.Errorf("alert message should never contain secret material, got: %s", alert.Message)
+				}
+			}
+			// Poll twice, findings should be raised on every poll while they last
+			for i := 0; i < 2; i++ {
+				err := PollCertificate(client, test.alertSpec, defaultTickerTime, alertStub, conf)
+				if err != nil {
+					subT.Errorf("PollCertificate returned an unexpected error: %s", err.Error())
+				}
+			}
+			if test.shouldAlert != (alertCount > 0) {
+				subT.Errorf("alert function called %d times, expected alert: %t", alertCount, test.shouldAlert)
+			}
+			if test.shouldAlert && alertCount < 2 {
+				subT.Errorf("alert function called %d times, expected findings to be raised on every poll", alertCount)
+			}
+		})
+	}
+}
+
+func Test_PollCertificate_expiry_tiers(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	alertSpec := CertificateAlertSpec{
+		Name:                  "test-tls",
+		SecretFilterNamespace: metav1.NamespaceDefault,
+		ReportStatus:          CertificateAlertStatus{ExpiryDays: []int64{30, 7, 1}},
+	}
+	// The same secret, polled as its certificate gets closer to expiry
+	fingerprints := map[string]string{}
+	for _, days := range []time.Duration{20, 5, 5} {
+		certPEM, keyPEM, _, _ := testCertificate(t, "expiring.example.com", time.Now().Add(time.Hour*24*days), false, nil, nil)
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-tls",
+				Namespace: metav1.NamespaceDefault,
+			},
+			Type: corev1.SecretTypeTLS,
+			Data: map[string][]byte{
+				corev1.TLSCertKey:       certPEM,
+				corev1.TLSPrivateKeyKey: keyPEM,
+			},
+		}
+		alertStub := func(alert Alert, _ AlertersConfig) {
+			if alert.Check == "CertificateExpiring" {
+				fingerprints[alert.Labels["expiryTier"]] = alert.Fingerprint()
+			}
+		}
+		if err := PollCertificate(fake.NewSimpleClientset(secret), alertSpec, defaultTickerTime, alertStub, conf); err != nil {
+			t.Errorf("PollCertificate returned an unexpected error: %s", err.Error())
+		}
+	}
+	if len(fingerprints) != 2 || fingerprints["30d"] == "" || fingerprints["7d"] == "" {
+		t.Fatalf("expected alerts for the 30d and 7d tiers, got %v", fingerprints)
+	}
+	if fingerprints["30d"] == fingerprints["7d"] {
+		t.Errorf("expected each expiry tier to be its own alert, got the same fingerprint %s", fingerprints["30d"])
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/bloomberg/k8eraid/pkgs/types"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -34,6 +35,7 @@ func PollDaemonset(
 	alertFn alertFunction,
 	alertersConfig types.AlertersConfig,
 ) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
 
 	if alertSpec.ReportStatus.PendingThreshold == 0 {
 		alertSpec.ReportStatus.PendingThreshold = 10
@@ -53,7 +55,7 @@ func PollDaemonset(
 			}
 		}
 
-		checkDaemonset(daemonset, alertSpec, alertFn, alertersConfig)
+		return checkDaemonset(clientset, daemonset, alertSpec, alertFn, alertersConfig)
 		// If the daemon is a wildcard, list daemons and iterate through
 	} else {
 		if strings.Contains(alertSpec.DaemonFilter, "=") || alertSpec.DaemonFilter == "" {
@@ -69,30 +71,37 @@ func PollDaemonset(
 					Message: fmt.Sprintf("Unable to list DaemonSets: %s", daemonsetserr.Error()),
 				}
 			}
+			errs := []error{}
 			for _, daemonsetname := range daemonsets.Items {
 				daemonset, daemonseterr := clientset.AppsV1().DaemonSets(daemonsetname.GetNamespace()).Get(daemonsetname.GetName(), metav1.GetOptions{})
 				if daemonseterr != nil {
-					return &PollErr{
-						Message: fmt.Sprintf("Unable to get DaemonSet %s: %s", daemonsetname.Name, daemonsetserr.Error()),
-					}
+					errs = append(errs, &PollErr{
+						Message: fmt.Sprintf("Unable to get DaemonSet %s: %s", daemonsetname.Name, daemonseterr.Error()),
+					})
+					continue
+				}
+				if err := checkDaemonset(clientset, daemonset, alertSpec, alertFn, alertersConfig); err != nil {
+					errs = append(errs, err)
 				}
-				checkDaemonset(daemonset, alertSpec, alertFn, alertersConfig)
 			}
+			return combineErrors(errs)
 		} else {
 			return &PollErr{
 				Message: fmt.Sprintf("Deployment rule for global has incorrect filter specified (filter was: %s), ignoring", alertSpec.DaemonFilter),
 			}
 		}
 	}
-	return nil
 }
 
 func checkDaemonset(
+	clientset kubernetes.Interface,
 	daemonSet *appsv1.DaemonSet,
 	alertSpec types.DaemonsetAlertSpec,
 	alertFn alertFunction,
 	alertersConfig types.AlertersConfig,
-) {
+) error {
+	checkExpression(alertSpec.Expression, "daemonsets/"+alertSpec.Name, "DaemonSet", daemonSet, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
 	nowSeconds := time.Now().Unix()
 	// Get times for comparing to threshold
 	statusCreatedSecondsDiff := nowSeconds - daemonSet.ObjectMeta.CreationTimestamp.Unix()
@@ -110,11 +119,15 @@ func checkDaemonset(
 					alertSpec.DaemonFilter,
 					"does not have the specified required minimum replicas available!",
 				)
-				alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+				alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "daemonsets/"+alertSpec.Name, "MinReplicas", "DaemonSet", daemonSet, alertmessage), alertersConfig)
 			}
 		}
 		if alertSpec.ReportStatus.FailedScheduling {
 			if statusReplicas < daemonSet.Status.DesiredNumberScheduled {
+				nodes, err := unscheduledDaemonNodes(clientset, daemonSet)
+				if err != nil {
+					return err
+				}
 				// ALERT
 				alertmessage := fmt.Sprint(
 					"Daemonset",
@@ -123,8 +136,70 @@ func checkDaemonset(
 					alertSpec.DaemonFilter,
 					"does not have the desired number of replicas scheduled!",
 				)
-				alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+				if len(nodes) == 0 {
+					alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "daemonsets/"+alertSpec.Name, "FailedScheduling", "DaemonSet", daemonSet, alertmessage), alertersConfig)
+				}
+				// One alert per node the pods could not be scheduled on, labelled with the node so node alerts can inhibit them
+				for _, node := range nodes {
+					alert := objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "daemonsets/"+alertSpec.Name, "FailedScheduling", "DaemonSet", daemonSet, fmt.Sprintf("%s Its pod for node %s is not scheduled.", alertmessage, node))
+					alert.Labels = map[string]string{"node": node}
+					alertFn(alert, alertersConfig)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unscheduledDaemonNodes returns the nodes of the DaemonSet's pods that have not been scheduled. The DaemonSet
+// controller pins each pod to its node with a required node affinity on the node name, so the node is known
+// before the pod is scheduled.
+func unscheduledDaemonNodes(clientset kubernetes.Interface, daemonSet *appsv1.DaemonSet) ([]string, error) {
+	if daemonSet.Spec.Selector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(daemonSet.Spec.Selector)
+	if err != nil {
+		return nil, &PollErr{
+			Message: fmt.Sprintf("DaemonSet %s in namespace %s has an invalid selector: %s", daemonSet.Name, daemonSet.Namespace, err.Error()),
+		}
+	}
+	listopts := metav1.ListOptions{
+		LabelSelector:        selector.String(),
+		IncludeUninitialized: false,
+		Watch:                false,
+		TimeoutSeconds:       &timeout,
+	}
+	pods, podserr := clientset.CoreV1().Pods(daemonSet.Namespace).List(listopts)
+	if podserr != nil {
+		return nil, &PollErr{
+			Message: fmt.Sprintf("Unable to list pods for DaemonSet %s: %s", daemonSet.Name, podserr.Error()),
+		}
+	}
+	nodes := []string{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Spec.NodeName != "" || !metav1.IsControlledBy(pod, daemonSet) {
+			continue
+		}
+		if node := daemonPodNode(pod); node != "" {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// daemonPodNode returns the node an unscheduled DaemonSet pod is pinned to, or "" if it is not pinned to one
+func daemonPodNode(pod *corev1.Pod) string {
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.NodeAffinity == nil || pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	for _, term := range pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, field := range term.MatchFields {
+			if field.Key == "metadata.name" && field.Operator == corev1.NodeSelectorOpIn && len(field.Values) == 1 {
+				return field.Values[0]
 			}
 		}
 	}
+	return ""
 }
@@ -21,6 +21,7 @@ import (
 	. "github.com/bloomberg/k8eraid/pkgs/types"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -120,7 +121,7 @@ func Test_PollDaemonset_ok(t *testing.T) {
 		t.Run(test.name, func(subT *testing.T) {
 			client := fake.NewSimpleClientset(test.daemonSet)
 			stubCalled := false
-			alertStub := func(_ string, _ string, _ string, _ AlertersConfig) {
+			alertStub := func(_ Alert, _ AlertersConfig) {
 				stubCalled = true
 			}
 			err := PollDaemonset(client, test.alertSpec, defaultTickerTime, alertStub, conf)
@@ -135,3 +136,69 @@ func Test_PollDaemonset_ok(t *testing.T) {
 		})
 	}
 }
+
+func Test_PollDaemonset_failed_scheduling_node(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	isController := true
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-daemonset",
+			Namespace: metav1.NamespaceDefault,
+			UID:       "daemonset-uid",
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "agent"}},
+		},
+		Status: appsv1.DaemonSetStatus{
+			CurrentNumberScheduled: 1,
+			DesiredNumberScheduled: 2,
+		},
+	}
+	daemonPod := func(name string, nodeName string, pinnedTo string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: metav1.NamespaceDefault,
+				Labels:    map[string]string{"app": "agent"},
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "test-daemonset", UID: "daemonset-uid", Controller: &isController},
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: nodeName,
+				Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+							MatchFields: []corev1.NodeSelectorRequirement{
+								{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{pinnedTo}},
+							},
+						}},
+					},
+				}},
+			},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		daemonSet,
+		daemonPod("agent-a", "node-a", "node-a"),
+		daemonPod("agent-b", "", "node-b"),
+	)
+	alertSpec := DaemonsetAlertSpec{
+		Name:         "test-daemonset",
+		DaemonFilter: metav1.NamespaceDefault,
+		ReportStatus: DaemonsetAlertStatus{FailedScheduling: true},
+	}
+	alerts := []Alert{}
+	alertStub := func(alert Alert, _ AlertersConfig) {
+		alerts = append(alerts, alert)
+	}
+
+	if err := PollDaemonset(client, alertSpec, defaultTickerTime, alertStub, conf); err != nil {
+		t.Fatalf("PollDaemonset returned an unexpected error: %s", err.Error())
+	}
+	if len(alerts) != 1 || alerts[0].Labels["node"] != "node-b" {
+		t.Errorf("expected one failed scheduling alert labelled with node-b, got: %+v", alerts)
+	}
+}
@@ -34,6 +34,7 @@ func PollDeployment(
 	alertFn alertFunction,
 	alertersConfig types.AlertersConfig,
 ) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
 
 	if alertSpec.ReportStatus.PendingThreshold == 0 {
 		alertSpec.ReportStatus.PendingThreshold = 10
@@ -97,6 +98,8 @@ func checkDeployment(
 	alertersConfig types.AlertersConfig,
 ) {
 
+	checkExpression(alertSpec.Expression, "deployments/"+alertSpec.Name, "Deployment", deployment, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
 	// Get times for comparing to threshold
 	statusCreatedSecondsDiff := time.Now().Unix() - deployment.ObjectMeta.CreationTimestamp.Unix()
 
@@ -106,7 +109,7 @@ func checkDeployment(
 			// ALERT
 			s := []string{"Deployment", alertSpec.Name, "does not have the specified required minimum replicas"}
 			alertmessage := strings.Join(s, " ")
-			alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "deployments/"+alertSpec.Name, "MinReplicas", "Deployment", deployment, alertmessage), alertersConfig)
 		}
 	}
 }
@@ -91,7 +91,7 @@ func Test_PollDeployment_ok(t *testing.T) {
 		t.Run(test.name, func(subT *testing.T) {
 			client := fake.NewSimpleClientset(test.deployment)
 			stubCalled := false
-			alertStub := func(_ string, _ string, _ string, _ AlertersConfig) {
+			alertStub := func(_ Alert, _ AlertersConfig) {
 				stubCalled = true
 			}
 			err := PollDeployment(client, test.alertSpec, defaultTickerTime, alertStub, conf)
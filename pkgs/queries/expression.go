@@ -0,0 +1,129 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/expressions"
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Objects not observed for this long are assumed deleted, and dropped from the previous objects
+const snapshotExpiry = time.Hour
+
+// previousObjects remembers each object as an expression last saw it, so expressions can compare against it
+var previousObjects = newSnapshots()
+
+type snapshot struct {
+	object map[string]interface{}
+	seen   time.Time
+}
+
+type snapshots struct {
+	mu         sync.Mutex
+	objects    map[string]snapshot
+	lastPruned time.Time
+}
+
+func newSnapshots() *snapshots {
+	return &snapshots{objects: map[string]snapshot{}}
+}
+
+// swap stores object under key, returning the object previously stored there, if any
+func (s *snapshots) swap(key string, object map[string]interface{}, now time.Time) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastPruned) > snapshotExpiry {
+		for k, v := range s.objects {
+			if now.Sub(v.seen) > snapshotExpiry {
+				delete(s.objects, k)
+			}
+		}
+		s.lastPruned = now
+	}
+	previous := s.objects[key].object
+	s.objects[key] = snapshot{object: object, seen: now}
+	return previous
+}
+
+// withoutSecretData returns a copy of a Secret's content without its data, so secret material is not kept between
+// polls. Expressions on previous Secrets only see their metadata and type.
+func withoutSecretData(kind string, content map[string]interface{}) map[string]interface{} {
+	if kind != "Secret" {
+		return content
+	}
+	stripped := map[string]interface{}{}
+	for k, v := range content {
+		if k != "data" && k != "stringData" {
+			stripped[k] = v
+		}
+	}
+	return stripped
+}
+
+// checkExpression evaluates a rule's CEL expression against object, alerting if it is true
+func checkExpression(
+	expression string,
+	rule string,
+	kind string,
+	object metav1.Object,
+	alerterType string,
+	alerterName string,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) {
+	if expression == "" {
+		return
+	}
+	compiled, err := expressions.Compile(expression)
+	if err != nil {
+		log.Printf("Unable to compile expression %q: %s", expression, err.Error())
+		return
+	}
+
+	var content map[string]interface{}
+	if unstructuredObject, ok := object.(runtime.Unstructured); ok {
+		content = unstructuredObject.UnstructuredContent()
+	} else if content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(object); err != nil {
+		log.Printf("Unable to convert %s %s for expression %q: %s", kind, object.GetName(), expression, err.Error())
+		return
+	}
+	now := time.Now()
+	key := fmt.Sprintf("%s/%s/%s/%s", kind, object.GetNamespace(), object.GetName(), expression)
+	previous := previousObjects.swap(key, withoutSecretData(kind, content), now)
+
+	matched, err := compiled.Evaluate(content, previous, now)
+	if err != nil {
+		log.Printf("Unable to evaluate expression %q for %s %s: %s", expression, kind, object.GetName(), err.Error())
+		return
+	}
+	if matched {
+		// ALERT
+		var alertmessage string
+		if object.GetNamespace() == "" {
+			alertmessage = fmt.Sprintf("%s %s matches expression: %s", kind, object.GetName(), expression)
+		} else {
+			alertmessage = fmt.Sprintf("%s %s in namespace %s matches expression: %s", kind, object.GetName(), object.GetNamespace(), expression)
+		}
+		alertFn(objectAlert(alerterType, alerterName, rule, "Expression", kind, object, alertmessage), alertersConfig)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"testing"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_checkExpression_ok(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	deployment := func(generation int64) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test-deployment",
+				Namespace:  "prod-web",
+				Generation: generation,
+			},
+			Status: appsv1.DeploymentStatus{
+				AvailableReplicas: 2,
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		expression  string
+		polls       []*appsv1.Deployment
+		shouldAlert bool
+	}{
+		{
+			name:        "expression matching object: alert",
+			expression:  `object.metadata.namespace.startsWith("prod-") && object.status.availableReplicas < 3`,
+			polls:       []*appsv1.Deployment{deployment(1)},
+			shouldAlert: true,
+		},
+		{
+			name:       "expression not matching object: no alert",
+			expression: `object.metadata.namespace.startsWith("dev-")`,
+			polls:      []*appsv1.Deployment{deployment(1)},
+		},
+		{
+			name:       "expression comparing to previous object, unchanged: no alert",
+			expression: `has(previous.metadata) && object.metadata.generation != previous.metadata.generation`,
+			polls:      []*appsv1.Deployment{deployment(1), deployment(1)},
+		},
+		{
+			name:        "expression comparing to previous object, changed: alert",
+			expression:  `has(previous.metadata) && object.metadata.generation != previous.metadata.generation`,
+			polls:       []*appsv1.Deployment{deployment(1), deployment(2)},
+			shouldAlert: true,
+		},
+		{
+			name:       "expression failing to evaluate: no alert",
+			expression: `object.status.unknownField > 1`,
+			polls:      []*appsv1.Deployment{deployment(1)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			previousObjects = newSnapshots()
+			stubCalled := false
+			alertStub := func(_ Alert, _ AlertersConfig) {
+				stubCalled = true
+			}
+			alertSpec := DeploymentAlertSpec{
+				Name:       "test-deployment",
+				DepFilter:  "prod-web",
+				Expression: test.expression,
+			}
+			for _, poll := range test.polls {
+				client := fake.NewSimpleClientset(poll)
+				if err := PollDeployment(client, alertSpec, defaultTickerTime, alertStub, conf); err != nil {
+					subT.Errorf("PollDeployment returned an unexpected error: %s", err.Error())
+				}
+			}
+			if test.shouldAlert != stubCalled {
+				subT.Errorf("alert function called: %t, expected: %t", stubCalled, test.shouldAlert)
+			}
+		})
+	}
+}
+
+func Test_checkExpression_secret_data_not_kept(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	previousObjects = newSnapshots()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-tls",
+			Namespace: metav1.NamespaceDefault,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{corev1.TLSPrivateKeyKey: []byte("secret material")},
+	}
+	stubCalled := false
+	alertStub := func(_ Alert, _ AlertersConfig) {
+		stubCalled = true
+	}
+	checkExpression(`has(object.data) && !has(previous.data)`, "certificates/test-tls", "Secret", secret, "", "", alertStub, conf)
+	if !stubCalled {
+		t.Errorf("expected the expression to see the data of the current Secret")
+	}
+	for key, stored := range previousObjects.objects {
+		if _, ok := stored.object["data"]; ok {
+			t.Errorf("expected the data of Secrets not to be kept, found it in %s", key)
+		}
+	}
+}
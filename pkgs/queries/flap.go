@@ -0,0 +1,130 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Window used when a flap threshold is set without one
+const defaultFlapWindow = int64(600)
+
+var (
+	podFlaps  = newFlapDetector()
+	nodeFlaps = newFlapDetector()
+)
+
+// flapDetector counts the status transitions of each resource over a sliding window. Transitions are taken from
+// condition transition times, so several changes between two polls count as one.
+type flapDetector struct {
+	mu        sync.Mutex
+	resources map[string]*flapHistory
+}
+
+type flapHistory struct {
+	lastTransition time.Time
+	transitions    []time.Time
+	flapping       bool
+}
+
+func newFlapDetector() *flapDetector {
+	return &flapDetector{resources: map[string]*flapHistory{}}
+}
+
+// observe records the last transition time of a resource and reports whether it is flapping. A resource starts
+// flapping at threshold transitions within window, and stops once it has had none for a whole window.
+func (f *flapDetector) observe(key string, lastTransition time.Time, now time.Time, threshold int, window time.Duration) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h, ok := f.resources[key]
+	if !ok {
+		h = &flapHistory{}
+		f.resources[key] = h
+	}
+	if !lastTransition.Equal(h.lastTransition) {
+		h.lastTransition = lastTransition
+		if now.Sub(lastTransition) <= window {
+			h.transitions = append(h.transitions, lastTransition)
+		}
+	}
+
+	recent := []time.Time{}
+	for _, transition := range h.transitions {
+		if now.Sub(transition) <= window {
+			recent = append(recent, transition)
+		}
+	}
+	h.transitions = recent
+
+	if !h.flapping && len(h.transitions) >= threshold {
+		h.flapping = true
+	} else if h.flapping && len(h.transitions) == 0 {
+		h.flapping = false
+	}
+	if !h.flapping && len(h.transitions) == 0 {
+		// Nothing to remember, so deleted resources do not build up
+		delete(f.resources, key)
+	}
+	return h.flapping
+}
+
+// checkFlapping tracks the ready condition of an object and reports whether it is flapping, in which case its
+// individual transitions should not be alerted on. A flapping alert is raised on every poll while it is flapping,
+// so it resolves once the object is stable again.
+func checkFlapping(
+	detector *flapDetector,
+	threshold int,
+	windowSeconds int64,
+	rule string,
+	kind string,
+	object metav1.Object,
+	lastTransition time.Time,
+	alerterType string,
+	alerterName string,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) bool {
+	if threshold <= 0 {
+		return false
+	}
+	if windowSeconds <= 0 {
+		windowSeconds = defaultFlapWindow
+	}
+	key := fmt.Sprintf("%s/%s/%s/%s", rule, kind, object.GetNamespace(), object.GetName())
+	flapping := detector.observe(key, lastTransition, time.Now(), threshold, time.Duration(windowSeconds)*time.Second)
+	if flapping {
+		// ALERT
+		name := object.GetName()
+		if object.GetNamespace() != "" {
+			name = fmt.Sprintf("%s in namespace %s", name, object.GetNamespace())
+		}
+		alertmessage := fmt.Sprintf(
+			"%s %s is flapping, its ready status changed at least %d times in %d seconds! Its changes are not alerted on until it has been stable for %d seconds.",
+			kind,
+			name,
+			threshold,
+			windowSeconds,
+			windowSeconds,
+		)
+		alertFn(objectAlert(alerterType, alerterName, rule, "Flapping", kind, object, alertmessage), alertersConfig)
+	}
+	return flapping
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_flapDetector(t *testing.T) {
+	detector := newFlapDetector()
+	start := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	window := 10 * time.Minute
+
+	// The ready status changes every minute, the third change within the window starts the flapping
+	expected := []bool{false, false, true, true}
+	for i, want := range expected {
+		now := start.Add(time.Duration(i) * time.Minute)
+		if flapping := detector.observe("test-pod", now, now, 3, window); flapping != want {
+			t.Fatalf("transition %d: flapping %t, expected %t", i, flapping, want)
+		}
+	}
+
+	// Still flapping while the window has recent transitions, stable once it has none
+	last := start.Add(3 * time.Minute)
+	if flapping := detector.observe("test-pod", last, last.Add(5*time.Minute), 3, window); !flapping {
+		t.Errorf("resource should still be flapping within the window of its last transition")
+	}
+	if flapping := detector.observe("test-pod", last, last.Add(11*time.Minute), 3, window); flapping {
+		t.Errorf("resource should be stable after a window without transitions")
+	}
+	if len(detector.resources) != 0 {
+		t.Errorf("stable resource should be forgotten, got: %v", detector.resources)
+	}
+}
+
+func Test_PollPod_flapping(t *testing.T) {
+
+	_, conf := StubsInit()
+	podFlaps = newFlapDetector()
+
+	client := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: defaultMeta})
+	alertSpec := PodAlertSpec{
+		Name:               "test-pod",
+		PodFilterNamespace: metav1.NamespaceDefault,
+		ReportStatus:       PodAlertStatus{PodRestarts: true, FlapThreshold: 2, FlapWindow: 600},
+	}
+	checks := []string{}
+	alertStub := func(alert Alert, _ AlertersConfig) {
+		checks = append(checks, alert.Check)
+	}
+
+	// Each poll sees a new ready transition, as a pod restarting over and over would
+	for i := 0; i < 3; i++ {
+		pod, _ := client.CoreV1().Pods(metav1.NamespaceDefault).Get("test-pod", metav1.GetOptions{})
+		pod.Status.Conditions = []corev1.PodCondition{
+			{Type: corev1.PodReady, LastTransitionTime: metav1.Time{Time: time.Now().Add(time.Duration(i-3) * time.Second)}},
+		}
+		client.CoreV1().Pods(metav1.NamespaceDefault).Update(pod)
+		if err := PollPod(client, alertSpec, defaultTickerTime, alertStub, conf); err != nil {
+			t.Fatalf("PollPod returned an unexpected error: %s", err.Error())
+		}
+	}
+
+	// Flapping is raised on every poll while the pod flaps, and its restarts are not
+	expected := []string{"PodFailures", "Flapping", "Flapping"}
+	if strings.Join(checks, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected one restart alert, then a flapping alert on every poll, got: %v", checks)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Most resources do not timestamp their conditions, so condition durations are tracked across polls
+var genericObservations = newObservations()
+
+// PollGeneric function takes inputs and iterates across resources of any type in the kubernetes cluster,
+// including custom resources, triggering alerts as needed.
+func PollGeneric(
+	dynamicclient dynamic.Interface,
+	alertSpec types.GenericAlertSpec,
+	tickertime int64,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
+
+	if alertSpec.Version == "" || alertSpec.Resource == "" {
+		return &PollErr{
+			Message: fmt.Sprintf("generic rule for %s must specify a version and resource, ignoring", alertSpec.Name),
+		}
+	}
+	gvr := schema.GroupVersionResource{
+		Group:    alertSpec.Group,
+		Version:  alertSpec.Version,
+		Resource: alertSpec.Resource,
+	}
+	client := dynamicclient.Resource(gvr).Namespace(alertSpec.GenericFilterNamespace)
+
+	// Check rules with matching literal resource name, cluster scoped resources leave filterNamespace empty
+	if alertSpec.Name != "*" {
+		object, objecterr := client.Get(alertSpec.Name, metav1.GetOptions{})
+		if objecterr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("error getting %s %s: %s", gvr.String(), alertSpec.Name, objecterr.Error()),
+			}
+		}
+		return checkGeneric(object, gvr, alertSpec, alertFn, alertersConfig)
+	}
+
+	// If resource name is a wildcard, list based on filter and iterate through
+	listopts := metav1.ListOptions{
+		LabelSelector:        alertSpec.GenericFilterLabel,
+		IncludeUninitialized: false,
+		Watch:                false,
+		TimeoutSeconds:       &timeout,
+	}
+	objects, objectserr := client.List(listopts)
+	if objectserr != nil {
+		return &PollErr{
+			Message: fmt.Sprintf("error fetching %s: %s", gvr.String(), objectserr.Error()),
+		}
+	}
+	errs := []error{}
+	for i := range objects.Items {
+		if err := checkGeneric(&objects.Items[i], gvr, alertSpec, alertFn, alertersConfig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return combineErrors(errs)
+}
+
+func checkGeneric(
+	object *unstructured.Unstructured,
+	gvr schema.GroupVersionResource,
+	alertSpec types.GenericAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	checkExpression(alertSpec.Expression, "generic/"+alertSpec.Name, object.GetKind(), object, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
+	now := time.Now()
+	for _, condition := range alertSpec.Conditions {
+		matched, observed, err := evaluateGenericCondition(object.UnstructuredContent(), condition)
+		if err != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("error evaluating condition %s %s %q on %s %s: %s", condition.JSONPath, condition.Operator, condition.Value, object.GetKind(), object.GetName(), err.Error()),
+			}
+		}
+
+		key := genericKey(gvr, object.GetNamespace(), object.GetName(), condition)
+		if !matched {
+			genericObservations.forget(key)
+			continue
+		}
+		if duration := genericObservations.since(key, now); duration >= condition.Threshold {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"%s has matched condition %s %s %q for %d seconds, observed value: %q",
+				genericObjectRef(object),
+				condition.JSONPath,
+				condition.Operator,
+				condition.Value,
+				duration,
+				observed,
+			)
+			alert := objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "generic/"+alertSpec.Name, "GenericCondition", object.GetKind(), object, alertmessage)
+			alert.Labels = map[string]string{"condition": fmt.Sprintf("%s %s %q", condition.JSONPath, condition.Operator, condition.Value)}
+			alertFn(alert, alertersConfig)
+		}
+	}
+	return nil
+}
+
+// genericKey identifies a condition on an object for tracking how long it has matched
+func genericKey(gvr schema.GroupVersionResource, namespace string, name string, condition types.GenericCondition) string {
+	return strings.Join([]string{gvr.String(), namespace, name, condition.JSONPath, condition.Operator, condition.Value}, "/")
+}
+
+// evaluateGenericCondition evaluates a JSONPath condition against an object, returning whether it matched and the value
+// observed. Missing fields evaluate to an empty string, so a condition like .status.phase != "Running" matches them.
+func evaluateGenericCondition(content map[string]interface{}, condition types.GenericCondition) (bool, string, error) {
+	path := condition.JSONPath
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+	parser := jsonpath.New("condition").AllowMissingKeys(true)
+	if err := parser.Parse(path); err != nil {
+		return false, "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := parser.Execute(buf, content); err != nil {
+		return false, "", err
+	}
+	observed := buf.String()
+
+	switch condition.Operator {
+	case "==":
+		return observed == condition.Value, observed, nil
+	case "!=":
+		return observed != condition.Value, observed, nil
+	case "<", "<=", ">", ">=":
+		// Nothing to compare numerically while the field is unset
+		if observed == "" {
+			return false, observed, nil
+		}
+		left, err := strconv.ParseFloat(observed, 64)
+		if err != nil {
+			return false, observed, fmt.Errorf("observed value %q is not a number", observed)
+		}
+		right, err := strconv.ParseFloat(condition.Value, 64)
+		if err != nil {
+			return false, observed, fmt.Errorf("value %q is not a number", condition.Value)
+		}
+		switch condition.Operator {
+		case "<":
+			return left < right, observed, nil
+		case "<=":
+			return left <= right, observed, nil
+		case ">":
+			return left > right, observed, nil
+		default:
+			return left >= right, observed, nil
+		}
+	default:
+		return false, observed, fmt.Errorf("unknown operator %q", condition.Operator)
+	}
+}
+
+// genericObjectRef describes an object for alert messages, leaving out the namespace for cluster scoped resources
+func genericObjectRef(object *unstructured.Unstructured) string {
+	if object.GetNamespace() == "" {
+		return fmt.Sprintf("%s %s", object.GetKind(), object.GetName())
+	}
+	return fmt.Sprintf("%s %s in namespace %s", object.GetKind(), object.GetName(), object.GetNamespace())
+}
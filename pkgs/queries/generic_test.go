@@ -0,0 +1,161 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func Test_PollGeneric_ok(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	kafka := func(ready string, replicas int64) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "kafka.example.com/v1",
+				"kind":       "Kafka",
+				"metadata": map[string]interface{}{
+					"name":      "test-kafka",
+					"namespace": metav1.NamespaceDefault,
+				},
+				"status": map[string]interface{}{
+					"readyReplicas": replicas,
+					"conditions": []interface{}{
+						map[string]interface{}{"type": "Ready", "status": ready},
+					},
+				},
+			},
+		}
+	}
+	notReady := GenericCondition{
+		JSONPath:  `.status.conditions[?(@.type=="Ready")].status`,
+		Operator:  "!=",
+		Value:     "True",
+		Threshold: 300,
+	}
+	tooFewReplicas := GenericCondition{
+		JSONPath: ".status.readyReplicas",
+		Operator: "<",
+		Value:    "3",
+	}
+
+	tests := []struct {
+		alertSpec   GenericAlertSpec
+		name        string
+		object      *unstructured.Unstructured
+		firstSeen   time.Time
+		shouldAlert bool
+	}{
+		{
+			name:   "ready resource: no alert",
+			object: kafka("True", 3),
+			alertSpec: GenericAlertSpec{
+				Name:                   "test-kafka",
+				Group:                  "kafka.example.com",
+				Version:                "v1",
+				Resource:               "kafkas",
+				GenericFilterNamespace: metav1.NamespaceDefault,
+				Conditions:             []GenericCondition{notReady, tooFewReplicas},
+			},
+		},
+		{
+			name:      "not ready within threshold: no alert",
+			object:    kafka("False", 3),
+			firstSeen: time.Now().Add(time.Second * -60),
+			alertSpec: GenericAlertSpec{
+				Name:                   "test-kafka",
+				Group:                  "kafka.example.com",
+				Version:                "v1",
+				Resource:               "kafkas",
+				GenericFilterNamespace: metav1.NamespaceDefault,
+				Conditions:             []GenericCondition{notReady},
+			},
+		},
+		{
+			name:      "not ready past threshold: alert",
+			object:    kafka("False", 3),
+			firstSeen: time.Now().Add(time.Second * -600),
+			alertSpec: GenericAlertSpec{
+				Name:                   "test-kafka",
+				Group:                  "kafka.example.com",
+				Version:                "v1",
+				Resource:               "kafkas",
+				GenericFilterNamespace: metav1.NamespaceDefault,
+				Conditions:             []GenericCondition{notReady},
+			},
+			shouldAlert: true,
+		},
+		{
+			name:   "wildcard, numeric condition without threshold: alert",
+			object: kafka("True", 1),
+			alertSpec: GenericAlertSpec{
+				Name:       "*",
+				Group:      "kafka.example.com",
+				Version:    "v1",
+				Resource:   "kafkas",
+				Conditions: []GenericCondition{tooFewReplicas},
+			},
+			shouldAlert: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			genericObservations = newObservations()
+			if !test.firstSeen.IsZero() {
+				for _, condition := range test.alertSpec.Conditions {
+					gvr := schema.GroupVersionResource{Group: "kafka.example.com", Version: "v1", Resource: "kafkas"}
+					key := genericKey(gvr, metav1.NamespaceDefault, "test-kafka", condition)
+					genericObservations.firstSeen[key] = test.firstSeen
+				}
+			}
+			client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), test.object)
+			stubCalled := false
+			alertStub := func(_ Alert, _ AlertersConfig) {
+				stubCalled = true
+			}
+			err := PollGeneric(client, test.alertSpec, defaultTickerTime, alertStub, conf)
+			if err != nil {
+				subT.Errorf("PollGeneric returned an unexpected error: %s", err.Error())
+			}
+			if test.shouldAlert != stubCalled {
+				subT.Errorf("alert function called: %t, expected: %t", stubCalled, test.shouldAlert)
+			}
+		})
+	}
+}
+
+func Test_evaluateGenericCondition_errors(t *testing.T) {
+	content := map[string]interface{}{"status": map[string]interface{}{"phase": "Running"}}
+	conditions := []GenericCondition{
+		{JSONPath: ".status.phase", Operator: "=~", Value: "Running"},
+		{JSONPath: ".status.phase", Operator: ">", Value: "1"},
+		{JSONPath: ".status.conditions[?(@.type==", Operator: "==", Value: ""},
+	}
+	for _, condition := range conditions {
+		if _, _, err := evaluateGenericCondition(content, condition); err == nil {
+			t.Errorf("expected an error evaluating %s %s %q", condition.JSONPath, condition.Operator, condition.Value)
+		}
+	}
+}
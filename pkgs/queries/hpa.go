@@ -0,0 +1,149 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var hpaObservations = newObservations()
+
+// PollHPA function takes inputs and iterates across horizontal pod autoscalers in the kubernetes cluster, triggering alerts as needed.
+func PollHPA(
+	clientset kubernetes.Interface,
+	alertSpec types.HPAAlertSpec,
+	tickertime int64,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
+
+	if alertSpec.ReportStatus.PendingThreshold == 0 {
+		alertSpec.ReportStatus.PendingThreshold = 10
+	}
+
+	// If the HPA is not wildcard, search by name
+	if alertSpec.Name != "*" {
+		if alertSpec.HPAFilter == "" {
+			return &PollErr{
+				Message: fmt.Sprintf("HPA rule for %s has no namespace filter specified, ignoring", alertSpec.Name),
+			}
+		}
+
+		hpa, hpaerr := clientset.AutoscalingV2beta1().HorizontalPodAutoscalers(alertSpec.HPAFilter).Get(alertSpec.Name, metav1.GetOptions{})
+		if hpaerr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("Error fetching HPA %s: %s", alertSpec.Name, hpaerr.Error()),
+			}
+		}
+		checkHPA(hpa, alertSpec, alertFn, alertersConfig)
+
+		// If the HPA is a wildcard, list HPAs and iterate through
+	} else {
+		if strings.Contains(alertSpec.HPAFilter, "=") || alertSpec.HPAFilter == "" {
+			listopts := metav1.ListOptions{
+				LabelSelector:        alertSpec.HPAFilter,
+				IncludeUninitialized: false,
+				Watch:                false,
+				TimeoutSeconds:       &timeout,
+			}
+			hpas, hpaserr := clientset.AutoscalingV2beta1().HorizontalPodAutoscalers("").List(listopts)
+			if hpaserr != nil {
+				return &PollErr{
+					Message: fmt.Sprintf("Unable to list HPAs: %s", hpaserr.Error()),
+				}
+			}
+			for i := range hpas.Items {
+				checkHPA(&hpas.Items[i], alertSpec, alertFn, alertersConfig)
+			}
+		} else {
+			return &PollErr{
+				Message: fmt.Sprintf("HPA rule for global has incorrect filter specified (filter was: %s), ignoring", alertSpec.HPAFilter),
+			}
+		}
+	}
+	return nil
+}
+
+func checkHPA(
+	hpa *autoscalingv2beta1.HorizontalPodAutoscaler,
+	alertSpec types.HPAAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) {
+	checkExpression(alertSpec.Expression, "hpas/"+alertSpec.Name, "HorizontalPodAutoscaler", hpa, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
+	now := time.Now()
+	target := fmt.Sprintf("%s/%s", hpa.Spec.ScaleTargetRef.Kind, hpa.Spec.ScaleTargetRef.Name)
+
+	// The HPA does not record how long it has been at its ceiling, so track it ourselves
+	maxedKey := fmt.Sprintf("maxed/%s/%s", hpa.Namespace, hpa.Name)
+	if hpa.Status.CurrentReplicas == hpa.Spec.MaxReplicas {
+		maxedSeconds := hpaObservations.since(maxedKey, now)
+		if alertSpec.ReportStatus.MaxReplicasThreshold > 0 && maxedSeconds >= alertSpec.ReportStatus.MaxReplicasThreshold {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"HPA %s in namespace %s has kept %s at maxReplicas (%d) for %d seconds!",
+				hpa.Name,
+				hpa.Namespace,
+				target,
+				hpa.Spec.MaxReplicas,
+				maxedSeconds,
+			)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "hpas/"+alertSpec.Name, "MaxReplicas", "HorizontalPodAutoscaler", hpa, alertmessage), alertersConfig)
+		}
+	} else {
+		hpaObservations.forget(maxedKey)
+	}
+
+	// Get times for comparing to threshold
+	statusCreatedSecondsDiff := now.Unix() - hpa.ObjectMeta.CreationTimestamp.Unix()
+
+	// If HPA hasnt been around longer than threshold, bail. otherwise check the conditions.
+	if statusCreatedSecondsDiff > alertSpec.ReportStatus.PendingThreshold {
+		for _, condition := range hpa.Status.Conditions {
+			if condition.Status != corev1.ConditionFalse {
+				continue
+			}
+			transitiontimeDiff := now.Unix() - condition.LastTransitionTime.Unix()
+			if transitiontimeDiff < alertSpec.ReportStatus.PendingThreshold {
+				continue
+			}
+			if (condition.Type == autoscalingv2beta1.ScalingActive && alertSpec.ReportStatus.ScalingActive) ||
+				(condition.Type == autoscalingv2beta1.AbleToScale && alertSpec.ReportStatus.AbleToScale) {
+				// ALERT
+				alertmessage := fmt.Sprintf(
+					"HPA %s in namespace %s is unable to scale %s, %s is False (%s): %s",
+					hpa.Name,
+					hpa.Namespace,
+					target,
+					condition.Type,
+					condition.Reason,
+					condition.Message,
+				)
+				alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "hpas/"+alertSpec.Name, string(condition.Type), "HorizontalPodAutoscaler", hpa, alertmessage), alertersConfig)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	autoscalingv2beta1 "k8s.io/api/autoscaling/v2beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_PollHPA_ok(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	defaultHPAMeta := metav1.ObjectMeta{
+		CreationTimestamp: metav1.Time{Time: time.Now().Add(time.Second * -600)},
+		Name:              "test-hpa",
+		Namespace:         metav1.NamespaceDefault,
+	}
+	defaultHPASpec := autoscalingv2beta1.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: autoscalingv2beta1.CrossVersionObjectReference{
+			Kind: "Deployment",
+			Name: "test-deployment",
+		},
+		MaxReplicas: 10,
+	}
+
+	tests := []struct {
+		alertSpec   HPAAlertSpec
+		name        string
+		hpa         *autoscalingv2beta1.HorizontalPodAutoscaler
+		firstSeen   map[string]time.Time
+		shouldAlert bool
+	}{
+		{
+			name: "HPA below maxReplicas: no alert",
+			hpa: &autoscalingv2beta1.HorizontalPodAutoscaler{
+				ObjectMeta: defaultHPAMeta,
+				Spec:       defaultHPASpec,
+				Status: autoscalingv2beta1.HorizontalPodAutoscalerStatus{
+					CurrentReplicas: 5,
+				},
+			},
+			alertSpec: HPAAlertSpec{
+				Name:      "test-hpa",
+				HPAFilter: metav1.NamespaceDefault,
+				ReportStatus: HPAAlertStatus{
+					MaxReplicasThreshold: 60,
+				},
+			},
+		},
+		{
+			name: "HPA at maxReplicas, first seen: no alert",
+			hpa: &autoscalingv2beta1.HorizontalPodAutoscaler{
+				ObjectMeta: defaultHPAMeta,
+				Spec:       defaultHPASpec,
+				Status: autoscalingv2beta1.HorizontalPodAutoscalerStatus{
+					CurrentReplicas: 10,
+				},
+			},
+			alertSpec: HPAAlertSpec{
+				Name:      "test-hpa",
+				HPAFilter: metav1.NamespaceDefault,
+				ReportStatus: HPAAlertStatus{
+					MaxReplicasThreshold: 60,
+				},
+			},
+		},
+		{
+			name: "HPA at maxReplicas past threshold: alert",
+			hpa: &autoscalingv2beta1.HorizontalPodAutoscaler{
+				ObjectMeta: defaultHPAMeta,
+				Spec:       defaultHPASpec,
+				Status: autoscalingv2beta1.HorizontalPodAutoscalerStatus{
+					CurrentReplicas: 10,
+				},
+			},
+			firstSeen: map[string]time.Time{
+				"maxed/default/test-hpa": time.Now().Add(time.Second * -120),
+			},
+			alertSpec: HPAAlertSpec{
+				Name:      "test-hpa",
+				HPAFilter: metav1.NamespaceDefault,
+				ReportStatus: HPAAlertStatus{
+					MaxReplicasThreshold: 60,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, ScalingActive false: alert",
+			hpa: &autoscalingv2beta1.HorizontalPodAutoscaler{
+				ObjectMeta: defaultHPAMeta,
+				Spec:       defaultHPASpec,
+				Status: autoscalingv2beta1.HorizontalPodAutoscalerStatus{
+					CurrentReplicas: 2,
+					Conditions: []autoscalingv2beta1.HorizontalPodAutoscalerCondition{
+						{
+							Type:               autoscalingv2beta1.ScalingActive,
+							Status:             corev1.ConditionFalse,
+							Reason:             "FailedGetResourceMetric",
+							LastTransitionTime: metav1.Time{Time: time.Now().Add(time.Second * -120)},
+						},
+					},
+				},
+			},
+			alertSpec: HPAAlertSpec{
+				Name: "*",
+				ReportStatus: HPAAlertStatus{
+					ScalingActive:    true,
+					PendingThreshold: 60,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, AbleToScale false within threshold: no alert",
+			hpa: &autoscalingv2beta1.HorizontalPodAutoscaler{
+				ObjectMeta: defaultHPAMeta,
+				Spec:       defaultHPASpec,
+				Status: autoscalingv2beta1.HorizontalPodAutoscalerStatus{
+					CurrentReplicas: 2,
+					Conditions: []autoscalingv2beta1.HorizontalPodAutoscalerCondition{
+						{
+							Type:               autoscalingv2beta1.AbleToScale,
+							Status:             corev1.ConditionFalse,
+							Reason:             "BackoffBoth",
+							LastTransitionTime: metav1.Time{Time: time.Now().Add(time.Second * -10)},
+						},
+					},
+				},
+			},
+			alertSpec: HPAAlertSpec{
+				Name: "*",
+				ReportStatus: HPAAlertStatus{
+					AbleToScale:      true,
+					PendingThreshold: 60,
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			hpaObservations = newObservations()
+			for key, first := range test.firstSeen {
+				hpaObservations.firstSeen[key] = first
+			}
+			client := fake.NewSimpleClientset(test.hpa)
+			stubCalled := false
+			alertStub := func(alert Alert, _ AlertersConfig) {
+				stubCalled = true
+				if !strings.Contains(alert.Message, "Deployment/test-deployment") {
+					subT.Errorf("alert message should name the target workload, got: %s", alert.Message)
+				}
+			}
+			err := PollHPA(client, test.alertSpec, defaultTickerTime, alertStub, conf)
+			if err != nil {
+				subT.Errorf("PollHPA returned an unexpected error: %s", err.Error())
+			}
+			if test.shouldAlert != stubCalled {
+				subT.Errorf("alert function called: %t, expected: %t", stubCalled, test.shouldAlert)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PollIngress function takes inputs and iterates across ingresses in the kubernetes cluster, triggering alerts as needed.
+func PollIngress(
+	clientset kubernetes.Interface,
+	alertSpec types.IngressAlertSpec,
+	tickertime int64,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
+
+	if alertSpec.ReportStatus.PendingThreshold == 0 {
+		alertSpec.ReportStatus.PendingThreshold = 10
+	}
+
+	// Check rules with matching literal ingress name
+	if alertSpec.Name != "*" {
+		if alertSpec.IngressFilterNamespace == "" {
+			return &PollErr{
+				Message: fmt.Sprintf("ingress rule for %s has no namespace filter specified, ignoring", alertSpec.Name),
+			}
+		}
+
+		ingress, ingresserr := clientset.ExtensionsV1beta1().Ingresses(alertSpec.IngressFilterNamespace).Get(alertSpec.Name, metav1.GetOptions{})
+		if ingresserr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("error getting ingress %s: %s", alertSpec.Name, ingresserr.Error()),
+			}
+		}
+		return checkIngress(clientset, ingress, alertSpec, alertFn, alertersConfig)
+	}
+
+	// If ingress name is a wildcard, list based on filter and iterate through
+	listopts := metav1.ListOptions{
+		LabelSelector:        alertSpec.IngressFilterLabel,
+		IncludeUninitialized: false,
+		Watch:                false,
+		TimeoutSeconds:       &timeout,
+	}
+	ingresses, ingresseserr := clientset.ExtensionsV1beta1().Ingresses(alertSpec.IngressFilterNamespace).List(listopts)
+	if ingresseserr != nil {
+		return &PollErr{
+			Message: fmt.Sprintf("error fetching ingresses: %s", ingresseserr.Error()),
+		}
+	}
+	errs := []error{}
+	for i := range ingresses.Items {
+		if err := checkIngress(clientset, &ingresses.Items[i], alertSpec, alertFn, alertersConfig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return combineErrors(errs)
+}
+
+func checkIngress(
+	clientset kubernetes.Interface,
+	ingress *extensionsv1beta1.Ingress,
+	alertSpec types.IngressAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	checkExpression(alertSpec.Expression, "ingresses/"+alertSpec.Name, "Ingress", ingress, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
+	// Get times for comparing to threshold
+	statusCreatedSecondsDiff := time.Now().Unix() - ingress.ObjectMeta.CreationTimestamp.Unix()
+
+	// Ingress controllers can take a while to program a load balancer, so they have their own threshold
+	if alertSpec.ReportStatus.LoadBalancerThreshold > 0 {
+		if len(ingress.Status.LoadBalancer.Ingress) == 0 && statusCreatedSecondsDiff > alertSpec.ReportStatus.LoadBalancerThreshold {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Ingress %s in namespace %s has not been assigned a load balancer after %d seconds!",
+				ingress.Name,
+				ingress.Namespace,
+				statusCreatedSecondsDiff,
+			)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "ingresses/"+alertSpec.Name, "LoadBalancerPending", "Ingress", ingress, alertmessage), alertersConfig)
+		}
+	}
+
+	// If ingress hasnt been around longer than threshold, bail. otherwise check what it references.
+	if statusCreatedSecondsDiff <= alertSpec.ReportStatus.PendingThreshold {
+		return nil
+	}
+
+	errs := []error{}
+	if alertSpec.ReportStatus.MissingBackends || alertSpec.ReportStatus.NoReadyEndpoints {
+		for _, backend := range ingressBackends(ingress) {
+			if err := checkIngressBackend(clientset, ingress, backend, alertSpec, alertFn, alertersConfig); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if alertSpec.ReportStatus.MissingTLSSecrets {
+		for _, tls := range ingress.Spec.TLS {
+			// An empty secret name means the ingress controller's default certificate is used
+			if tls.SecretName == "" {
+				continue
+			}
+			_, err := clientset.CoreV1().Secrets(ingress.Namespace).Get(tls.SecretName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				// ALERT
+				alertmessage := fmt.Sprintf(
+					"Ingress %s in namespace %s references TLS secret %s which does not exist!",
+					ingress.Name,
+					ingress.Namespace,
+					tls.SecretName,
+				)
+				alert := objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "ingresses/"+alertSpec.Name, "MissingTLSSecret", "Ingress", ingress, alertmessage)
+				alert.Labels = map[string]string{"secret": tls.SecretName}
+				alertFn(alert, alertersConfig)
+			} else if err != nil {
+				errs = append(errs, &PollErr{
+					Message: fmt.Sprintf("Unable to get TLS secret %s for ingress %s: %s", tls.SecretName, ingress.Name, err.Error()),
+				})
+			}
+		}
+	}
+	return combineErrors(errs)
+}
+
+func checkIngressBackend(
+	clientset kubernetes.Interface,
+	ingress *extensionsv1beta1.Ingress,
+	backend extensionsv1beta1.IngressBackend,
+	alertSpec types.IngressAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	service, err := clientset.CoreV1().Services(ingress.Namespace).Get(backend.ServiceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if alertSpec.ReportStatus.MissingBackends {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Ingress %s in namespace %s references backend service %s which does not exist!",
+				ingress.Name,
+				ingress.Namespace,
+				backend.ServiceName,
+			)
+			alert := objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "ingresses/"+alertSpec.Name, "MissingBackend", "Ingress", ingress, alertmessage)
+			alert.Labels = map[string]string{"service": backend.ServiceName}
+			alertFn(alert, alertersConfig)
+		}
+		return nil
+	} else if err != nil {
+		return &PollErr{
+			Message: fmt.Sprintf("Unable to get backend service %s for ingress %s: %s", backend.ServiceName, ingress.Name, err.Error()),
+		}
+	}
+
+	if alertSpec.ReportStatus.MissingBackends && !servicePortExists(service, backend.ServicePort) {
+		// ALERT
+		alertmessage := fmt.Sprintf(
+			"Ingress %s in namespace %s references port %s on backend service %s which does not exist!",
+			ingress.Name,
+			ingress.Namespace,
+			backend.ServicePort.String(),
+			backend.ServiceName,
+		)
+		alert := objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "ingresses/"+alertSpec.Name, "MissingBackendPort", "Ingress", ingress, alertmessage)
+		alert.Labels = map[string]string{"service": backend.ServiceName, "port": backend.ServicePort.String()}
+		alertFn(alert, alertersConfig)
+	}
+
+	if alertSpec.ReportStatus.NoReadyEndpoints && service.Spec.Type != corev1.ServiceTypeExternalName {
+		ready, _, err := countEndpoints(clientset, service.Namespace, service.Name)
+		if err != nil {
+			return err
+		}
+		if ready == 0 {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Ingress %s in namespace %s routes to backend service %s which has no ready endpoints!",
+				ingress.Name,
+				ingress.Namespace,
+				backend.ServiceName,
+			)
+			alert := objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "ingresses/"+alertSpec.Name, "NoReadyEndpoints", "Ingress", ingress, alertmessage)
+			alert.Labels = map[string]string{"service": backend.ServiceName}
+			alertFn(alert, alertersConfig)
+		}
+	}
+	return nil
+}
+
+// ingressBackends returns every distinct backend referenced by an ingress
+func ingressBackends(ingress *extensionsv1beta1.Ingress) []extensionsv1beta1.IngressBackend {
+	backends := []extensionsv1beta1.IngressBackend{}
+	seen := map[string]bool{}
+	add := func(backend extensionsv1beta1.IngressBackend) {
+		key := backend.ServiceName + ":" + backend.ServicePort.String()
+		if !seen[key] {
+			seen[key] = true
+			backends = append(backends, backend)
+		}
+	}
+
+	if ingress.Spec.Backend != nil {
+		add(*ingress.Spec.Backend)
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			add(path.Backend)
+		}
+	}
+	return backends
+}
+
+// servicePortExists checks a service exposes the port an ingress refers to, by number or by name
+func servicePortExists(service *corev1.Service, port intstr.IntOrString) bool {
+	for _, servicePort := range service.Spec.Ports {
+		if port.Type == intstr.Int && servicePort.Port == port.IntVal {
+			return true
+		}
+		if port.Type == intstr.String && servicePort.Name == port.StrVal {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_PollIngress_ok(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	defaultIngressMeta := metav1.ObjectMeta{
+		CreationTimestamp: metav1.Time{Time: time.Now().Add(time.Second * -600)},
+		Name:              "test-ingress",
+		Namespace:         metav1.NamespaceDefault,
+	}
+	ingress := func(port intstr.IntOrString, secretName string, lbIngress []corev1.LoadBalancerIngress) *extensionsv1beta1.Ingress {
+		return &extensionsv1beta1.Ingress{
+			ObjectMeta: defaultIngressMeta,
+			Spec: extensionsv1beta1.IngressSpec{
+				TLS: []extensionsv1beta1.IngressTLS{{SecretName: secretName}},
+				Rules: []extensionsv1beta1.IngressRule{
+					{
+						Host: "test.example.com",
+						IngressRuleValue: extensionsv1beta1.IngressRuleValue{
+							HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
+								Paths: []extensionsv1beta1.HTTPIngressPath{
+									{
+										Path: "/",
+										Backend: extensionsv1beta1.IngressBackend{
+											ServiceName: "test-service",
+											ServicePort: port,
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			Status: extensionsv1beta1.IngressStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{Ingress: lbIngress},
+			},
+		}
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-service",
+			Namespace: metav1.NamespaceDefault,
+		},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+	readyEndpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-service",
+			Namespace: metav1.NamespaceDefault,
+		},
+		Subsets: []corev1.EndpointSubset{
+			{Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}}},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-tls",
+			Namespace: metav1.NamespaceDefault,
+		},
+	}
+	allChecks := IngressAlertStatus{
+		MissingBackends:       true,
+		NoReadyEndpoints:      true,
+		MissingTLSSecrets:     true,
+		LoadBalancerThreshold: 300,
+	}
+
+	tests := []struct {
+		alertSpec   IngressAlertSpec
+		name        string
+		objects     []runtime.Object
+		shouldAlert bool
+	}{
+		{
+			name: "healthy ingress: no alert",
+			objects: []runtime.Object{
+				ingress(intstr.FromString("http"), "test-tls", []corev1.LoadBalancerIngress{{IP: "192.0.2.10"}}),
+				service,
+				readyEndpoints,
+				secret,
+			},
+			alertSpec: IngressAlertSpec{
+				Name:                   "test-ingress",
+				IngressFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus:           allChecks,
+			},
+		},
+		{
+			name: "missing backend service: alert",
+			objects: []runtime.Object{
+				ingress(intstr.FromInt(80), "", []corev1.LoadBalancerIngress{{IP: "192.0.2.10"}}),
+			},
+			alertSpec: IngressAlertSpec{
+				Name:                   "test-ingress",
+				IngressFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus:           IngressAlertStatus{MissingBackends: true},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "missing backend port: alert",
+			objects: []runtime.Object{
+				ingress(intstr.FromInt(8080), "", []corev1.LoadBalancerIngress{{IP: "192.0.2.10"}}),
+				service,
+			},
+			alertSpec: IngressAlertSpec{
+				Name:                   "test-ingress",
+				IngressFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus:           IngressAlertStatus{MissingBackends: true},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "backend without ready endpoints: alert",
+			objects: []runtime.Object{
+				ingress(intstr.FromInt(80), "", []corev1.LoadBalancerIngress{{IP: "192.0.2.10"}}),
+				service,
+			},
+			alertSpec: IngressAlertSpec{
+				Name:                   "test-ingress",
+				IngressFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus:           IngressAlertStatus{NoReadyEndpoints: true},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, missing TLS secret: alert",
+			objects: []runtime.Object{
+				ingress(intstr.FromInt(80), "test-tls", []corev1.LoadBalancerIngress{{IP: "192.0.2.10"}}),
+			},
+			alertSpec: IngressAlertSpec{
+				Name:         "*",
+				ReportStatus: IngressAlertStatus{MissingTLSSecrets: true},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, empty load balancer status past threshold: alert",
+			objects: []runtime.Object{
+				ingress(intstr.FromInt(80), "", nil),
+			},
+			alertSpec: IngressAlertSpec{
+				Name:         "*",
+				ReportStatus: IngressAlertStatus{LoadBalancerThreshold: 300},
+			},
+			shouldAlert: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			client := fake.NewSimpleClientset(test.objects...)
+			stubCalled := false
+			alertStub := func(_ Alert, _ AlertersConfig) {
+				stubCalled = true
+			}
+			err := PollIngress(client, test.alertSpec, defaultTickerTime, alertStub, conf)
+			if err != nil {
+				subT.Errorf("PollIngress returned an unexpected error: %s", err.Error())
+			}
+			if test.shouldAlert != stubCalled {
+				subT.Errorf("alert function called: %t, expected: %t", stubCalled, test.shouldAlert)
+			}
+		})
+	}
+}
@@ -16,15 +16,19 @@ package queries
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/bloomberg/k8eraid/pkgs/types"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/client-go/kubernetes"
 )
 
+var nodeObservations = newObservations()
+
 // PollNode function takes inputs and iterates across nodes in the kubernetes cluster, triggering alerts as needed.
 func PollNode(
 	clientset kubernetes.Interface,
@@ -33,6 +37,7 @@ func PollNode(
 	alertFn alertFunction,
 	alertersConfig types.AlertersConfig,
 ) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
 
 	if alertSpec.ReportStatus.PendingThreshold == 0 {
 		alertSpec.ReportStatus.PendingThreshold = 10
@@ -50,6 +55,10 @@ func PollNode(
 
 		checkNode(node, alertSpec, tickertime, alertFn, alertersConfig)
 
+		if err := checkNodeVersions(clientset, []corev1.Node{*node}, alertSpec, alertFn, alertersConfig); err != nil {
+			return err
+		}
+
 		// If nodename is a wildcard, list based on filter and iterate through
 	} else {
 		listopts := metav1.ListOptions{
@@ -71,7 +80,45 @@ func PollNode(
 		if int32(len(nodes.Items)) < alertSpec.ReportStatus.MinNodes {
 			// ALERT
 			alertmessage := fmt.Sprint("Node count with filter", alertSpec.NodeFilter, "in under minimum specification!")
-			alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+			alertFn(types.Alert{
+				AlerterType: alertSpec.AlerterType,
+				AlerterName: alertSpec.AlerterName,
+				Rule:        "nodes/" + alertSpec.Name,
+				Check:       "MinNodes",
+				Kind:        "Node",
+				Message:     alertmessage,
+				Labels:      map[string]string{"filter": alertSpec.NodeFilter},
+			}, alertersConfig)
+		}
+
+		// Check to see if enough of the matching nodes are accepting new pods
+		if alertSpec.ReportStatus.MinSchedulableRatio > 0 && len(nodes.Items) > 0 {
+			schedulable := 0
+			for _, nodedata := range nodes.Items {
+				if !nodedata.Spec.Unschedulable {
+					schedulable++
+				}
+			}
+			ratio := float64(schedulable) / float64(len(nodes.Items))
+			if ratio < alertSpec.ReportStatus.MinSchedulableRatio {
+				// ALERT
+				alertmessage := fmt.Sprintf(
+					"Only %d of %d nodes with filter %q are schedulable, under the minimum ratio of %.2f!",
+					schedulable,
+					len(nodes.Items),
+					alertSpec.NodeFilter,
+					alertSpec.ReportStatus.MinSchedulableRatio,
+				)
+				alertFn(types.Alert{
+					AlerterType: alertSpec.AlerterType,
+					AlerterName: alertSpec.AlerterName,
+					Rule:        "nodes/" + alertSpec.Name,
+					Check:       "MinSchedulableRatio",
+					Kind:        "Node",
+					Message:     alertmessage,
+					Labels:      map[string]string{"filter": alertSpec.NodeFilter},
+				}, alertersConfig)
+			}
 		}
 
 		// Iterate through node items
@@ -84,6 +131,10 @@ func PollNode(
 			}
 			checkNode(node, alertSpec, tickertime, alertFn, alertersConfig)
 		}
+
+		if err := checkNodeVersions(clientset, nodes.Items, alertSpec, alertFn, alertersConfig); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -96,6 +147,11 @@ func checkNode(
 	alertersConfig types.AlertersConfig,
 ) {
 
+	checkExpression(alertSpec.Expression, "nodes/"+alertSpec.Name, "Node", node, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
+	checkNodeScheduling(node, alertSpec, alertFn, alertersConfig)
+	checkNodeNotReady(node, alertSpec, alertFn, alertersConfig)
+
 	nowSeconds := time.Now().Unix()
 	statusCreatedSecondsDiff := nowSeconds - node.ObjectMeta.CreationTimestamp.Unix()
 
@@ -104,34 +160,294 @@ func checkNode(
 		for _, condition := range node.Status.Conditions {
 			transitiontimeDiff := nowSeconds - condition.LastTransitionTime.Unix()
 			if condition.Type == "Ready" {
+				if checkFlapping(nodeFlaps, alertSpec.ReportStatus.FlapThreshold, alertSpec.ReportStatus.FlapWindow, "nodes/"+alertSpec.Name, "Node", node,
+					condition.LastTransitionTime.Time, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig) {
+					continue
+				}
 				if transitiontimeDiff < tickertime && alertSpec.ReportStatus.NodeReady {
 					// ALERT
 					alertmessage := fmt.Sprint("Node", alertSpec.Name, "has changed ready status since last poll and may be restarting!")
-					alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+					alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "nodes/"+alertSpec.Name, "NodeReadyChanged", "Node", node, alertmessage), alertersConfig)
 					return
 				}
 			} else if condition.Type == "OutOfDisk" {
 				if transitiontimeDiff < tickertime && alertSpec.ReportStatus.NodeOutOfDisk {
 					// ALERT
 					alertmessage := fmt.Sprint("Node", alertSpec.Name, "has changed OutOfDisk status since last poll and may have observed disk space issues!")
-					alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+					alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "nodes/"+alertSpec.Name, "OutOfDisk", "Node", node, alertmessage), alertersConfig)
 					return
 				}
 			} else if condition.Type == "MemoryPressure" {
 				if transitiontimeDiff < tickertime && alertSpec.ReportStatus.NodeMemoryPressure {
 					// ALERT
 					alertmessage := fmt.Sprint("Node", alertSpec.Name, "has changed MemoryPressure status since last poll and may have observed memory pressure!")
-					alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+					alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "nodes/"+alertSpec.Name, "MemoryPressure", "Node", node, alertmessage), alertersConfig)
 					return
 				}
 			} else if condition.Type == "DiskPressure" {
 				if transitiontimeDiff < tickertime && alertSpec.ReportStatus.NodeDiskPressure {
 					// ALERT
 					alertmessage := fmt.Sprint("Node", alertSpec.Name, "has changed DiskPressure tatus since last poll and may have observed disk pressure!")
-					alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+					alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "nodes/"+alertSpec.Name, "DiskPressure", "Node", node, alertmessage), alertersConfig)
 					return
 				}
 			}
 		}
 	}
 }
+
+// checkNodeNotReady alerts on every poll while a node has not been Ready for longer than the configured threshold,
+// unlike the readiness check which only alerts on the poll the status changed
+func checkNodeNotReady(
+	node *corev1.Node,
+	alertSpec types.NodeAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) {
+	if alertSpec.ReportStatus.NotReadyThreshold == 0 {
+		return
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != corev1.NodeReady || condition.Status == corev1.ConditionTrue {
+			continue
+		}
+		notReadySeconds := time.Now().Unix() - condition.LastTransitionTime.Unix()
+		if notReadySeconds >= alertSpec.ReportStatus.NotReadyThreshold {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Node %s has been NotReady (%s) for %d seconds: %s",
+				node.Name,
+				condition.Reason,
+				notReadySeconds,
+				condition.Message,
+			)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "nodes/"+alertSpec.Name, "NodeNotReady", "Node", node, alertmessage), alertersConfig)
+		}
+	}
+}
+
+// checkNodeScheduling alerts on nodes left cordoned or tainted for longer than the configured thresholds
+func checkNodeScheduling(
+	node *corev1.Node,
+	alertSpec types.NodeAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) {
+	now := time.Now()
+
+	// The API does not record when a node was cordoned, so track it ourselves
+	unschedulableKey := "unschedulable/" + node.Name
+	if node.Spec.Unschedulable {
+		cordonedSeconds := nodeObservations.since(unschedulableKey, now)
+		if alertSpec.ReportStatus.UnschedulableThreshold > 0 && cordonedSeconds >= alertSpec.ReportStatus.UnschedulableThreshold {
+			// ALERT
+			alertmessage := fmt.Sprintf("Node %s has been unschedulable for %d seconds and may have been left cordoned!", node.Name, cordonedSeconds)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "nodes/"+alertSpec.Name, "Unschedulable", "Node", node, alertmessage), alertersConfig)
+		}
+	} else {
+		nodeObservations.forget(unschedulableKey)
+	}
+
+	for _, wanted := range alertSpec.ReportStatus.Taints {
+		taintKey := fmt.Sprintf("taint/%s/%s:%s", node.Name, wanted.Key, wanted.Effect)
+		taint := findTaint(node.Spec.Taints, wanted)
+		if taint == nil {
+			nodeObservations.forget(taintKey)
+			continue
+		}
+
+		var taintedSeconds int64
+		if taint.TimeAdded != nil {
+			taintedSeconds = now.Unix() - taint.TimeAdded.Unix()
+		} else {
+			taintedSeconds = nodeObservations.since(taintKey, now)
+		}
+		if taintedSeconds >= alertSpec.ReportStatus.TaintThreshold {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Node %s has carried taint %s:%s for %d seconds!",
+				node.Name,
+				taint.Key,
+				taint.Effect,
+				taintedSeconds,
+			)
+			alert := objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "nodes/"+alertSpec.Name, "Tainted", "Node", node, alertmessage)
+			alertFn(withLabels(alert, map[string]string{"taint": fmt.Sprintf("%s:%s", taint.Key, taint.Effect)}), alertersConfig)
+		}
+	}
+}
+
+// findTaint returns the first taint matching the key, and effect if one is given
+func findTaint(taints []corev1.Taint, wanted types.NodeTaint) *corev1.Taint {
+	for i := range taints {
+		if taints[i].Key != wanted.Key {
+			continue
+		}
+		if wanted.Effect == "" || string(taints[i].Effect) == wanted.Effect {
+			return &taints[i]
+		}
+	}
+	return nil
+}
+
+// checkNodeVersions alerts on kubelet versions skewed from the API server or from each other
+func checkNodeVersions(
+	clientset kubernetes.Interface,
+	nodes []corev1.Node,
+	alertSpec types.NodeAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+
+	if !alertSpec.ReportStatus.KubeletVersionSkew && alertSpec.ReportStatus.MixedVersionThreshold == 0 {
+		return nil
+	}
+
+	nodeNames := []string{}
+	kubeletVersions := map[string]*version.Version{}
+	for _, node := range nodes {
+		kubeletVersion, err := version.ParseGeneric(node.Status.NodeInfo.KubeletVersion)
+		if err != nil {
+			// Nodes that have not reported a version yet are left to the readiness checks
+			continue
+		}
+		nodeNames = append(nodeNames, node.Name)
+		kubeletVersions[node.Name] = kubeletVersion
+	}
+	sort.Strings(nodeNames)
+
+	if alertSpec.ReportStatus.KubeletVersionSkew {
+		serverInfo, err := clientset.Discovery().ServerVersion()
+		if err != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("Unable to get API server version: %s", err.Error()),
+			}
+		}
+		serverVersion, err := version.ParseGeneric(serverInfo.GitVersion)
+		if err != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("Unable to parse API server version %s: %s", serverInfo.GitVersion, err.Error()),
+			}
+		}
+
+		var oldest, newest *version.Version
+		for _, nodeName := range nodeNames {
+			kubeletVersion := kubeletVersions[nodeName]
+			if oldest == nil || kubeletVersion.LessThan(oldest) {
+				oldest = kubeletVersion
+			}
+			if newest == nil || newest.LessThan(kubeletVersion) {
+				newest = kubeletVersion
+			}
+
+			if skew := minorSkew(serverVersion, kubeletVersion); skew < 0 {
+				// ALERT
+				alertmessage := fmt.Sprintf(
+					"Node %s is running kubelet %s which is newer than the API server version %s!",
+					nodeName,
+					kubeletVersion,
+					serverVersion,
+				)
+				alertFn(types.Alert{
+					AlerterType: alertSpec.AlerterType,
+					AlerterName: alertSpec.AlerterName,
+					Rule:        "nodes/" + alertSpec.Name,
+					Check:       "KubeletVersionSkew",
+					Kind:        "Node",
+					Name:        nodeName,
+					Message:     alertmessage,
+					Labels:      map[string]string{"node": nodeName},
+				}, alertersConfig)
+			} else if skew > alertSpec.ReportStatus.MaxMinorVersionSkew {
+				// ALERT
+				alertmessage := fmt.Sprintf(
+					"Node %s is running kubelet %s which is %d minor versions behind the API server version %s!",
+					nodeName,
+					kubeletVersion,
+					skew,
+					serverVersion,
+				)
+				alertFn(types.Alert{
+					AlerterType: alertSpec.AlerterType,
+					AlerterName: alertSpec.AlerterName,
+					Rule:        "nodes/" + alertSpec.Name,
+					Check:       "KubeletVersionSkew",
+					Kind:        "Node",
+					Name:        nodeName,
+					Message:     alertmessage,
+					Labels:      map[string]string{"node": nodeName},
+				}, alertersConfig)
+			}
+		}
+
+		if oldest != nil && minorSkew(newest, oldest) > alertSpec.ReportStatus.MaxMinorVersionSkew {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Nodes with filter %q are running kubelet versions from %s to %s, exceeding the allowed skew of %d minor versions!",
+				alertSpec.NodeFilter,
+				oldest,
+				newest,
+				alertSpec.ReportStatus.MaxMinorVersionSkew,
+			)
+			alertFn(types.Alert{
+				AlerterType: alertSpec.AlerterType,
+				AlerterName: alertSpec.AlerterName,
+				Rule:        "nodes/" + alertSpec.Name,
+				Check:       "KubeletVersionSkew",
+				Kind:        "Node",
+				Message:     alertmessage,
+				Labels:      map[string]string{"filter": alertSpec.NodeFilter},
+			}, alertersConfig)
+		}
+	}
+
+	if alertSpec.ReportStatus.MixedVersionThreshold > 0 {
+		distinct := []string{}
+		seen := map[string]bool{}
+		for _, nodeName := range nodeNames {
+			if kubeletVersion := kubeletVersions[nodeName].String(); !seen[kubeletVersion] {
+				seen[kubeletVersion] = true
+				distinct = append(distinct, kubeletVersion)
+			}
+		}
+		sort.Strings(distinct)
+
+		mixedKey := fmt.Sprintf("versions/%s/%s", alertSpec.Name, alertSpec.NodeFilter)
+		if len(distinct) > 1 {
+			mixedSeconds := nodeObservations.since(mixedKey, time.Now())
+			if mixedSeconds >= alertSpec.ReportStatus.MixedVersionThreshold {
+				// ALERT
+				alertmessage := fmt.Sprintf(
+					"Nodes with filter %q have been running %d different kubelet versions (%v) for %d seconds, an upgrade may be stuck!",
+					alertSpec.NodeFilter,
+					len(distinct),
+					distinct,
+					mixedSeconds,
+				)
+				alertFn(types.Alert{
+					AlerterType: alertSpec.AlerterType,
+					AlerterName: alertSpec.AlerterName,
+					Rule:        "nodes/" + alertSpec.Name,
+					Check:       "MixedKubeletVersions",
+					Kind:        "Node",
+					Message:     alertmessage,
+					Labels:      map[string]string{"filter": alertSpec.NodeFilter},
+				}, alertersConfig)
+			}
+		} else {
+			nodeObservations.forget(mixedKey)
+		}
+	}
+	return nil
+}
+
+// minorSkew returns how many minor versions older is than newer, or a large skew if the major versions differ
+func minorSkew(newer, older *version.Version) int64 {
+	if newer.Major() != older.Major() {
+		if newer.Major() < older.Major() {
+			return -1 << 16
+		}
+		return 1 << 16
+	}
+	return int64(newer.Minor()) - int64(older.Minor())
+}
@@ -22,6 +22,9 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
 	"k8s.io/client-go/kubernetes/fake"
 )
 
@@ -173,7 +176,7 @@ func Test_PollNode_ok(t *testing.T) {
 		t.Run(test.name, func(subT *testing.T) {
 			client := fake.NewSimpleClientset(test.node)
 			stubCalled := false
-			alertStub := func(_ string, _ string, _ string, _ AlertersConfig) {
+			alertStub := func(_ Alert, _ AlertersConfig) {
 				stubCalled = true
 			}
 			err := PollNode(client, test.alertSpec, defaultTickerTime, alertStub, conf)
@@ -188,3 +191,353 @@ func Test_PollNode_ok(t *testing.T) {
 		})
 	}
 }
+
+func Test_PollNode_scheduling(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	tests := []struct {
+		alertSpec   NodeAlertSpec
+		name        string
+		nodes       []runtime.Object
+		firstSeen   map[string]time.Time
+		shouldAlert bool
+	}{
+		{
+			name: "cordoned node, first seen: no alert",
+			nodes: []runtime.Object{
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+					Spec:       corev1.NodeSpec{Unschedulable: true},
+				},
+			},
+			alertSpec: NodeAlertSpec{
+				Name: "test-node",
+				ReportStatus: NodeAlertStatus{
+					UnschedulableThreshold: 60,
+				},
+			},
+		},
+		{
+			name: "cordoned node, over threshold: alert",
+			nodes: []runtime.Object{
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+					Spec:       corev1.NodeSpec{Unschedulable: true},
+				},
+			},
+			firstSeen: map[string]time.Time{
+				"unschedulable/test-node": time.Now().Add(time.Second * -120),
+			},
+			alertSpec: NodeAlertSpec{
+				Name: "test-node",
+				ReportStatus: NodeAlertStatus{
+					UnschedulableThreshold: 60,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "tainted node, over threshold: alert",
+			nodes: []runtime.Object{
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{
+								Key:       "node.kubernetes.io/unreachable",
+								Effect:    corev1.TaintEffectNoExecute,
+								TimeAdded: &metav1.Time{Time: time.Now().Add(time.Second * -600)},
+							},
+						},
+					},
+				},
+			},
+			alertSpec: NodeAlertSpec{
+				Name: "test-node",
+				ReportStatus: NodeAlertStatus{
+					Taints:         []NodeTaint{{Key: "node.kubernetes.io/unreachable"}},
+					TaintThreshold: 300,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "tainted node, other effect: no alert",
+			nodes: []runtime.Object{
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+					Spec: corev1.NodeSpec{
+						Taints: []corev1.Taint{
+							{
+								Key:       "dedicated",
+								Effect:    corev1.TaintEffectPreferNoSchedule,
+								TimeAdded: &metav1.Time{Time: time.Now().Add(time.Second * -600)},
+							},
+						},
+					},
+				},
+			},
+			alertSpec: NodeAlertSpec{
+				Name: "test-node",
+				ReportStatus: NodeAlertStatus{
+					Taints: []NodeTaint{{Key: "dedicated", Effect: "NoSchedule"}},
+				},
+			},
+		},
+		{
+			name: "not ready node, over threshold: alert",
+			nodes: []runtime.Object{
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+					Status: corev1.NodeStatus{
+						Conditions: []corev1.NodeCondition{
+							{
+								Type:               corev1.NodeReady,
+								Status:             corev1.ConditionUnknown,
+								LastTransitionTime: metav1.Time{Time: time.Now().Add(time.Second * -600)},
+							},
+						},
+					},
+				},
+			},
+			alertSpec: NodeAlertSpec{
+				Name: "test-node",
+				ReportStatus: NodeAlertStatus{
+					NotReadyThreshold: 300,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "not ready node, under threshold: no alert",
+			nodes: []runtime.Object{
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+					Status: corev1.NodeStatus{
+						Conditions: []corev1.NodeCondition{
+							{
+								Type:               corev1.NodeReady,
+								Status:             corev1.ConditionFalse,
+								LastTransitionTime: metav1.Time{Time: time.Now().Add(time.Second * -60)},
+							},
+						},
+					},
+				},
+			},
+			alertSpec: NodeAlertSpec{
+				Name: "test-node",
+				ReportStatus: NodeAlertStatus{
+					NotReadyThreshold: 300,
+				},
+			},
+		},
+		{
+			name: "wildcard, half of nodes schedulable: alert",
+			nodes: []runtime.Object{
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-node-1"},
+				},
+				&corev1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-node-2"},
+					Spec:       corev1.NodeSpec{Unschedulable: true},
+				},
+			},
+			alertSpec: NodeAlertSpec{
+				Name: "*",
+				ReportStatus: NodeAlertStatus{
+					MinSchedulableRatio: 0.75,
+				},
+			},
+			shouldAlert: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			nodeObservations = newObservations()
+			for key, first := range test.firstSeen {
+				nodeObservations.firstSeen[key] = first
+			}
+			client := fake.NewSimpleClientset(test.nodes...)
+			stubCalled := false
+			alertStub := func(_ Alert, _ AlertersConfig) {
+				stubCalled = true
+			}
+			err := PollNode(client, test.alertSpec, defaultTickerTime, alertStub, conf)
+			if err != nil {
+				subT.Errorf("PollNode returned an unexpected error: %s", err.Error())
+			}
+			if test.shouldAlert != stubCalled {
+				subT.Errorf("alert function called: %t, expected: %t", stubCalled, test.shouldAlert)
+			}
+		})
+	}
+}
+
+func Test_PollNode_taint_labels(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	nodeObservations = newObservations()
+	client := fake.NewSimpleClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-node"},
+		Spec: corev1.NodeSpec{
+			Taints: []corev1.Taint{
+				{
+					Key:       "node.kubernetes.io/unreachable",
+					Effect:    corev1.TaintEffectNoExecute,
+					TimeAdded: &metav1.Time{Time: time.Now().Add(time.Second * -600)},
+				},
+			},
+		},
+	})
+	alertSpec := NodeAlertSpec{
+		Name: "test-node",
+		ReportStatus: NodeAlertStatus{
+			Taints:         []NodeTaint{{Key: "node.kubernetes.io/unreachable"}},
+			TaintThreshold: 300,
+		},
+	}
+	alerts := []Alert{}
+	alertStub := func(alert Alert, _ AlertersConfig) {
+		alerts = append(alerts, alert)
+	}
+	if err := PollNode(client, alertSpec, defaultTickerTime, alertStub, conf); err != nil {
+		t.Fatalf("PollNode returned an unexpected error: %s", err.Error())
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("expected one taint alert, got %d", len(alerts))
+	}
+	if alerts[0].Labels["node"] != "test-node" || alerts[0].Labels["taint"] != "node.kubernetes.io/unreachable:NoExecute" {
+		t.Errorf("expected the taint alert to be labelled with its node and taint, got %v", alerts[0].Labels)
+	}
+}
+
+func Test_PollNode_versions(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	kubeletNode := func(name, kubeletVersion string) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				NodeInfo: corev1.NodeSystemInfo{KubeletVersion: kubeletVersion},
+			},
+		}
+	}
+
+	tests := []struct {
+		alertSpec     NodeAlertSpec
+		name          string
+		nodes         []runtime.Object
+		serverVersion string
+		firstSeen     map[string]time.Time
+		shouldAlert   bool
+	}{
+		{
+			name:          "kubelet within skew policy: no alert",
+			nodes:         []runtime.Object{kubeletNode("test-node", "v1.12.3")},
+			serverVersion: "v1.13.1",
+			alertSpec: NodeAlertSpec{
+				Name: "test-node",
+				ReportStatus: NodeAlertStatus{
+					KubeletVersionSkew:  true,
+					MaxMinorVersionSkew: 2,
+				},
+			},
+		},
+		{
+			name:          "kubelet behind skew policy: alert",
+			nodes:         []runtime.Object{kubeletNode("test-node", "v1.10.3")},
+			serverVersion: "v1.13.1",
+			alertSpec: NodeAlertSpec{
+				Name: "test-node",
+				ReportStatus: NodeAlertStatus{
+					KubeletVersionSkew:  true,
+					MaxMinorVersionSkew: 2,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name:          "kubelet newer than API server: alert",
+			nodes:         []runtime.Object{kubeletNode("test-node", "v1.14.0")},
+			serverVersion: "v1.13.1",
+			alertSpec: NodeAlertSpec{
+				Name: "test-node",
+				ReportStatus: NodeAlertStatus{
+					KubeletVersionSkew:  true,
+					MaxMinorVersionSkew: 2,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, kubelets skewed from each other: alert",
+			nodes: []runtime.Object{
+				kubeletNode("test-node-1", "v1.13.1"),
+				kubeletNode("test-node-2", "v1.12.3"),
+			},
+			serverVersion: "v1.13.1",
+			alertSpec: NodeAlertSpec{
+				Name: "*",
+				ReportStatus: NodeAlertStatus{
+					KubeletVersionSkew:  true,
+					MaxMinorVersionSkew: 0,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, mixed versions under deadline: no alert",
+			nodes: []runtime.Object{
+				kubeletNode("test-node-1", "v1.13.1"),
+				kubeletNode("test-node-2", "v1.13.0"),
+			},
+			alertSpec: NodeAlertSpec{
+				Name: "*",
+				ReportStatus: NodeAlertStatus{
+					MixedVersionThreshold: 3600,
+				},
+			},
+		},
+		{
+			name: "wildcard, mixed versions past deadline: alert",
+			nodes: []runtime.Object{
+				kubeletNode("test-node-1", "v1.13.1"),
+				kubeletNode("test-node-2", "v1.13.0"),
+			},
+			firstSeen: map[string]time.Time{
+				"versions/*/": time.Now().Add(time.Second * -7200),
+			},
+			alertSpec: NodeAlertSpec{
+				Name: "*",
+				ReportStatus: NodeAlertStatus{
+					MixedVersionThreshold: 3600,
+				},
+			},
+			shouldAlert: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			nodeObservations = newObservations()
+			for key, first := range test.firstSeen {
+				nodeObservations.firstSeen[key] = first
+			}
+			client := fake.NewSimpleClientset(test.nodes...)
+			client.Discovery().(*fakediscovery.FakeDiscovery).FakedServerVersion = &version.Info{GitVersion: test.serverVersion}
+			stubCalled := false
+			alertStub := func(_ Alert, _ AlertersConfig) {
+				stubCalled = true
+			}
+			err := PollNode(client, test.alertSpec, defaultTickerTime, alertStub, conf)
+			if err != nil {
+				subT.Errorf("PollNode returned an unexpected error: %s", err.Error())
+			}
+			if test.shouldAlert != stubCalled {
+				subT.Errorf("alert function called: %t, expected: %t", stubCalled, test.shouldAlert)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"sync"
+	"time"
+)
+
+// observations remembers when a state was first seen across polls. It is used for
+// checks where the Kubernetes API does not record a timestamp for the state we care about.
+type observations struct {
+	mu        sync.Mutex
+	firstSeen map[string]time.Time
+}
+
+func newObservations() *observations {
+	return &observations{firstSeen: map[string]time.Time{}}
+}
+
+// since records key as observed (if it was not already) and returns how many seconds it has been observed for
+func (o *observations) since(key string, now time.Time) int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	first, ok := o.firstSeen[key]
+	if !ok {
+		o.firstSeen[key] = now
+		return 0
+	}
+	return now.Unix() - first.Unix()
+}
+
+// forget clears key, so that the next observation starts counting again
+func (o *observations) forget(key string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.firstSeen, key)
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Pods listed by name in an aggregated alert, any more are only counted
+const maxListedPods = 20
+
+// podFailure is a pod that failed one or more checks
+type podFailure struct {
+	pod     *corev1.Pod
+	reasons []string
+}
+
+// podOwner is the top level controller of a pod, or the pod itself when it has none
+type podOwner struct {
+	Kind      string
+	Namespace string
+	Name      string
+	UID       string
+}
+
+// ownerResolver walks ownerReferences up to the top level controller, caching the
+// intermediate ReplicaSets and Jobs so pods sharing an owner only look it up once per poll
+type ownerResolver struct {
+	clientset kubernetes.Interface
+	resolved  map[string]podOwner
+}
+
+func newOwnerResolver(clientset kubernetes.Interface) *ownerResolver {
+	return &ownerResolver{clientset: clientset, resolved: map[string]podOwner{}}
+}
+
+// podOwner resolves Pod -> ReplicaSet -> Deployment, Pod -> Job -> CronJob and Pod -> StatefulSet (or any other
+// controller). When an intermediate owner can not be fetched the chain stops there, rather than failing the alert.
+func (r *ownerResolver) podOwner(pod *corev1.Pod) podOwner {
+	controller := metav1.GetControllerOf(pod)
+	if controller == nil {
+		return podOwner{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name, UID: string(pod.UID)}
+	}
+	owner := podOwner{Kind: controller.Kind, Namespace: pod.Namespace, Name: controller.Name, UID: string(controller.UID)}
+	if owner.Kind != "ReplicaSet" && owner.Kind != "Job" {
+		return owner
+	}
+
+	key := fmt.Sprintf("%s/%s/%s", owner.Kind, owner.Namespace, owner.Name)
+	if resolved, ok := r.resolved[key]; ok {
+		return resolved
+	}
+	var parent metav1.Object
+	var err error
+	if owner.Kind == "ReplicaSet" {
+		parent, err = r.clientset.AppsV1().ReplicaSets(owner.Namespace).Get(owner.Name, metav1.GetOptions{})
+	} else {
+		parent, err = r.clientset.BatchV1().Jobs(owner.Namespace).Get(owner.Name, metav1.GetOptions{})
+	}
+	if err == nil {
+		if parentController := metav1.GetControllerOf(parent); parentController != nil {
+			owner = podOwner{Kind: parentController.Kind, Namespace: owner.Namespace, Name: parentController.Name, UID: string(parentController.UID)}
+		}
+	}
+	r.resolved[key] = owner
+	return owner
+}
+
+// alertPodFailures sends one alert per pod owner, listing the affected pods and the reasons they failed
+func alertPodFailures(
+	clientset kubernetes.Interface,
+	failures []podFailure,
+	alertSpec types.PodAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) {
+	resolver := newOwnerResolver(clientset)
+	owners := []podOwner{}
+	failuresByOwner := map[podOwner][]podFailure{}
+	for _, failure := range failures {
+		owner := resolver.podOwner(failure.pod)
+		if _, ok := failuresByOwner[owner]; !ok {
+			owners = append(owners, owner)
+		}
+		failuresByOwner[owner] = append(failuresByOwner[owner], failure)
+	}
+
+	for _, owner := range owners {
+		// ALERT
+		node := failuresNode(failuresByOwner[owner])
+		alertmessage := podFailuresMessage(owner, node, failuresByOwner[owner])
+		alert := types.Alert{
+			AlerterType: alertSpec.AlerterType,
+			AlerterName: alertSpec.AlerterName,
+			Rule:        "pods/" + alertSpec.Name,
+			Check:       "PodFailures",
+			Kind:        owner.Kind,
+			Namespace:   owner.Namespace,
+			Name:        owner.Name,
+			UID:         owner.UID,
+			Message:     alertmessage,
+		}
+		if node != "" {
+			alert.Labels = map[string]string{"node": node}
+		}
+		alertFn(alert, alertersConfig)
+	}
+}
+
+// failuresNode returns the node every failing pod is on, so the alert can be inhibited by that node's alert.
+// It is empty when the pods are spread over several nodes or not scheduled, as a broken node then does not
+// explain all of them.
+func failuresNode(failures []podFailure) string {
+	node := failures[0].pod.Spec.NodeName
+	for _, failure := range failures[1:] {
+		if failure.pod.Spec.NodeName != node {
+			return ""
+		}
+	}
+	return node
+}
+
+// podFailuresMessage describes the failing pods of an owner, with each reason followed by the pods it applies to.
+// The node is named when all the pods are on it, and empty otherwise.
+func podFailuresMessage(owner podOwner, node string, failures []podFailure) string {
+	podNames := []string{}
+	reasons := []string{}
+	podsByReason := map[string][]string{}
+	for _, failure := range failures {
+		podNames = append(podNames, failure.pod.Name)
+		for _, reason := range failure.reasons {
+			if _, ok := podsByReason[reason]; !ok {
+				reasons = append(reasons, reason)
+			}
+			podsByReason[reason] = append(podsByReason[reason], failure.pod.Name)
+		}
+	}
+	sort.Strings(podNames)
+
+	onNode := ""
+	if node != "" {
+		onNode = " on node " + node
+	}
+
+	lines := []string{}
+	if owner.Kind == "Pod" {
+		lines = append(lines, fmt.Sprintf("Pod %s in namespace %s is failing checks%s:", owner.Name, owner.Namespace, onNode))
+		for _, reason := range reasons {
+			lines = append(lines, fmt.Sprintf("- %s", reason))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	noun := "pods"
+	if len(podNames) == 1 {
+		noun = "pod"
+	}
+	lines = append(lines, fmt.Sprintf(
+		"%s %s in namespace %s has %d %s failing checks%s: %s",
+		owner.Kind,
+		owner.Name,
+		owner.Namespace,
+		len(podNames),
+		noun,
+		onNode,
+		listPods(podNames),
+	))
+	for _, reason := range reasons {
+		pods := podsByReason[reason]
+		if len(pods) == len(podNames) {
+			lines = append(lines, fmt.Sprintf("- %s (all pods)", reason))
+		} else {
+			sort.Strings(pods)
+			lines = append(lines, fmt.Sprintf("- %s (%s)", reason, listPods(pods)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// listPods joins pod names, cutting the list short for large owners
+func listPods(podNames []string) string {
+	if len(podNames) <= maxListedPods {
+		return strings.Join(podNames, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(podNames[:maxListedPods], ", "), len(podNames)-maxListedPods)
+}
@@ -0,0 +1,186 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func controllerRef(kind string, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func Test_PollPod_ownerAggregation(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	unscheduledPod := func(name string, owners []metav1.OwnerReference) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       metav1.NamespaceDefault,
+				Labels:          map[string]string{"app": "test"},
+				OwnerReferences: owners,
+			},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodScheduled, Status: corev1.ConditionFalse},
+				},
+			},
+		}
+	}
+	objects := []runtime.Object{
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "web-5d8f",
+				Namespace:       metav1.NamespaceDefault,
+				OwnerReferences: controllerRef("Deployment", "web"),
+			},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "backup-1560000000",
+				Namespace:       metav1.NamespaceDefault,
+				OwnerReferences: controllerRef("CronJob", "backup"),
+			},
+		},
+		unscheduledPod("web-5d8f-a", controllerRef("ReplicaSet", "web-5d8f")),
+		unscheduledPod("web-5d8f-b", controllerRef("ReplicaSet", "web-5d8f")),
+		unscheduledPod("web-5d8f-c", controllerRef("ReplicaSet", "web-5d8f")),
+		unscheduledPod("db-0", controllerRef("StatefulSet", "db")),
+		unscheduledPod("backup-1560000000-x", controllerRef("Job", "backup-1560000000")),
+		unscheduledPod("standalone", nil),
+	}
+	client := fake.NewSimpleClientset(objects...)
+
+	messages := []string{}
+	alertStub := func(alert Alert, _ AlertersConfig) {
+		messages = append(messages, alert.Message)
+	}
+	alertSpec := PodAlertSpec{
+		Name:           "*",
+		PodFilterLabel: "app=test",
+		ReportStatus:   PodAlertStatus{FailedScheduling: true},
+	}
+	if err := PollPod(client, alertSpec, defaultTickerTime, alertStub, conf); err != nil {
+		t.Fatalf("PollPod returned an unexpected error: %s", err.Error())
+	}
+
+	expected := []string{
+		"Deployment web in namespace default has 3 pods failing checks: web-5d8f-a, web-5d8f-b, web-5d8f-c",
+		"StatefulSet db in namespace default has 1 pod failing checks: db-0",
+		"CronJob backup in namespace default has 1 pod failing checks: backup-1560000000-x",
+		"Pod standalone in namespace default is failing checks:",
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("alert function called %d times, expected %d: %q", len(messages), len(expected), messages)
+	}
+	for _, want := range expected {
+		found := false
+		for _, message := range messages {
+			if strings.HasPrefix(message, want) && strings.Contains(message, "not scheduled yet") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("no alert starting with %q, got: %q", want, messages)
+		}
+	}
+}
+
+func Test_PollPod_nodeLabels(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	pendingPod := func(name string, node string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            name,
+				Namespace:       metav1.NamespaceDefault,
+				Labels:          map[string]string{"app": "test"},
+				OwnerReferences: controllerRef("StatefulSet", "db"),
+			},
+			Spec: corev1.PodSpec{NodeName: node},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{
+					{Type: corev1.PodScheduled, Status: corev1.ConditionFalse},
+				},
+			},
+		}
+	}
+	client := fake.NewSimpleClientset(
+		pendingPod("db-0", "worker-1"),
+		pendingPod("db-1", "worker-1"),
+		pendingPod("db-2", "worker-2"),
+	)
+
+	alertSpec := PodAlertSpec{
+		Name:           "*",
+		PodFilterLabel: "app=test",
+		ReportStatus:   PodAlertStatus{FailedScheduling: true},
+	}
+	alerts := []Alert{}
+	alertStub := func(alert Alert, _ AlertersConfig) {
+		alerts = append(alerts, alert)
+	}
+	if err := PollPod(client, alertSpec, defaultTickerTime, alertStub, conf); err != nil {
+		t.Fatalf("PollPod returned an unexpected error: %s", err.Error())
+	}
+	if len(alerts) != 1 || alerts[0].Labels["node"] != "" {
+		t.Errorf("expected one alert for the owner without a node label, as its pods are on several nodes, got: %+v", alerts)
+	}
+
+	// Once the pod on worker-2 is fixed, every failing pod is on worker-1
+	if err := client.CoreV1().Pods(metav1.NamespaceDefault).Delete("db-2", &metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unable to delete pod: %s", err.Error())
+	}
+	alerts = []Alert{}
+	if err := PollPod(client, alertSpec, defaultTickerTime, alertStub, conf); err != nil {
+		t.Fatalf("PollPod returned an unexpected error: %s", err.Error())
+	}
+	if len(alerts) != 1 || alerts[0].Labels["node"] != "worker-1" {
+		t.Errorf("expected one alert for the owner labelled with node worker-1, got: %+v", alerts)
+	}
+}
+
+func Test_podFailuresMessage(t *testing.T) {
+	pod := func(name string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault}}
+	}
+	owner := podOwner{Kind: "Deployment", Namespace: metav1.NamespaceDefault, Name: "web"}
+	message := podFailuresMessage(owner, "worker-1", []podFailure{
+		{pod: pod("web-b"), reasons: []string{"shared reason", "other reason"}},
+		{pod: pod("web-a"), reasons: []string{"shared reason"}},
+	})
+	expected := strings.Join([]string{
+		"Deployment web in namespace default has 2 pods failing checks on node worker-1: web-a, web-b",
+		"- shared reason (all pods)",
+		"- other reason (web-b)",
+	}, "\n")
+	if message != expected {
+		t.Errorf("podFailuresMessage returned:\n%s\nexpected:\n%s", message, expected)
+	}
+}
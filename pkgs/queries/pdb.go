@@ -0,0 +1,173 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var pdbObservations = newObservations()
+
+// PollPDB function takes inputs and iterates across pod disruption budgets in the kubernetes cluster, triggering alerts as needed.
+func PollPDB(
+	clientset kubernetes.Interface,
+	alertSpec types.PDBAlertSpec,
+	tickertime int64,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
+
+	if alertSpec.ReportStatus.PendingThreshold == 0 {
+		alertSpec.ReportStatus.PendingThreshold = 10
+	}
+
+	// If the PDB is not wildcard, search by name
+	if alertSpec.Name != "*" {
+		if alertSpec.PDBFilter == "" {
+			return &PollErr{
+				Message: fmt.Sprintf("PDB rule for %s has no namespace filter specified, ignoring", alertSpec.Name),
+			}
+		}
+
+		pdb, pdberr := clientset.PolicyV1beta1().PodDisruptionBudgets(alertSpec.PDBFilter).Get(alertSpec.Name, metav1.GetOptions{})
+		if pdberr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("Error fetching PDB %s: %s", alertSpec.Name, pdberr.Error()),
+			}
+		}
+		return checkPDB(clientset, pdb, alertSpec, alertFn, alertersConfig)
+
+		// If the PDB is a wildcard, list PDBs and iterate through
+	} else if strings.Contains(alertSpec.PDBFilter, "=") || alertSpec.PDBFilter == "" {
+		listopts := metav1.ListOptions{
+			LabelSelector:        alertSpec.PDBFilter,
+			IncludeUninitialized: false,
+			Watch:                false,
+			TimeoutSeconds:       &timeout,
+		}
+		pdbs, pdbserr := clientset.PolicyV1beta1().PodDisruptionBudgets("").List(listopts)
+		if pdbserr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("Unable to list PDBs: %s", pdbserr.Error()),
+			}
+		}
+		errs := []error{}
+		for i := range pdbs.Items {
+			if err := checkPDB(clientset, &pdbs.Items[i], alertSpec, alertFn, alertersConfig); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return combineErrors(errs)
+	} else {
+		return &PollErr{
+			Message: fmt.Sprintf("PDB rule for global has incorrect filter specified (filter was: %s), ignoring", alertSpec.PDBFilter),
+		}
+	}
+}
+
+func checkPDB(
+	clientset kubernetes.Interface,
+	pdb *policyv1beta1.PodDisruptionBudget,
+	alertSpec types.PDBAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	checkExpression(alertSpec.Expression, "pdbs/"+alertSpec.Name, "PodDisruptionBudget", pdb, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
+	now := time.Now()
+
+	// The PDB does not record how long it has been blocking evictions, so track it ourselves
+	blockedKey := fmt.Sprintf("blocked/%s/%s", pdb.Namespace, pdb.Name)
+	if pdb.Status.PodDisruptionsAllowed == 0 {
+		blockedSeconds := pdbObservations.since(blockedKey, now)
+		if alertSpec.ReportStatus.NoDisruptionsThreshold > 0 && blockedSeconds >= alertSpec.ReportStatus.NoDisruptionsThreshold {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"PDB %s in namespace %s has allowed 0 disruptions for %d seconds and will block node drains!",
+				pdb.Name,
+				pdb.Namespace,
+				blockedSeconds,
+			)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "pdbs/"+alertSpec.Name, "DisruptionsBlocked", "PodDisruptionBudget", pdb, alertmessage), alertersConfig)
+		}
+	} else {
+		pdbObservations.forget(blockedKey)
+	}
+
+	// Get times for comparing to threshold
+	statusCreatedSecondsDiff := now.Unix() - pdb.ObjectMeta.CreationTimestamp.Unix()
+
+	// If PDB hasnt been around longer than threshold, bail. otherwise check the status.
+	if statusCreatedSecondsDiff <= alertSpec.ReportStatus.PendingThreshold {
+		return nil
+	}
+
+	if alertSpec.ReportStatus.Unhealthy && pdb.Status.CurrentHealthy < pdb.Status.DesiredHealthy {
+		// ALERT
+		alertmessage := fmt.Sprintf(
+			"PDB %s in namespace %s has %d healthy pods, under the %d it requires!",
+			pdb.Name,
+			pdb.Namespace,
+			pdb.Status.CurrentHealthy,
+			pdb.Status.DesiredHealthy,
+		)
+		alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "pdbs/"+alertSpec.Name, "Unhealthy", "PodDisruptionBudget", pdb, alertmessage), alertersConfig)
+	}
+
+	if alertSpec.ReportStatus.NoMatchingPods {
+		matched := 0
+		// A PDB without a selector matches no pods
+		if pdb.Spec.Selector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+			if err != nil {
+				return &PollErr{
+					Message: fmt.Sprintf("PDB %s in namespace %s has an invalid selector: %s", pdb.Name, pdb.Namespace, err.Error()),
+				}
+			}
+			listopts := metav1.ListOptions{
+				LabelSelector:        selector.String(),
+				IncludeUninitialized: false,
+				Watch:                false,
+				TimeoutSeconds:       &timeout,
+			}
+			pods, podserr := clientset.CoreV1().Pods(pdb.Namespace).List(listopts)
+			if podserr != nil {
+				return &PollErr{
+					Message: fmt.Sprintf("Unable to list pods for PDB %s: %s", pdb.Name, podserr.Error()),
+				}
+			}
+			matched = len(pods.Items)
+		}
+		if matched == 0 {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"PDB %s in namespace %s has a selector that matches no pods and may be misconfigured!",
+				pdb.Name,
+				pdb.Namespace,
+			)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "pdbs/"+alertSpec.Name, "NoMatchingPods", "PodDisruptionBudget", pdb, alertmessage), alertersConfig)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_PollPDB_ok(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	defaultPDBMeta := metav1.ObjectMeta{
+		CreationTimestamp: metav1.Time{Time: time.Now().Add(time.Second * -600)},
+		Name:              "test-pdb",
+		Namespace:         metav1.NamespaceDefault,
+	}
+	defaultPDBSpec := policyv1beta1.PodDisruptionBudgetSpec{
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"app": "test"},
+		},
+	}
+	matchingPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: metav1.NamespaceDefault,
+			Labels:    map[string]string{"app": "test"},
+		},
+	}
+
+	tests := []struct {
+		alertSpec   PDBAlertSpec
+		name        string
+		objects     []runtime.Object
+		firstSeen   map[string]time.Time
+		shouldAlert bool
+	}{
+		{
+			name: "healthy PDB: no alert",
+			objects: []runtime.Object{
+				matchingPod,
+				&policyv1beta1.PodDisruptionBudget{
+					ObjectMeta: defaultPDBMeta,
+					Spec:       defaultPDBSpec,
+					Status: policyv1beta1.PodDisruptionBudgetStatus{
+						PodDisruptionsAllowed: 1,
+						CurrentHealthy:        2,
+						DesiredHealthy:        1,
+					},
+				},
+			},
+			alertSpec: PDBAlertSpec{
+				Name:      "test-pdb",
+				PDBFilter: metav1.NamespaceDefault,
+				ReportStatus: PDBAlertStatus{
+					NoDisruptionsThreshold: 60,
+					Unhealthy:              true,
+					NoMatchingPods:         true,
+				},
+			},
+		},
+		{
+			name: "PDB allowing no disruptions past threshold: alert",
+			objects: []runtime.Object{
+				&policyv1beta1.PodDisruptionBudget{
+					ObjectMeta: defaultPDBMeta,
+					Spec:       defaultPDBSpec,
+				},
+			},
+			firstSeen: map[string]time.Time{
+				"blocked/default/test-pdb": time.Now().Add(time.Second * -120),
+			},
+			alertSpec: PDBAlertSpec{
+				Name:      "test-pdb",
+				PDBFilter: metav1.NamespaceDefault,
+				ReportStatus: PDBAlertStatus{
+					NoDisruptionsThreshold: 60,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, PDB under desired healthy: alert",
+			objects: []runtime.Object{
+				&policyv1beta1.PodDisruptionBudget{
+					ObjectMeta: defaultPDBMeta,
+					Spec:       defaultPDBSpec,
+					Status: policyv1beta1.PodDisruptionBudgetStatus{
+						CurrentHealthy: 1,
+						DesiredHealthy: 2,
+					},
+				},
+			},
+			alertSpec: PDBAlertSpec{
+				Name: "*",
+				ReportStatus: PDBAlertStatus{
+					Unhealthy: true,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, PDB selector matches no pods: alert",
+			objects: []runtime.Object{
+				&policyv1beta1.PodDisruptionBudget{
+					ObjectMeta: defaultPDBMeta,
+					Spec:       defaultPDBSpec,
+				},
+			},
+			alertSpec: PDBAlertSpec{
+				Name: "*",
+				ReportStatus: PDBAlertStatus{
+					NoMatchingPods: true,
+				},
+			},
+			shouldAlert: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			pdbObservations = newObservations()
+			for key, first := range test.firstSeen {
+				pdbObservations.firstSeen[key] = first
+			}
+			client := fake.NewSimpleClientset(test.objects...)
+			stubCalled := false
+			alertStub := func(_ Alert, _ AlertersConfig) {
+				stubCalled = true
+			}
+			err := PollPDB(client, test.alertSpec, defaultTickerTime, alertStub, conf)
+			if err != nil {
+				subT.Errorf("PollPDB returned an unexpected error: %s", err.Error())
+			}
+			if test.shouldAlert != stubCalled {
+				subT.Errorf("alert function called: %t, expected: %t", stubCalled, test.shouldAlert)
+			}
+		})
+	}
+}
+
+func Test_PollPDB_wildcard_continues_after_error(t *testing.T) {
+
+	_, conf := StubsInit()
+	pdbObservations = newObservations()
+
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			CreationTimestamp: metav1.Time{Time: time.Now().Add(time.Second * -600)},
+			Name:              name,
+			Namespace:         metav1.NamespaceDefault,
+		}
+	}
+	invalidSelector := &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Bogus"}},
+	}
+	client := fake.NewSimpleClientset(
+		&policyv1beta1.PodDisruptionBudget{ObjectMeta: meta("a-invalid"), Spec: policyv1beta1.PodDisruptionBudgetSpec{Selector: invalidSelector}},
+		&policyv1beta1.PodDisruptionBudget{ObjectMeta: meta("b-no-selector"), Status: policyv1beta1.PodDisruptionBudgetStatus{PodDisruptionsAllowed: 1}},
+	)
+	alerted := []string{}
+	alertStub := func(alert Alert, _ AlertersConfig) {
+		alerted = append(alerted, alert.Name)
+	}
+	alertSpec := PDBAlertSpec{Name: "*", ReportStatus: PDBAlertStatus{NoMatchingPods: true}}
+
+	err := PollPDB(client, alertSpec, defaultTickerTime, alertStub, conf)
+	if err == nil || !strings.Contains(err.Error(), "a-invalid") {
+		t.Errorf("expected the invalid selector error, got: %v", err)
+	}
+	if len(alerted) != 1 || alerted[0] != "b-no-selector" {
+		t.Errorf("expected the PDB after the invalid one to still be checked, alerted: %v", alerted)
+	}
+}
@@ -33,6 +33,7 @@ func PollPod(
 	alertFn alertFunction,
 	alertersConfig types.AlertersConfig,
 ) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
 
 	if alertSpec.ReportStatus.PendingThreshold == 0 {
 		alertSpec.ReportStatus.PendingThreshold = 10
@@ -52,7 +53,9 @@ func PollPod(
 				Message: fmt.Sprintf("error getting pod %s: %s", alertSpec.Name, poderr.Error()),
 			}
 		}
-		checkPod(pod, alertSpec, tickertime, alertFn, alertersConfig)
+		if reasons := checkPod(pod, alertSpec, tickertime, alertFn, alertersConfig); len(reasons) > 0 {
+			alertPodFailures(clientset, []podFailure{{pod: pod, reasons: reasons}}, alertSpec, alertFn, alertersConfig)
+		}
 		// If podname is a wildcard, list based on filter and iterate through
 	} else {
 		listopts := metav1.ListOptions{
@@ -73,10 +76,19 @@ func PollPod(
 		if len(pods.Items) < int(alertSpec.ReportStatus.MinPods) {
 			// ALERT
 			alertmessage := fmt.Sprint("Number of pods for label", alertSpec.PodFilterLabel, "is under minimum specification!")
-			alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+			alertFn(types.Alert{
+				AlerterType: alertSpec.AlerterType,
+				AlerterName: alertSpec.AlerterName,
+				Rule:        "pods/" + alertSpec.Name,
+				Check:       "MinPods",
+				Kind:        "Pod",
+				Message:     alertmessage,
+				Labels:      map[string]string{"filter": alertSpec.PodFilterLabel},
+			}, alertersConfig)
 		}
 
-		// Iterate through pod items
+		// Iterate through pod items, collecting failures so they can be alerted on per owner
+		failures := []podFailure{}
 		for _, poddata := range pods.Items {
 			pod, poderr := clientset.CoreV1().Pods(poddata.GetNamespace()).Get(poddata.GetName(), metav1.GetOptions{})
 			if poderr != nil {
@@ -85,19 +97,26 @@ func PollPod(
 				}
 			}
 
-			checkPod(pod, alertSpec, tickertime, alertFn, alertersConfig)
+			if reasons := checkPod(pod, alertSpec, tickertime, alertFn, alertersConfig); len(reasons) > 0 {
+				failures = append(failures, podFailure{pod: pod, reasons: reasons})
+			}
 		}
+		alertPodFailures(clientset, failures, alertSpec, alertFn, alertersConfig)
 	}
 	return nil
 }
 
+// checkPod returns the reasons a pod is failing its checks, if any
 func checkPod(
 	pod *corev1.Pod,
 	alertSpec types.PodAlertSpec,
 	tickertime int64,
 	alertFn alertFunction,
 	alertersConfig types.AlertersConfig,
-) {
+) []string {
+	checkExpression(alertSpec.Expression, "pods/"+alertSpec.Name, "Pod", pod, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
+	reasons := []string{}
 	nowSeconds := time.Now().Unix()
 	// Get times for comparing to threshold
 	statusCreatedSecondsDiff := nowSeconds - pod.ObjectMeta.CreationTimestamp.Unix()
@@ -106,17 +125,17 @@ func checkPod(
 	if statusCreatedSecondsDiff > alertSpec.ReportStatus.PendingThreshold {
 		for _, condition := range pod.Status.Conditions {
 			if condition.Type == "Ready" {
+				if checkFlapping(podFlaps, alertSpec.ReportStatus.FlapThreshold, alertSpec.ReportStatus.FlapWindow, "pods/"+alertSpec.Name, "Pod", pod,
+					condition.LastTransitionTime.Time, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig) {
+					continue
+				}
 				transitiontimeDiff := time.Now().Unix() - condition.LastTransitionTime.Unix()
 				if transitiontimeDiff < tickertime && alertSpec.ReportStatus.PodRestarts {
-					// ALERT
-					alertmessage := fmt.Sprint("Pod", alertSpec.Name, "has changed ready status since last poll and may be restarting!")
-					alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+					reasons = append(reasons, "changed ready status since last poll and may be restarting")
 				}
 			} else if condition.Type == "PodScheduled" {
 				if condition.Status != "True" && alertSpec.ReportStatus.FailedScheduling {
-					// ALERT
-					alertmessage := fmt.Sprint("Pod", alertSpec.Name, "has not been scheduled yet and has passed scheduling timeline!")
-					alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+					reasons = append(reasons, "not scheduled yet and passed scheduling timeline")
 				}
 			}
 		}
@@ -134,9 +153,8 @@ func checkPod(
 
 		// If the deletion deadline has passed within the time of last status check, alert
 		if deletionDeadline < nowSeconds && deletionDeadline > lastpollDiff {
-			// ALERT
-			alertmessage := fmt.Sprint("Pod", alertSpec.Name, "has passed its deletion timeline and may be stuck in terminating status!")
-			alertFn(alertSpec.AlerterType, alertSpec.AlerterName, alertmessage, alertersConfig)
+			reasons = append(reasons, "passed its deletion timeline and may be stuck in terminating status")
 		}
 	}
+	return reasons
 }
@@ -173,7 +173,7 @@ func Test_PullPod_ok(t *testing.T) {
 		t.Run(test.name, func(subT *testing.T) {
 			client := fake.NewSimpleClientset(test.pod)
 			stubCalled := false
-			alertStub := func(_ string, _ string, _ string, _ AlertersConfig) {
+			alertStub := func(_ Alert, _ AlertersConfig) {
 				stubCalled = true
 			}
 			err := PollPod(client, test.alertSpec, defaultTickerTime, alertStub, conf)
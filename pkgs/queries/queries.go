@@ -16,8 +16,12 @@ package queries
 
 import (
 	"log"
+	"strings"
 
 	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var (
@@ -35,4 +39,76 @@ func (err *PollErr) Error() string {
 	return err.Message
 }
 
-type alertFunction func(string, string, string, types.AlertersConfig)
+// combineErrors joins the errors from checking several objects, which are all checked even if some fail.
+// It returns nil when there are none.
+func combineErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	messages := []string{}
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	return &PollErr{Message: strings.Join(messages, "; ")}
+}
+
+type alertFunction func(types.Alert, types.AlertersConfig)
+
+// objectAlert builds the alert for a failed check on a kubernetes object
+func objectAlert(
+	alerterType string,
+	alerterName string,
+	rule string,
+	check string,
+	kind string,
+	object metav1.Object,
+	message string,
+) types.Alert {
+	alert := types.Alert{
+		AlerterType: alerterType,
+		AlerterName: alerterName,
+		Rule:        rule,
+		Check:       check,
+		Kind:        kind,
+		Namespace:   object.GetNamespace(),
+		Name:        object.GetName(),
+		UID:         string(object.GetUID()),
+		Message:     message,
+	}
+	// Label alerts with the node they concern, so inhibition rules can match them up
+	switch o := object.(type) {
+	case *corev1.Node:
+		alert.Labels = map[string]string{"node": o.Name}
+	case *corev1.Pod:
+		if o.Spec.NodeName != "" {
+			alert.Labels = map[string]string{"node": o.Spec.NodeName}
+		}
+	}
+	return alert
+}
+
+// withLabels adds labels to those of alert, keeping the ones it already has
+func withLabels(alert types.Alert, labels map[string]string) types.Alert {
+	merged := map[string]string{}
+	for k, v := range alert.Labels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	alert.Labels = merged
+	return alert
+}
+
+// withRuleInfo wraps alertFn to set the severity and links of a rule on the alerts it raises. Severity is warning by default.
+func withRuleInfo(alertFn alertFunction, severity string, runbookURL string, dashboardURL string) alertFunction {
+	if severity == "" {
+		severity = types.SeverityWarning
+	}
+	return func(alert types.Alert, alertersConfig types.AlertersConfig) {
+		alert.Severity = severity
+		alert.RunbookURL = runbookURL
+		alert.DashboardURL = dashboardURL
+		alertFn(alert, alertersConfig)
+	}
+}
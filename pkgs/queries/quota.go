@@ -0,0 +1,177 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PollQuota function takes inputs and iterates across resource quotas in the kubernetes cluster, triggering alerts as needed.
+func PollQuota(
+	clientset kubernetes.Interface,
+	alertSpec types.QuotaAlertSpec,
+	tickertime int64,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
+
+	// Check rules with matching literal quota name
+	if alertSpec.Name != "*" {
+		if alertSpec.QuotaFilterNamespace == "" {
+			return &PollErr{
+				Message: fmt.Sprintf("quota rule for %s has no namespace filter specified, ignoring", alertSpec.Name),
+			}
+		}
+
+		quota, quotaerr := clientset.CoreV1().ResourceQuotas(alertSpec.QuotaFilterNamespace).Get(alertSpec.Name, metav1.GetOptions{})
+		if quotaerr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("error getting resource quota %s: %s", alertSpec.Name, quotaerr.Error()),
+			}
+		}
+		checkQuota(quota, alertSpec, alertFn, alertersConfig)
+
+		// If quota name is a wildcard, list based on filter and iterate through
+	} else {
+		listopts := metav1.ListOptions{
+			LabelSelector:        alertSpec.QuotaFilterLabel,
+			IncludeUninitialized: false,
+			Watch:                false,
+			TimeoutSeconds:       &timeout,
+		}
+		quotas, quotaserr := clientset.CoreV1().ResourceQuotas(alertSpec.QuotaFilterNamespace).List(listopts)
+		if quotaserr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("error fetching resource quotas: %s", quotaserr.Error()),
+			}
+		}
+		for i := range quotas.Items {
+			checkQuota(&quotas.Items[i], alertSpec, alertFn, alertersConfig)
+		}
+	}
+
+	// Pods failing to be created because of quota only show up on their ReplicaSet
+	if alertSpec.ReportStatus.FailedCreate {
+		listopts := metav1.ListOptions{
+			IncludeUninitialized: false,
+			Watch:                false,
+			TimeoutSeconds:       &timeout,
+		}
+		replicasets, replicasetserr := clientset.AppsV1().ReplicaSets(alertSpec.QuotaFilterNamespace).List(listopts)
+		if replicasetserr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("Unable to list ReplicaSets: %s", replicasetserr.Error()),
+			}
+		}
+		for i := range replicasets.Items {
+			checkReplicaSetQuota(&replicasets.Items[i], alertSpec, alertFn, alertersConfig)
+		}
+	}
+	return nil
+}
+
+func checkQuota(
+	quota *corev1.ResourceQuota,
+	alertSpec types.QuotaAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) {
+	checkExpression(alertSpec.Expression, "quotas/"+alertSpec.Name, "ResourceQuota", quota, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
+	if alertSpec.ReportStatus.UsedPercent <= 0 {
+		return
+	}
+
+	resourceNames := []string{}
+	for resourceName := range quota.Status.Hard {
+		resourceNames = append(resourceNames, string(resourceName))
+	}
+	sort.Strings(resourceNames)
+
+	for _, resourceName := range resourceNames {
+		if !quotaResourceSelected(alertSpec.ReportStatus.Resources, resourceName) {
+			continue
+		}
+		hard := quota.Status.Hard[corev1.ResourceName(resourceName)]
+		used, ok := quota.Status.Used[corev1.ResourceName(resourceName)]
+		if !ok || hard.IsZero() {
+			continue
+		}
+
+		usedPercent := float64(used.MilliValue()) / float64(hard.MilliValue()) * 100
+		if usedPercent > alertSpec.ReportStatus.UsedPercent {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"ResourceQuota %s in namespace %s has used %s of %s %s (%.0f%%), over the %.0f%% threshold!",
+				quota.Name,
+				quota.Namespace,
+				used.String(),
+				hard.String(),
+				resourceName,
+				usedPercent,
+				alertSpec.ReportStatus.UsedPercent,
+			)
+			alert := objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "quotas/"+alertSpec.Name, "QuotaUsage", "ResourceQuota", quota, alertmessage)
+			alert.Labels = map[string]string{"resource": resourceName}
+			alertFn(alert, alertersConfig)
+		}
+	}
+}
+
+func checkReplicaSetQuota(
+	replicaset *appsv1.ReplicaSet,
+	alertSpec types.QuotaAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) {
+	for _, condition := range replicaset.Status.Conditions {
+		if condition.Type != appsv1.ReplicaSetReplicaFailure || condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		if condition.Reason == "FailedCreate" && strings.Contains(condition.Message, "exceeded quota") {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"ReplicaSet %s in namespace %s is failing to create pods because a quota is exceeded: %s",
+				replicaset.Name,
+				replicaset.Namespace,
+				condition.Message,
+			)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "quotas/"+alertSpec.Name, "QuotaFailedCreate", "ReplicaSet", replicaset, alertmessage), alertersConfig)
+		}
+	}
+}
+
+// quotaResourceSelected checks whether a quota resource should be checked, an empty list selects every resource
+func quotaResourceSelected(resources []string, resourceName string) bool {
+	if len(resources) == 0 {
+		return true
+	}
+	for _, resource := range resources {
+		if resource == resourceName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"testing"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_PollQuota_ok(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	quota := func(usedCPU string, usedPods string) *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-quota",
+				Namespace: metav1.NamespaceDefault,
+			},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{
+					corev1.ResourceLimitsCPU: resource.MustParse("4"),
+					corev1.ResourcePods:      resource.MustParse("10"),
+				},
+				Used: corev1.ResourceList{
+					corev1.ResourceLimitsCPU: resource.MustParse(usedCPU),
+					corev1.ResourcePods:      resource.MustParse(usedPods),
+				},
+			},
+		}
+	}
+	replicaset := func(reason string, message string) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-replicaset",
+				Namespace: metav1.NamespaceDefault,
+			},
+			Status: appsv1.ReplicaSetStatus{
+				Conditions: []appsv1.ReplicaSetCondition{
+					{
+						Type:    appsv1.ReplicaSetReplicaFailure,
+						Status:  corev1.ConditionTrue,
+						Reason:  reason,
+						Message: message,
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		alertSpec   QuotaAlertSpec
+		name        string
+		objects     []runtime.Object
+		shouldAlert bool
+	}{
+		{
+			name:    "quota under threshold: no alert",
+			objects: []runtime.Object{quota("1500m", "5")},
+			alertSpec: QuotaAlertSpec{
+				Name:                 "test-quota",
+				QuotaFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus:         QuotaAlertStatus{UsedPercent: 80},
+			},
+		},
+		{
+			name:    "quota over threshold: alert",
+			objects: []runtime.Object{quota("3500m", "5")},
+			alertSpec: QuotaAlertSpec{
+				Name:                 "test-quota",
+				QuotaFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus:         QuotaAlertStatus{UsedPercent: 80},
+			},
+			shouldAlert: true,
+		},
+		{
+			name:    "wildcard, quota over threshold on unselected resource: no alert",
+			objects: []runtime.Object{quota("3500m", "5")},
+			alertSpec: QuotaAlertSpec{
+				Name: "*",
+				ReportStatus: QuotaAlertStatus{
+					UsedPercent: 80,
+					Resources:   []string{"pods"},
+				},
+			},
+		},
+		{
+			name: "wildcard, ReplicaSet failing to create pods over quota: alert",
+			objects: []runtime.Object{
+				replicaset("FailedCreate", `pods "test-pod" is forbidden: exceeded quota: test-quota, requested: pods=1, used: pods=10, limited: pods=10`),
+			},
+			alertSpec: QuotaAlertSpec{
+				Name:         "*",
+				ReportStatus: QuotaAlertStatus{FailedCreate: true},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, ReplicaSet failing to create pods for other reasons: no alert",
+			objects: []runtime.Object{
+				replicaset("FailedCreate", `pods "test-pod" is forbidden: error looking up service account default/test: serviceaccount "test" not found`),
+			},
+			alertSpec: QuotaAlertSpec{
+				Name:         "*",
+				ReportStatus: QuotaAlertStatus{FailedCreate: true},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			client := fake.NewSimpleClientset(test.objects...)
+			stubCalled := false
+			alertStub := func(_ Alert, _ AlertersConfig) {
+				stubCalled = true
+			}
+			err := PollQuota(client, test.alertSpec, defaultTickerTime, alertStub, conf)
+			if err != nil {
+				subT.Errorf("PollQuota returned an unexpected error: %s", err.Error())
+			}
+			if test.shouldAlert != stubCalled {
+				subT.Errorf("alert function called: %t, expected: %t", stubCalled, test.shouldAlert)
+			}
+		})
+	}
+}
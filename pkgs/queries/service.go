@@ -0,0 +1,187 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PollService function takes inputs and iterates across services in the kubernetes cluster, triggering alerts as needed.
+func PollService(
+	clientset kubernetes.Interface,
+	alertSpec types.ServiceAlertSpec,
+	tickertime int64,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	alertFn = withRuleInfo(alertFn, alertSpec.Severity, alertSpec.RunbookURL, alertSpec.DashboardURL)
+
+	if alertSpec.ReportStatus.PendingThreshold == 0 {
+		alertSpec.ReportStatus.PendingThreshold = 10
+	}
+
+	// Check rules with matching literal service name
+	if alertSpec.Name != "*" {
+		if alertSpec.ServiceFilterNamespace == "" {
+			return &PollErr{
+				Message: fmt.Sprintf("service rule for %s has no namespace filter specified, ignoring", alertSpec.Name),
+			}
+		}
+
+		service, serviceerr := clientset.CoreV1().Services(alertSpec.ServiceFilterNamespace).Get(alertSpec.Name, metav1.GetOptions{})
+		if serviceerr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("error getting service %s: %s", alertSpec.Name, serviceerr.Error()),
+			}
+		}
+		return checkService(clientset, service, alertSpec, alertFn, alertersConfig)
+	}
+
+	// If service name is a wildcard, list based on filter and iterate through
+	listopts := metav1.ListOptions{
+		LabelSelector:        alertSpec.ServiceFilterLabel,
+		IncludeUninitialized: false,
+		Watch:                false,
+		TimeoutSeconds:       &timeout,
+	}
+	services, serviceserr := clientset.CoreV1().Services(alertSpec.ServiceFilterNamespace).List(listopts)
+	if serviceserr != nil {
+		return &PollErr{
+			Message: fmt.Sprintf("error fetching services: %s", serviceserr.Error()),
+		}
+	}
+	errs := []error{}
+	for i := range services.Items {
+		if err := checkService(clientset, &services.Items[i], alertSpec, alertFn, alertersConfig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return combineErrors(errs)
+}
+
+func checkService(
+	clientset kubernetes.Interface,
+	service *corev1.Service,
+	alertSpec types.ServiceAlertSpec,
+	alertFn alertFunction,
+	alertersConfig types.AlertersConfig,
+) error {
+	checkExpression(alertSpec.Expression, "services/"+alertSpec.Name, "Service", service, alertSpec.AlerterType, alertSpec.AlerterName, alertFn, alertersConfig)
+
+	// Get times for comparing to threshold
+	statusCreatedSecondsDiff := time.Now().Unix() - service.ObjectMeta.CreationTimestamp.Unix()
+
+	// LoadBalancers can take a while to be provisioned, so they have their own threshold
+	if service.Spec.Type == corev1.ServiceTypeLoadBalancer && alertSpec.ReportStatus.LoadBalancerThreshold > 0 {
+		if len(service.Status.LoadBalancer.Ingress) == 0 && statusCreatedSecondsDiff > alertSpec.ReportStatus.LoadBalancerThreshold {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Service %s in namespace %s has not been assigned a LoadBalancer ingress after %d seconds!",
+				service.Name,
+				service.Namespace,
+				statusCreatedSecondsDiff,
+			)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "services/"+alertSpec.Name, "LoadBalancerPending", "Service", service, alertmessage), alertersConfig)
+		}
+	}
+
+	// ExternalName services have no endpoints, and new services need time for their pods to come up
+	if service.Spec.Type == corev1.ServiceTypeExternalName || statusCreatedSecondsDiff <= alertSpec.ReportStatus.PendingThreshold {
+		return nil
+	}
+
+	if alertSpec.ReportStatus.NoMatchingPods && len(service.Spec.Selector) > 0 {
+		listopts := metav1.ListOptions{
+			LabelSelector:        labels.SelectorFromSet(service.Spec.Selector).String(),
+			IncludeUninitialized: false,
+			Watch:                false,
+			TimeoutSeconds:       &timeout,
+		}
+		pods, podserr := clientset.CoreV1().Pods(service.Namespace).List(listopts)
+		if podserr != nil {
+			return &PollErr{
+				Message: fmt.Sprintf("Unable to list pods for service %s: %s", service.Name, podserr.Error()),
+			}
+		}
+		if len(pods.Items) == 0 {
+			// ALERT
+			alertmessage := fmt.Sprintf(
+				"Service %s in namespace %s has a selector that matches no pods and may be misconfigured!",
+				service.Name,
+				service.Namespace,
+			)
+			alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "services/"+alertSpec.Name, "NoMatchingPods", "Service", service, alertmessage), alertersConfig)
+		}
+	}
+
+	if alertSpec.ReportStatus.MinReadyEndpoints == 0 && !alertSpec.ReportStatus.AllNotReady {
+		return nil
+	}
+
+	ready, notReady, err := countEndpoints(clientset, service.Namespace, service.Name)
+	if err != nil {
+		return err
+	}
+	if ready < int(alertSpec.ReportStatus.MinReadyEndpoints) {
+		// ALERT
+		alertmessage := fmt.Sprintf(
+			"Service %s in namespace %s has %d ready endpoints, under the minimum of %d!",
+			service.Name,
+			service.Namespace,
+			ready,
+			alertSpec.ReportStatus.MinReadyEndpoints,
+		)
+		alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "services/"+alertSpec.Name, "MinReadyEndpoints", "Service", service, alertmessage), alertersConfig)
+	}
+	if alertSpec.ReportStatus.AllNotReady && ready == 0 && notReady > 0 {
+		// ALERT
+		alertmessage := fmt.Sprintf(
+			"Service %s in namespace %s has %d endpoints and none of them are ready!",
+			service.Name,
+			service.Namespace,
+			notReady,
+		)
+		alertFn(objectAlert(alertSpec.AlerterType, alertSpec.AlerterName, "services/"+alertSpec.Name, "AllEndpointsNotReady", "Service", service, alertmessage), alertersConfig)
+	}
+	return nil
+}
+
+// countEndpoints returns the number of ready and not ready addresses behind a service
+func countEndpoints(clientset kubernetes.Interface, namespace string, name string) (int, int, error) {
+	endpoints, err := clientset.CoreV1().Endpoints(namespace).Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, &PollErr{
+			Message: fmt.Sprintf("Unable to get endpoints for service %s: %s", name, err.Error()),
+		}
+	}
+
+	ready, notReady := 0, 0
+	for _, subset := range endpoints.Subsets {
+		ready += len(subset.Addresses)
+		notReady += len(subset.NotReadyAddresses)
+	}
+	return ready, notReady, nil
+}
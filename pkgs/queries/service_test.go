@@ -0,0 +1,186 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queries
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_PollService_ok(t *testing.T) {
+
+	_, conf := StubsInit()
+
+	defaultServiceMeta := metav1.ObjectMeta{
+		CreationTimestamp: metav1.Time{Time: time.Now().Add(time.Second * -600)},
+		Name:              "test-service",
+		Namespace:         metav1.NamespaceDefault,
+		Labels:            map[string]string{"monitor": "true"},
+	}
+	defaultServiceSpec := corev1.ServiceSpec{
+		Selector: map[string]string{"app": "test"},
+	}
+	matchingPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-pod",
+			Namespace: metav1.NamespaceDefault,
+			Labels:    map[string]string{"app": "test"},
+		},
+	}
+	endpoints := func(ready int, notReady int) *corev1.Endpoints {
+		subset := corev1.EndpointSubset{}
+		for i := 0; i < ready; i++ {
+			subset.Addresses = append(subset.Addresses, corev1.EndpointAddress{IP: "10.0.0.1"})
+		}
+		for i := 0; i < notReady; i++ {
+			subset.NotReadyAddresses = append(subset.NotReadyAddresses, corev1.EndpointAddress{IP: "10.0.0.2"})
+		}
+		return &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-service",
+				Namespace: metav1.NamespaceDefault,
+			},
+			Subsets: []corev1.EndpointSubset{subset},
+		}
+	}
+
+	tests := []struct {
+		alertSpec   ServiceAlertSpec
+		name        string
+		objects     []runtime.Object
+		shouldAlert bool
+	}{
+		{
+			name: "service with ready endpoints: no alert",
+			objects: []runtime.Object{
+				matchingPod,
+				endpoints(2, 0),
+				&corev1.Service{ObjectMeta: defaultServiceMeta, Spec: defaultServiceSpec},
+			},
+			alertSpec: ServiceAlertSpec{
+				Name:                   "test-service",
+				ServiceFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus: ServiceAlertStatus{
+					MinReadyEndpoints: 2,
+					NoMatchingPods:    true,
+					AllNotReady:       true,
+				},
+			},
+		},
+		{
+			name: "service under minimum ready endpoints: alert",
+			objects: []runtime.Object{
+				endpoints(1, 0),
+				&corev1.Service{ObjectMeta: defaultServiceMeta, Spec: defaultServiceSpec},
+			},
+			alertSpec: ServiceAlertSpec{
+				Name:                   "test-service",
+				ServiceFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus: ServiceAlertStatus{
+					MinReadyEndpoints: 2,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "service with only not ready endpoints: alert",
+			objects: []runtime.Object{
+				endpoints(0, 3),
+				&corev1.Service{ObjectMeta: defaultServiceMeta, Spec: defaultServiceSpec},
+			},
+			alertSpec: ServiceAlertSpec{
+				Name:                   "test-service",
+				ServiceFilterNamespace: metav1.NamespaceDefault,
+				ReportStatus: ServiceAlertStatus{
+					AllNotReady: true,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, selector matches no pods: alert",
+			objects: []runtime.Object{
+				&corev1.Service{ObjectMeta: defaultServiceMeta, Spec: defaultServiceSpec},
+			},
+			alertSpec: ServiceAlertSpec{
+				Name:               "*",
+				ServiceFilterLabel: "monitor=true",
+				ReportStatus: ServiceAlertStatus{
+					NoMatchingPods: true,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, LoadBalancer without ingress past threshold: alert",
+			objects: []runtime.Object{
+				&corev1.Service{
+					ObjectMeta: defaultServiceMeta,
+					Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+				},
+			},
+			alertSpec: ServiceAlertSpec{
+				Name: "*",
+				ReportStatus: ServiceAlertStatus{
+					LoadBalancerThreshold: 300,
+				},
+			},
+			shouldAlert: true,
+		},
+		{
+			name: "wildcard, LoadBalancer with ingress: no alert",
+			objects: []runtime.Object{
+				&corev1.Service{
+					ObjectMeta: defaultServiceMeta,
+					Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+					Status: corev1.ServiceStatus{
+						LoadBalancer: corev1.LoadBalancerStatus{
+							Ingress: []corev1.LoadBalancerIngress{{IP: "192.0.2.10"}},
+						},
+					},
+				},
+			},
+			alertSpec: ServiceAlertSpec{
+				Name: "*",
+				ReportStatus: ServiceAlertStatus{
+					LoadBalancerThreshold: 300,
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(subT *testing.T) {
+			client := fake.NewSimpleClientset(test.objects...)
+			stubCalled := false
+			alertStub := func(_ Alert, _ AlertersConfig) {
+				stubCalled = true
+			}
+			err := PollService(client, test.alertSpec, defaultTickerTime, alertStub, conf)
+			if err != nil {
+				subT.Errorf("PollService returned an unexpected error: %s", err.Error())
+			}
+			if test.shouldAlert != stubCalled {
+				subT.Errorf("alert function called: %t, expected: %t", stubCalled, test.shouldAlert)
+			}
+		})
+	}
+}
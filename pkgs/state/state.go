@@ -0,0 +1,169 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package state persists alert state to a ConfigMap, so it survives restarts. The ConfigMap doubles as a
+// lease: its annotations name the k8eraid instance holding it and when that instance last renewed it, and
+// only the holder polls and writes state. Every write is an update of the version last read, so an instance
+// that has lost the lease without noticing can not overwrite its successor's state.
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/bloomberg/k8eraid/pkgs/types"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Annotations on the state ConfigMap, and the data key holding the state
+const (
+	HolderAnnotation    = "k8eraid.bloomberg.com/holder"
+	RenewTimeAnnotation = "k8eraid.bloomberg.com/renew-time"
+	stateKey            = "state.json"
+)
+
+// LeaseLostErr is returned when another instance has taken the lease
+type LeaseLostErr struct {
+	Message string
+}
+
+func (err *LeaseLostErr) Error() string {
+	return err.Message
+}
+
+// Store reads and writes alert state in a ConfigMap
+type Store struct {
+	client        kubernetes.Interface
+	namespace     string
+	name          string
+	identity      string
+	leaseDuration time.Duration
+	// configMap is the version last read or written, the next write must update it
+	configMap *corev1.ConfigMap
+	now       func() time.Time
+}
+
+// NewStore creates a Store for the ConfigMap name in namespace, held by identity. A holder that does not
+// renew the lease within leaseDuration loses it to the next instance to call Acquire.
+func NewStore(client kubernetes.Interface, namespace string, name string, identity string, leaseDuration time.Duration) *Store {
+	return &Store{
+		client:        client,
+		namespace:     namespace,
+		name:          name,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		now:           time.Now,
+	}
+}
+
+// Acquire takes the lease if it is free, expired or already ours, creating the ConfigMap if needed, and
+// returns the saved alert state. It returns false when another instance holds the lease.
+func (s *Store) Acquire() (bool, []types.AlertState, error) {
+	now := s.now()
+	configMap, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        s.name,
+				Namespace:   s.namespace,
+				Annotations: s.leaseAnnotations(now),
+			},
+			Data: map[string]string{stateKey: "[]"},
+		}
+		created, createErr := s.client.CoreV1().ConfigMaps(s.namespace).Create(configMap)
+		if errors.IsAlreadyExists(createErr) {
+			return false, nil, nil
+		}
+		if createErr != nil {
+			return false, nil, fmt.Errorf("unable to create state ConfigMap %s: %s", s.name, createErr.Error())
+		}
+		s.configMap = created
+		return true, []types.AlertState{}, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("unable to get state ConfigMap %s: %s", s.name, err.Error())
+	}
+
+	if holder := configMap.Annotations[HolderAnnotation]; holder != "" && holder != s.identity {
+		renewTime, parseErr := time.Parse(time.RFC3339, configMap.Annotations[RenewTimeAnnotation])
+		if parseErr == nil && now.Sub(renewTime) < s.leaseDuration {
+			return false, nil, nil
+		}
+	}
+
+	states := []types.AlertState{}
+	if data := configMap.Data[stateKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &states); err != nil {
+			return false, nil, fmt.Errorf("unable to parse state in ConfigMap %s: %s", s.name, err.Error())
+		}
+	}
+
+	configMap = configMap.DeepCopy()
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	for k, v := range s.leaseAnnotations(now) {
+		configMap.Annotations[k] = v
+	}
+	updated, err := s.client.CoreV1().ConfigMaps(s.namespace).Update(configMap)
+	if errors.IsConflict(err) {
+		// Another instance got there first
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("unable to take lease on state ConfigMap %s: %s", s.name, err.Error())
+	}
+	s.configMap = updated
+	return true, states, nil
+}
+
+// Checkpoint saves alert state and renews the lease. It returns a LeaseLostErr if another instance has
+// written the ConfigMap since we last did.
+func (s *Store) Checkpoint(states []types.AlertState) error {
+	if s.configMap == nil {
+		return &LeaseLostErr{Message: fmt.Sprintf("lease on state ConfigMap %s has not been acquired", s.name)}
+	}
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("unable to encode alert state: %s", err.Error())
+	}
+
+	configMap := s.configMap.DeepCopy()
+	for k, v := range s.leaseAnnotations(s.now()) {
+		configMap.Annotations[k] = v
+	}
+	configMap.Data = map[string]string{stateKey: string(data)}
+	updated, err := s.client.CoreV1().ConfigMaps(s.namespace).Update(configMap)
+	if errors.IsConflict(err) || errors.IsNotFound(err) {
+		s.configMap = nil
+		return &LeaseLostErr{Message: fmt.Sprintf("lease on state ConfigMap %s was lost: %s", s.name, err.Error())}
+	}
+	if err != nil {
+		return fmt.Errorf("unable to save state to ConfigMap %s: %s", s.name, err.Error())
+	}
+	s.configMap = updated
+	return nil
+}
+
+func (s *Store) leaseAnnotations(now time.Time) map[string]string {
+	return map[string]string{
+		HolderAnnotation:    s.identity,
+		RenewTimeAnnotation: now.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/bloomberg/k8eraid/pkgs/types"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testStore(client *fake.Clientset, identity string, now *time.Time) *Store {
+	s := NewStore(client, "kube-system", "k8eraid-state", identity, time.Minute)
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func Test_Store_checkpoint_and_reload(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	first := testStore(client, "k8eraid-a", &now)
+	acquired, states, err := first.Acquire()
+	if err != nil || !acquired || len(states) != 0 {
+		t.Fatalf("first instance should acquire an empty state, got: %t, %v, %v", acquired, states, err)
+	}
+	saved := []AlertState{{
+		Fingerprint:  "0123456789abcdef",
+		Status:       AlertFiring,
+		FirstSeen:    now.Add(-time.Hour),
+		LastNotified: now,
+		Ack:          &Ack{By: "alice", At: now, Until: now.Add(time.Hour)},
+	}}
+	if err := first.Checkpoint(saved); err != nil {
+		t.Fatalf("Checkpoint returned an unexpected error: %s", err.Error())
+	}
+
+	// A second instance waits while the lease is held, and takes it over with the state once it expires
+	second := testStore(client, "k8eraid-b", &now)
+	if acquired, _, err := second.Acquire(); acquired || err != nil {
+		t.Fatalf("second instance should not acquire a held lease, got: %t, %v", acquired, err)
+	}
+	now = now.Add(2 * time.Minute)
+	acquired, states, err = second.Acquire()
+	if err != nil || !acquired {
+		t.Fatalf("second instance should acquire an expired lease, got: %t, %v", acquired, err)
+	}
+	if len(states) != 1 || states[0].Fingerprint != "0123456789abcdef" || states[0].Ack == nil || states[0].Ack.By != "alice" ||
+		!states[0].FirstSeen.Equal(saved[0].FirstSeen) {
+		t.Errorf("reloaded state does not match the checkpoint: %v", states)
+	}
+}
+
+func Test_Store_lease_lost(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	now := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := testStore(client, "k8eraid-a", &now)
+	if acquired, _, err := s.Acquire(); !acquired || err != nil {
+		t.Fatalf("Acquire should take a free lease, got: %t, %v", acquired, err)
+	}
+
+	// Another instance has written the ConfigMap since, so the update conflicts
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "k8eraid-state", nil)
+	})
+	err := s.Checkpoint([]AlertState{})
+	if _, ok := err.(*LeaseLostErr); !ok {
+		t.Errorf("Checkpoint should return a LeaseLostErr on conflict, got: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Alert statuses
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert severities, set per rule. Rules without one raise warnings.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// Alert is a failed check, raised by a rule on every poll it keeps failing
+type Alert struct {
+	AlerterType string `json:"alerterType"`
+	AlerterName string `json:"alerterName"`
+	// Rule is the config section and name of the rule raising the alert, such as "pods/*"
+	Rule string `json:"rule"`
+	// Check names the check that failed, such as "MinReplicas"
+	Check     string `json:"check"`
+	Severity  string `json:"severity"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// UID of the object, when known
+	UID     string `json:"uid,omitempty"`
+	Message string `json:"message"`
+	// Labels holds extra labels describing the alert, such as the node a pod is running on
+	Labels map[string]string `json:"labels,omitempty"`
+	// Links from the rule, for alerters to show alongside the alert
+	RunbookURL   string `json:"runbookURL,omitempty"`
+	DashboardURL string `json:"dashboardURL,omitempty"`
+	// StartsAt is when the alert started firing, set by the dispatcher
+	StartsAt time.Time `json:"startsAt"`
+}
+
+// LabelSet returns every label of the alert, used for grouping and matching alerts
+func (a Alert) LabelSet() map[string]string {
+	labels := map[string]string{
+		"alertname": a.Check,
+		"severity":  a.Severity,
+		"rule":      a.Rule,
+		"kind":      a.Kind,
+		"namespace": a.Namespace,
+		"name":      a.Name,
+	}
+	for k, v := range a.Labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// Fingerprint identifies an alert across polls, from its alerter and labels
+func (a Alert) Fingerprint() string {
+	labels := a.LabelSet()
+	names := []string{}
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := []string{a.AlerterType, a.AlerterName}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(pairs, ","))))[:16]
+}
+
+// severityRank orders severities, unknown ones rank with warnings
+func severityRank(severity string) int {
+	switch severity {
+	case SeverityCritical:
+		return 2
+	case SeverityInfo:
+		return 0
+	}
+	return 1
+}
+
+// HighestSeverity returns the most severe of the severities of alerts
+func HighestSeverity(alerts []Alert) string {
+	highest := ""
+	for _, alert := range alerts {
+		if highest == "" || severityRank(alert.Severity) > severityRank(highest) {
+			highest = alert.Severity
+		}
+	}
+	if highest == "" {
+		return SeverityWarning
+	}
+	return highest
+}
+
+// Notification is what the dispatcher sends to an alerter: a single alert, or a group of them
+type Notification struct {
+	AlerterType string `json:"alerterType"`
+	AlerterName string `json:"alerterName"`
+	// Key identifies the alert or group across notifications, for alerters that update or close what they sent
+	Key      string  `json:"key"`
+	Message  string  `json:"message"`
+	Severity string  `json:"severity"`
+	Alerts   []Alert `json:"alerts"`
+	// Resolved is set on the notification sent once the alert, or every alert in the group, has resolved
+	Resolved bool `json:"resolved"`
+}
+
+// AlertState is what k8eraid remembers about an alert between polls, and persists across restarts
+type AlertState struct {
+	Fingerprint  string            `json:"fingerprint"`
+	Alert        Alert             `json:"alert"`
+	Labels       map[string]string `json:"labels"`
+	Status       string            `json:"status"`
+	FirstSeen    time.Time         `json:"firstSeen"`
+	LastSeen     time.Time         `json:"lastSeen"`
+	LastNotified time.Time         `json:"lastNotified"`
+	ResolvedAt   time.Time         `json:"resolvedAt"`
+	// Ack is set while someone on call has acknowledged the alert, and is kept after it expires until the
+	// alert resolves
+	Ack *Ack `json:"ack,omitempty"`
+}
+
+// Ack is an acknowledgement of a firing alert, which stops it being sent again until Until
+type Ack struct {
+	By      string    `json:"by,omitempty"`
+	Comment string    `json:"comment,omitempty"`
+	At      time.Time `json:"at"`
+	Until   time.Time `json:"until"`
+}
+
+// Active returns whether the acknowledgement still mutes the alert at now
+func (a *Ack) Active(now time.Time) bool {
+	return a != nil && now.Before(a.Until)
+}
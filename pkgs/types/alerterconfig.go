@@ -0,0 +1,122 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// AlerterConfig is the config of one alerter of any type, kept as JSON for the alerter registered for its type
+// to decode
+type AlerterConfig struct {
+	Type string
+	Name string
+	Raw  json.RawMessage
+}
+
+// UnmarshalJSON reads the type and name of an alerter, keeping the rest of its config as it is
+func (c *AlerterConfig) UnmarshalJSON(data []byte) error {
+	var header struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	if header.Type == "" {
+		return fmt.Errorf("alerter %s has no type", header.Name)
+	}
+	c.Type = header.Type
+	c.Name = header.Name
+	c.Raw = append(json.RawMessage{}, data...)
+	return nil
+}
+
+// MarshalJSON writes the alerter config as it was read, with its type
+func (c AlerterConfig) MarshalJSON() ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if len(c.Raw) > 0 {
+		if err := json.Unmarshal(c.Raw, &fields); err != nil {
+			return nil, err
+		}
+	}
+	alerterType, err := json.Marshal(c.Type)
+	if err != nil {
+		return nil, err
+	}
+	fields["type"] = alerterType
+	return json.Marshal(fields)
+}
+
+// NewAlerterConfig creates the config of an alerter of alerterType from its config struct
+func NewAlerterConfig(alerterType string, config interface{}) (AlerterConfig, error) {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return AlerterConfig{}, err
+	}
+	name, err := alerterName(raw)
+	if err != nil {
+		return AlerterConfig{}, err
+	}
+	return AlerterConfig{Type: alerterType, Name: name, Raw: raw}, nil
+}
+
+// alerterName reads the name of an alerter from its config
+func alerterName(raw json.RawMessage) (string, error) {
+	var header struct {
+		Name string `json:"name"`
+	}
+	err := json.Unmarshal(raw, &header)
+	return header.Name, err
+}
+
+// UnmarshalJSON reads "alerters" as a list of alerters with a type each, or as an object with a list for each type.
+// Either way every alerter ends up in Configs, for the alerter registered for its type to decode.
+func (a *AlerterTypes) UnmarshalJSON(data []byte) error {
+	*a = AlerterTypes{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, &a.Configs)
+	}
+	byType := map[string][]json.RawMessage{}
+	if err := json.Unmarshal(data, &byType); err != nil {
+		return err
+	}
+	alerterTypes := make([]string, 0, len(byType))
+	for alerterType := range byType {
+		alerterTypes = append(alerterTypes, alerterType)
+	}
+	sort.Strings(alerterTypes)
+	for _, alerterType := range alerterTypes {
+		for _, raw := range byType[alerterType] {
+			name, err := alerterName(raw)
+			if err != nil {
+				return fmt.Errorf("%s alerter: %s", alerterType, err.Error())
+			}
+			a.Configs = append(a.Configs, AlerterConfig{Type: alerterType, Name: name, Raw: append(json.RawMessage{}, raw...)})
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes "alerters" as a list of alerters with a type each
+func (a AlerterTypes) MarshalJSON() ([]byte, error) {
+	if a.Configs == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(a.Configs)
+}
@@ -20,11 +20,18 @@ import (
 
 // ConfigRules represents the structure of the config file for k8eraid
 type ConfigRules struct {
-	Deployments    []DeploymentAlertSpec `json:"deployments"`
-	Pods           []PodAlertSpec        `json:"pods"`
-	Daemonsets     []DaemonsetAlertSpec  `json:"daemonsets"`
-	Nodes          []NodeAlertSpec       `json:"nodes"`
-	AlertersConfig AlertersConfig        `json:"alerters"`
+	Deployments    []DeploymentAlertSpec  `json:"deployments"`
+	Pods           []PodAlertSpec         `json:"pods"`
+	Daemonsets     []DaemonsetAlertSpec   `json:"daemonsets"`
+	Nodes          []NodeAlertSpec        `json:"nodes"`
+	HPAs           []HPAAlertSpec         `json:"hpas"`
+	PDBs           []PDBAlertSpec         `json:"pdbs"`
+	Services       []ServiceAlertSpec     `json:"services"`
+	Ingresses      []IngressAlertSpec     `json:"ingresses"`
+	Certificates   []CertificateAlertSpec `json:"certificates"`
+	Quotas         []QuotaAlertSpec       `json:"quotas"`
+	Generic        []GenericAlertSpec     `json:"generic"`
+	AlertersConfig AlertersConfig         `json:"alerters"`
 }
 
 // Alerter types
@@ -38,6 +45,23 @@ type SMTPAlerterConfig struct {
 	Port           int    `json:"port"`
 	Subject        string `json:"subject"`
 	PasswordEnvVar string `json:"passwordEnvVar"`
+	// To, CC and BCC are lists of recipients. ToAddress is added to To.
+	To  []string `json:"to"`
+	CC  []string `json:"cc"`
+	BCC []string `json:"bcc"`
+	// Username to log in with, FromAddress when not set. k8eraid only logs in when the password is set.
+	Username string `json:"username"`
+	// TLS is "starttls" to require STARTTLS, "implicit" to connect over TLS, or "none". STARTTLS is used
+	// when the server offers it if this is not set.
+	TLS                string `json:"tls"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	// CAFile is a PEM bundle of the CAs trusted for the mail server certificate, in place of the system ones
+	CAFile string `json:"caFile"`
+	// SubjectTemplate, TextTemplate and HTMLTemplate are Go templates for the email, executed with the
+	// notification, Subject and Time. Templates that are not set use the defaults.
+	SubjectTemplate string `json:"subjectTemplate"`
+	TextTemplate    string `json:"textTemplate"`
+	HTMLTemplate    string `json:"htmlTemplate"`
 }
 
 // PDAlerterConfig struct contains the needed data for triggering a Pager Duty type alert
@@ -61,6 +85,53 @@ type WebhookAlerterConfig struct {
 	Server      string `json:"server"`
 	ProxyServer string `json:"proxyServer"`
 	Subject     string `json:"subject"`
+	// Method defaults to POST
+	Method  string          `json:"method"`
+	Headers []WebhookHeader `json:"headers"`
+	// BodyTemplate is a Go template for the request body, executed with the notification, Subject and Time.
+	// The body is WebhookAlertDetails as JSON when it is not set.
+	BodyTemplate string            `json:"bodyTemplate"`
+	BearerToken  *SecretValue      `json:"bearerToken"`
+	BasicAuth    *WebhookBasicAuth `json:"basicAuth"`
+	TLS          *WebhookTLSConfig `json:"tls"`
+	// SigningSecret signs the body with HMAC-SHA256, sent as sha256=<hex> in SignatureHeader
+	SigningSecret   *SecretValue `json:"signingSecret"`
+	SignatureHeader string       `json:"signatureHeader"`
+}
+
+// WebhookHeader is a header sent with every webhook request, set to Value or read from ValueFrom
+type WebhookHeader struct {
+	Name      string       `json:"name"`
+	Value     string       `json:"value"`
+	ValueFrom *SecretValue `json:"valueFrom"`
+}
+
+// WebhookBasicAuth contains the credentials for HTTP basic auth
+type WebhookBasicAuth struct {
+	Username string      `json:"username"`
+	Password SecretValue `json:"password"`
+}
+
+// WebhookTLSConfig contains the files, usually a mounted Secret, used to connect to a webhook over TLS
+type WebhookTLSConfig struct {
+	// CAFile is a PEM bundle of the CAs trusted for the server certificate, in place of the system ones
+	CAFile string `json:"caFile"`
+	// CertFile and KeyFile are the client certificate and key for mutual TLS
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// SecretValue is a value read from the environment variable EnvVar, or from a key of a Secret
+type SecretValue struct {
+	EnvVar string        `json:"envVar"`
+	Secret *SecretKeyRef `json:"secret"`
+}
+
+// SecretKeyRef selects a key of a Secret. Namespace defaults to the one k8eraid runs in.
+type SecretKeyRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Key       string `json:"key"`
 }
 
 // WebhookAlertDetails contains the needed data to put into the body of a Webhook type alert
@@ -70,22 +141,158 @@ type WebhookAlertDetails struct {
 	Time    time.Time `json:"time"`
 }
 
-// AlerterTypes are the actual types of alerter structs
+// OpsgenieAlerterConfig contains the data needed to create and close Opsgenie alerts
+type OpsgenieAlerterConfig struct {
+	Name         string `json:"name"`
+	APIKeyEnvVar string `json:"apiKeyEnvVar"`
+	// Region selects the API, "us" (the default) or "eu"
+	Region string `json:"region"`
+	// BaseURL overrides the API URL of the region
+	BaseURL string `json:"baseURL"`
+	// Priorities maps alert severities to Opsgenie priorities, P1 to P5
+	Priorities  map[string]string   `json:"priorities"`
+	Responders  []OpsgenieResponder `json:"responders"`
+	Tags        []string            `json:"tags"`
+	ProxyServer string              `json:"proxyServer"`
+}
+
+// OpsgenieResponder is a team, user, escalation or schedule to notify, by ID or name (username for users)
+type OpsgenieResponder struct {
+	Type     string `json:"type"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// AlerterTypes are the configured alerters, of any registered type
 type AlerterTypes struct {
-	PDAlerterList      []PDAlerterConfig      `json:"pagerdutyV2"`
-	SlackAlerterList   []SlackAlerterConfig   `json:"slack"`
-	SMTPAlerterList    []SMTPAlerterConfig    `json:"smtp"`
-	WebhookAlerterList []WebhookAlerterConfig `json:"webhook"`
+	// Configs are every alerter of "alerters", whichever form it was written in
+	Configs []AlerterConfig
+}
+
+// GroupingConfig batches the alerts sent to an alerter into groups, in the same way as Alertmanager.
+// Intervals are in seconds.
+type GroupingConfig struct {
+	AlerterType    string   `json:"alerterType"`
+	AlerterName    string   `json:"alerterName"`
+	GroupBy        []string `json:"groupBy"`
+	GroupWait      int64    `json:"groupWait"`
+	GroupInterval  int64    `json:"groupInterval"`
+	RepeatInterval int64    `json:"repeatInterval"`
+}
+
+// InhibitRule mutes alerts matching TargetMatch while an alert matching SourceMatch is firing,
+// when both alerts have the same values for every label in Equal. Matches compare label values exactly.
+type InhibitRule struct {
+	SourceMatch map[string]string `json:"sourceMatch"`
+	TargetMatch map[string]string `json:"targetMatch"`
+	Equal       []string          `json:"equal"`
+}
+
+// RetryPolicy controls how often a notification is tried before it fails. Times are in seconds.
+type RetryPolicy struct {
+	// Retries after the first attempt, 3 when not set. Negative values turn retrying off.
+	Retries int `json:"retries"`
+	// InitialBackoff is the wait before the first retry, doubled for each retry after it up to MaxBackoff,
+	// with jitter. 1 and 60 when not set.
+	InitialBackoff int64 `json:"initialBackoff"`
+	MaxBackoff     int64 `json:"maxBackoff"`
+	// Timeout is how long an attempt may take before it counts as failed, 30 when not set
+	Timeout int64 `json:"timeout"`
+}
+
+// AlerterDeliveryConfig overrides the retry policy for one alerter
+type AlerterDeliveryConfig struct {
+	AlerterType string `json:"alerterType"`
+	AlerterName string `json:"alerterName"`
+	RetryPolicy
+}
+
+// DeliveryConfig controls how notifications are delivered to alerters
+type DeliveryConfig struct {
+	RetryPolicy
+	// QueueSize is the number of notifications waiting for each alerter, 100 when not set. Notifications
+	// for an alerter with a full queue fail straight away.
+	QueueSize int `json:"queueSize"`
+	// DeadLetterFile is appended with a JSON line for every notification that failed. They are logged when not set.
+	DeadLetterFile string `json:"deadLetterFile"`
+	// Fallback is sent the notifications other alerters failed to send
+	Fallback *AlerterRef             `json:"fallback"`
+	Alerters []AlerterDeliveryConfig `json:"alerters"`
+}
+
+// AlerterRef names an alerter
+type AlerterRef struct {
+	AlerterType string `json:"alerterType"`
+	AlerterName string `json:"alerterName"`
 }
 
 // AlertersConfig is the top level struct containing alerter configuration data
 type AlertersConfig struct {
-	Types AlerterTypes `json:"alerters"`
+	Types        AlerterTypes     `json:"alerters"`
+	Grouping     []GroupingConfig `json:"grouping"`
+	InhibitRules []InhibitRule    `json:"inhibitRules"`
+	Delivery     DeliveryConfig   `json:"delivery"`
+}
+
+// MSTeamsAlerterConfig configures a Microsoft Teams alerter posting to an incoming webhook
+type MSTeamsAlerterConfig struct {
+	Name        string `json:"name"`
+	WebhookURL  string `json:"webhookURL"`
+	ProxyServer string `json:"proxyServer"`
+	// ClusterName is shown on every card, to tell clusters sharing a channel apart
+	ClusterName string `json:"cluster"`
+}
+
+// AlertmanagerAlerterConfig configures an alerter posting to the Prometheus Alertmanager v2 API
+type AlertmanagerAlerterConfig struct {
+	Name string `json:"name"`
+	// URL is the base URL of Alertmanager, such as http://alertmanager.monitoring:9093
+	URL         string `json:"url"`
+	ProxyServer string `json:"proxyServer"`
+	// GeneratorURL links to the source of alerts from rules without a dashboard URL
+	GeneratorURL string `json:"generatorURL"`
+	// AlertTTL is how many seconds firing alerts last in Alertmanager without being posted again, 300 by default
+	AlertTTL int64 `json:"alertTTL"`
+}
+
+// ExecAlerterConfig configures an alerter running a command for every notification, with the notification as
+// JSON on its stdin
+type ExecAlerterConfig struct {
+	Name    string   `json:"name"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// Timeout is how long the command may run before it is killed, in seconds. 30 when not set.
+	Timeout int64 `json:"timeout"`
+}
+
+// KubeEventAlerterConfig configures an alerter recording alerts as Events on the objects they are about
+type KubeEventAlerterConfig struct {
+	Name string `json:"name"`
+	// Component is the source component of the Events, k8eraid by default
+	Component string `json:"component"`
 }
 
-//SlackAlerterConfig configures a Slack Alerter
+// SlackAlerterConfig configures a Slack Alerter
 type SlackAlerterConfig struct {
 	Name        string `json:"name"`
 	WebhookURL  string `json:"webhookURL"`
 	ProxyServer string `json:"proxyServer"`
+	// BotTokenEnvVar names the variable holding a bot token. With a bot token, alerts are posted with
+	// chat.postMessage in place of the webhook, so later notifications for an alert can reply in its thread
+	// and mark it resolved.
+	BotTokenEnvVar string `json:"botTokenEnvVar"`
+	// Channel is where bot messages are posted, unless the alert's rule is in RuleChannels or its severity in
+	// SeverityChannels
+	Channel          string            `json:"channel"`
+	RuleChannels     map[string]string `json:"ruleChannels"`
+	SeverityChannels map[string]string `json:"severityChannels"`
+	// ReplyInterval is how often, in seconds, an alert still firing with the same message is replied to in its
+	// thread. 3600 when not set.
+	ReplyInterval int64 `json:"replyInterval"`
+	// APIURL is the Slack Web API, https://slack.com/api by default
+	APIURL string `json:"apiURL"`
+	// AckButtons adds Ack 1h and Silence 24h buttons to bot messages. The Slack app's interactivity request
+	// URL must point at k8eraid's /ack/slack endpoint.
+	AckButtons bool `json:"ackButtons"`
 }
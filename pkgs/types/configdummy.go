@@ -80,36 +80,212 @@ func StubsInit() (ConfigRules, AlertersConfig) {
 				},
 			},
 		},
+		HPAs: []HPAAlertSpec{
+			{
+				Name:        "*",
+				HPAFilter:   "",
+				AlerterType: "smtp",
+				AlerterName: "example-email",
+				ReportStatus: HPAAlertStatus{
+					MaxReplicasThreshold: 600,
+					ScalingActive:        true,
+					AbleToScale:          true,
+					PendingThreshold:     60,
+				},
+			},
+		},
+		PDBs: []PDBAlertSpec{
+			{
+				Name:        "*",
+				PDBFilter:   "",
+				AlerterType: "smtp",
+				AlerterName: "example-email",
+				ReportStatus: PDBAlertStatus{
+					NoDisruptionsThreshold: 3600,
+					Unhealthy:              true,
+					NoMatchingPods:         true,
+					PendingThreshold:       60,
+				},
+			},
+		},
+		Services: []ServiceAlertSpec{
+			{
+				Name:                   "kube-dns",
+				ServiceFilterNamespace: "kube-system",
+				ServiceFilterLabel:     "",
+				AlerterType:            "smtp",
+				AlerterName:            "example-email",
+				ReportStatus: ServiceAlertStatus{
+					MinReadyEndpoints: 1,
+					NoMatchingPods:    true,
+					AllNotReady:       true,
+					PendingThreshold:  60,
+				},
+			},
+		},
+		Ingresses: []IngressAlertSpec{
+			{
+				Name:                   "*",
+				IngressFilterNamespace: "",
+				IngressFilterLabel:     "",
+				AlerterType:            "smtp",
+				AlerterName:            "example-email",
+				ReportStatus: IngressAlertStatus{
+					MissingBackends:       true,
+					NoReadyEndpoints:      true,
+					MissingTLSSecrets:     true,
+					LoadBalancerThreshold: 600,
+					PendingThreshold:      60,
+				},
+			},
+		},
+		Certificates: []CertificateAlertSpec{
+			{
+				Name:                  "*",
+				SecretFilterNamespace: "",
+				SecretFilterLabel:     "",
+				AlerterType:           "smtp",
+				AlerterName:           "example-email",
+				ReportStatus: CertificateAlertStatus{
+					ExpiryDays:    []int64{30, 7, 1},
+					ValidateChain: true,
+					KeyMismatch:   true,
+				},
+			},
+		},
+		Quotas: []QuotaAlertSpec{
+			{
+				Name:                 "*",
+				QuotaFilterNamespace: "",
+				QuotaFilterLabel:     "",
+				AlerterType:          "smtp",
+				AlerterName:          "example-email",
+				ReportStatus: QuotaAlertStatus{
+					UsedPercent:  90,
+					FailedCreate: true,
+				},
+			},
+		},
+		Generic: []GenericAlertSpec{
+			{
+				Name:                   "*",
+				Group:                  "cert-manager.io",
+				Version:                "v1",
+				Resource:               "certificates",
+				GenericFilterNamespace: "",
+				GenericFilterLabel:     "",
+				AlerterType:            "smtp",
+				AlerterName:            "example-email",
+				Conditions: []GenericCondition{
+					{
+						JSONPath:  `.status.conditions[?(@.type=="Ready")].status`,
+						Operator:  "!=",
+						Value:     "True",
+						Threshold: 600,
+					},
+				},
+			},
+		},
 	}
 	TestAlertersConfig = AlertersConfig{
-		AlerterTypes{
-			SMTPAlerterList: []SMTPAlerterConfig{
-				{
+		Types: AlerterTypes{
+			Configs: []AlerterConfig{
+				stubAlerter("smtp", SMTPAlerterConfig{
 					Name:        "example-email",
 					ToAddress:   "kubernetes@example.net",
 					FromAddress: "kubernetes@example.net",
 					MailServer:  "smtp.example.com",
 					Port:        25,
 					Subject:     "Test smtp alerter alert from k8eraid",
-				},
-			},
-			WebhookAlerterList: []WebhookAlerterConfig{
-				{
+				}),
+				stubAlerter("webhook", WebhookAlerterConfig{
 					Name:        "example-webhook",
 					Server:      "http://www.example.com",
 					Subject:     "Test webhook alerter alert from k8eraid",
 					ProxyServer: "",
-				},
-			},
-			PDAlerterList: []PDAlerterConfig{
-				{
+				}),
+				stubAlerter("webhook", WebhookAlerterConfig{
+					Name:          "example-signed-webhook",
+					Server:        "https://hooks.example.com/k8eraid",
+					Method:        "PUT",
+					Headers:       []WebhookHeader{{Name: "X-Team", Value: "platform"}},
+					BodyTemplate:  `{"text": {{ json .Message }}}`,
+					BearerToken:   &SecretValue{EnvVar: "WEBHOOK_TOKEN"},
+					SigningSecret: &SecretValue{Secret: &SecretKeyRef{Name: "k8eraid-webhook", Key: "signing-secret"}},
+				}),
+				stubAlerter("pagerdutyV2", PDAlerterConfig{
 					Name:             "example-pagerduty",
 					ServiceKeyEnvVar: "MYPDKEY",
 					ProxyServer:      "http://someproxy.example.com",
 					Subject:          "Test Pagerduty Alerter alert from k8eraid",
-				},
+				}),
+				stubAlerter("opsgenie", OpsgenieAlerterConfig{
+					Name:         "example-opsgenie",
+					APIKeyEnvVar: "OPSGENIE_KEY",
+					Region:       "eu",
+					Priorities:   map[string]string{SeverityCritical: "P1"},
+					Responders:   []OpsgenieResponder{{Type: "team", Name: "platform"}},
+				}),
+				stubAlerter("msteams", MSTeamsAlerterConfig{
+					Name:        "example-teams",
+					WebhookURL:  "https://example.webhook.office.com/webhookb2/example",
+					ClusterName: "example-cluster",
+				}),
+				stubAlerter("alertmanager", AlertmanagerAlerterConfig{
+					Name: "example-alertmanager",
+					URL:  "http://alertmanager.monitoring:9093",
+				}),
+				stubAlerter("slack", SlackAlerterConfig{
+					Name:             "example-slack-bot",
+					BotTokenEnvVar:   "SLACK_BOT_TOKEN",
+					Channel:          "#k8s-alerts",
+					SeverityChannels: map[string]string{SeverityCritical: "#oncall"},
+					AckButtons:       true,
+				}),
+				stubAlerter("exec", ExecAlerterConfig{
+					Name:    "example-exec",
+					Command: "/usr/local/bin/notify-chat",
+					Args:    []string{"--channel", "ops"},
+				}),
+				stubAlerter("kubeEvent", KubeEventAlerterConfig{
+					Name: "example-events",
+				}),
+			},
+		},
+		Grouping: []GroupingConfig{
+			{
+				AlerterType:    "smtp",
+				AlerterName:    "example-email",
+				GroupBy:        []string{"namespace"},
+				GroupWait:      30,
+				GroupInterval:  300,
+				RepeatInterval: 14400,
+			},
+		},
+		InhibitRules: []InhibitRule{
+			{
+				SourceMatch: map[string]string{"alertname": "NodeNotReady"},
+				TargetMatch: map[string]string{"alertname": "PodFailures"},
+				Equal:       []string{"node"},
+			},
+		},
+		Delivery: DeliveryConfig{
+			RetryPolicy:    RetryPolicy{Retries: 5, Timeout: 20},
+			DeadLetterFile: "/var/lib/k8eraid/dead-letters.json",
+			Fallback:       &AlerterRef{AlerterType: "smtp", AlerterName: "example-email"},
+			Alerters: []AlerterDeliveryConfig{
+				{AlerterType: "pagerdutyV2", AlerterName: "example-pagerduty", RetryPolicy: RetryPolicy{Retries: 10}},
 			},
 		},
 	}
 	return TestConfigRules, TestAlertersConfig
 }
+
+// stubAlerter creates the config of a stub alerter, whose config struct always marshals
+func stubAlerter(alerterType string, config interface{}) AlerterConfig {
+	alerterConfig, err := NewAlerterConfig(alerterType, config)
+	if err != nil {
+		panic(err)
+	}
+	return alerterConfig
+}
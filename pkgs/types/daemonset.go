@@ -27,5 +27,9 @@ type DaemonsetAlertSpec struct {
 	DaemonFilter string               `json:"filter"`
 	AlerterType  string               `json:"alerterType"`
 	AlerterName  string               `json:"alerterName"`
+	Severity     string               `json:"severity"`
+	RunbookURL   string               `json:"runbookURL"`
+	DashboardURL string               `json:"dashboardURL"`
+	Expression   string               `json:"expression"`
 	ReportStatus DaemonsetAlertStatus `json:"reportStatus"`
 }
@@ -26,5 +26,9 @@ type DeploymentAlertSpec struct {
 	DepFilter    string                `json:"filter"`
 	AlerterType  string                `json:"alerterType"`
 	AlerterName  string                `json:"alerterName"`
+	Severity     string                `json:"severity"`
+	RunbookURL   string                `json:"runbookURL"`
+	DashboardURL string                `json:"dashboardURL"`
+	Expression   string                `json:"expression"`
 	ReportStatus DeploymentAlertStatus `json:"reportStatus"`
 }
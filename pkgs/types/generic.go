@@ -0,0 +1,41 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// GenericCondition represents a JSONPath condition to evaluate against an arbitrary resource.
+// Operator is one of ==, !=, <, <=, > or >=, the last four compare numerically.
+type GenericCondition struct {
+	JSONPath  string `json:"jsonPath"`
+	Operator  string `json:"operator"`
+	Value     string `json:"value"`
+	Threshold int64  `json:"threshold"`
+}
+
+// GenericAlertSpec represents the configuration for alerting on any resource, including custom resources
+type GenericAlertSpec struct {
+	Name                   string             `json:"name"`
+	Group                  string             `json:"group"`
+	Version                string             `json:"version"`
+	Resource               string             `json:"resource"`
+	GenericFilterNamespace string             `json:"filterNamespace"`
+	GenericFilterLabel     string             `json:"filterLabel"`
+	AlerterType            string             `json:"alerterType"`
+	AlerterName            string             `json:"alerterName"`
+	Severity               string             `json:"severity"`
+	RunbookURL             string             `json:"runbookURL"`
+	DashboardURL           string             `json:"dashboardURL"`
+	Expression             string             `json:"expression"`
+	Conditions             []GenericCondition `json:"conditions"`
+}
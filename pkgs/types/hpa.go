@@ -0,0 +1,36 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// HPAAlertStatus represents the thresholds to alert on for HorizontalPodAutoscalers
+type HPAAlertStatus struct {
+	MaxReplicasThreshold int64 `json:"maxReplicasThreshold"`
+	ScalingActive        bool  `json:"scalingActive"`
+	AbleToScale          bool  `json:"ableToScale"`
+	PendingThreshold     int64 `json:"pendingThreshold"`
+}
+
+// HPAAlertSpec represents a HorizontalPodAutoscaler Alert Rule
+type HPAAlertSpec struct {
+	Name         string         `json:"name"`
+	HPAFilter    string         `json:"filter"`
+	AlerterType  string         `json:"alerterType"`
+	AlerterName  string         `json:"alerterName"`
+	Severity     string         `json:"severity"`
+	RunbookURL   string         `json:"runbookURL"`
+	DashboardURL string         `json:"dashboardURL"`
+	Expression   string         `json:"expression"`
+	ReportStatus HPAAlertStatus `json:"reportStatus"`
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// IngressAlertStatus represents the thresholds to alert on for Ingresses
+type IngressAlertStatus struct {
+	MissingBackends       bool  `json:"missingBackends"`
+	NoReadyEndpoints      bool  `json:"noReadyEndpoints"`
+	MissingTLSSecrets     bool  `json:"missingTLSSecrets"`
+	LoadBalancerThreshold int64 `json:"loadBalancerThreshold"`
+	PendingThreshold      int64 `json:"pendingThreshold"`
+}
+
+// IngressAlertSpec represents the configuration for alerting on Ingresses
+type IngressAlertSpec struct {
+	Name                   string             `json:"name"`
+	IngressFilterNamespace string             `json:"filterNamespace"`
+	IngressFilterLabel     string             `json:"filterLabel"`
+	AlerterType            string             `json:"alerterType"`
+	AlerterName            string             `json:"alerterName"`
+	Severity               string             `json:"severity"`
+	RunbookURL             string             `json:"runbookURL"`
+	DashboardURL           string             `json:"dashboardURL"`
+	Expression             string             `json:"expression"`
+	ReportStatus           IngressAlertStatus `json:"reportStatus"`
+}
@@ -16,12 +16,28 @@ package types
 
 // NodeAlertStatus represents the thresholds to alert on for Nodes
 type NodeAlertStatus struct {
-	PendingThreshold   int64 `json:"pendingThreshold"`
-	NodeOutOfDisk      bool  `json:"outOfDisk"`
-	NodeMemoryPressure bool  `json:"memoryPressure"`
-	NodeDiskPressure   bool  `json:"diskPressure"`
-	NodeReady          bool  `json:"readiness"`
-	MinNodes           int32 `json:"minNodes"`
+	PendingThreshold       int64       `json:"pendingThreshold"`
+	NodeOutOfDisk          bool        `json:"outOfDisk"`
+	NodeMemoryPressure     bool        `json:"memoryPressure"`
+	NodeDiskPressure       bool        `json:"diskPressure"`
+	NodeReady              bool        `json:"readiness"`
+	NotReadyThreshold      int64       `json:"notReadyThreshold"`
+	MinNodes               int32       `json:"minNodes"`
+	UnschedulableThreshold int64       `json:"unschedulableThreshold"`
+	Taints                 []NodeTaint `json:"taints"`
+	TaintThreshold         int64       `json:"taintThreshold"`
+	MinSchedulableRatio    float64     `json:"minSchedulableRatio"`
+	KubeletVersionSkew     bool        `json:"kubeletVersionSkew"`
+	MaxMinorVersionSkew    int64       `json:"maxMinorVersionSkew"`
+	MixedVersionThreshold  int64       `json:"mixedVersionThreshold"`
+	FlapThreshold          int         `json:"flapThreshold"`
+	FlapWindow             int64       `json:"flapWindow"`
+}
+
+// NodeTaint represents a taint to alert on, an empty Effect matches any effect
+type NodeTaint struct {
+	Key    string `json:"key"`
+	Effect string `json:"effect"`
 }
 
 // NodeAlertSpec represents the configuration for alerting on Node issues
@@ -30,5 +46,9 @@ type NodeAlertSpec struct {
 	NodeFilter   string          `json:"filter"`
 	AlerterType  string          `json:"alerterType"`
 	AlerterName  string          `json:"alerterName"`
+	Severity     string          `json:"severity"`
+	RunbookURL   string          `json:"runbookURL"`
+	DashboardURL string          `json:"dashboardURL"`
+	Expression   string          `json:"expression"`
 	ReportStatus NodeAlertStatus `json:"reportStatus"`
 }
@@ -21,6 +21,8 @@ type PodAlertStatus struct {
 	FailedScheduling bool  `json:"failedScheduling"`
 	PendingThreshold int64 `json:"pendingThreshold"`
 	StuckTerminating bool  `json:"stuckTerminating"`
+	FlapThreshold    int   `json:"flapThreshold"`
+	FlapWindow       int64 `json:"flapWindow"`
 }
 
 // PodAlertSpec represents the configuration for alerting on Pods
@@ -30,5 +32,9 @@ type PodAlertSpec struct {
 	PodFilterLabel     string         `json:"filterLabel"`
 	AlerterType        string         `json:"alerterType"`
 	AlerterName        string         `json:"alerterName"`
+	Severity           string         `json:"severity"`
+	RunbookURL         string         `json:"runbookURL"`
+	DashboardURL       string         `json:"dashboardURL"`
+	Expression         string         `json:"expression"`
 	ReportStatus       PodAlertStatus `json:"reportStatus"`
 }
@@ -0,0 +1,36 @@
+// Copyright 2019 Bloomberg Finance LP
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// QuotaAlertStatus represents the thresholds to alert on for ResourceQuotas
+type QuotaAlertStatus struct {
+	UsedPercent  float64  `json:"usedPercent"`
+	Resources    []string `json:"resources"`
+	FailedCreate bool     `json:"failedCreate"`
+}
+
+// QuotaAlertSpec represents the configuration for alerting on ResourceQuotas
+type QuotaAlertSpec struct {
+	Name                 string           `json:"name"`
+	QuotaFilterNamespace string           `json:"filterNamespace"`
+	QuotaFilterLabel     string           `json:"filterLabel"`
+	AlerterType          string           `json:"alerterType"`
+	AlerterName          string           `json:"alerterName"`
+	Severity             string           `json:"severity"`
+	RunbookURL           string           `json:"runbookURL"`
+	DashboardURL         string           `json:"dashboardURL"`
+	Expression           string           `json:"expression"`
+	ReportStatus         QuotaAlertStatus `json:"reportStatus"`
+}